@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/db"
+	"lium-product/es-search/search/engine"
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/handler"
 	"lium-product/es-search/search/logs"
 	"lium-product/es-search/search/routes"
 )
 
+// defaultDrainTimeout 未配置时退出前等待处理中请求的时间
+const defaultDrainTimeout = 30 * time.Second
+
 func main() {
 	location, err := time.LoadLocation("Asia/Shanghai")
 	if err != nil {
@@ -20,31 +31,65 @@ func main() {
 	time.Local = location
 	cfg.InitLoadCfg()
 	common := cfg.LoadCommon()
-	// 程序退出前处理
-	go Finally()
+	// 初始化 ES 客户端，启动时连接失败直接退出
+	if _, err := esclient.GetClient(); err != nil {
+		logs.GetLogger().Fatalf("init elastic client err: %v", err)
+	}
+
+	// 定时任务在 jobs 取消时退出，目前只有异步任务状态的定期刷新
+	jobs, stopJobs := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.WatchTasks(jobs)
+	}()
 
 	// 注册路由启动服务
-	r := routes.Init(common.Mode)
-	logs.GetLogger().Infof("server start at %s:%d", common.Host, common.Port)
-	err = r.Run(fmt.Sprintf("%s:%d", common.Host, common.Port))
-	if err != nil {
-		logs.GetLogger().Fatalf("run err: %v", err)
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", common.Host, common.Port),
+		Handler: routes.Init(common.Mode),
 	}
+	go func() {
+		logs.GetLogger().Infof("server start at %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logs.GetLogger().Fatalf("run err: %v", err)
+		}
+	}()
+
+	Finally(srv, func() {
+		stopJobs()
+		wg.Wait()
+	})
 }
 
-// Finally 程序退出前的处理
-func Finally() {
+// Finally 收到 SIGTERM / SIGINT 后退出：停止接收新请求并等待处理中的请求结束，停止定时任务，
+// 取消本进程内运行的任务，关闭 ES、MySQL 与 Redis 客户端，最后写出缓冲的日志。
+// 写入都在请求或任务内同步完成，没有需要 flush 的写入缓冲
+func Finally(srv *http.Server, stopJobs func()) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
-	for {
-		v := <-signals
-		switch v {
-		case syscall.SIGTERM:
-			logs.GetLogger().Infof("Got signal %s", v.String())
-			return
-		case syscall.SIGINT:
-			logs.GetLogger().Infof("Got signal %s", v.String())
-			return
-		}
+	v := <-signals
+	logs.GetLogger().Infof("Got signal %s, shutting down", v.String())
+
+	timeout := time.Duration(cfg.LoadCommon().DrainTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logs.GetLogger().Warnf("drain http requests failed: %v", err)
+	}
+	stopJobs()
+	if err := engine.StopLocalTasks(ctx); err != nil {
+		logs.GetLogger().Warnf("stop local tasks failed: %v", err)
+	}
+	esclient.Stop()
+	if err := db.Close(); err != nil {
+		logs.GetLogger().Warnf("close database failed: %v", err)
 	}
+	logs.GetLogger().Infof("server stopped")
+	logs.Sync()
 }
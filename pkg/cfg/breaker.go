@@ -0,0 +1,21 @@
+package cfg
+
+// BreakerRule 一个依赖的熔断与并发隔离配置
+type BreakerRule struct {
+	Failures      int `json:"failures"`       // 连续失败多少次后熔断，为 0 时不熔断
+	OpenTimeout   int `json:"open-timeout"`   // 熔断后多久放行试探请求(Second)，默认 30
+	MaxConcurrent int `json:"max-concurrent"` // 最大并发请求数，为 0 时不限制
+	MaxWait       int `json:"max-wait"`       // 并发已满时最多等待的时间(Millisecond)，为 0 时立即失败
+}
+
+// Breaker 各依赖的熔断与并发隔离配置，每个 ES 集群各自熔断
+type Breaker struct {
+	Elastic BreakerRule `json:"elastic"`
+	MySql   BreakerRule `json:"mysql"`
+	Redis   BreakerRule `json:"redis"`
+}
+
+// LoadBreaker 加载熔断配置
+func LoadBreaker() Breaker {
+	return GetInstance().Breaker
+}
@@ -1,18 +1,28 @@
 package cfg
 
+import "strconv"
+
 type Common struct {
 	Mode           string `json:"mode"`
 	Port           int64  `json:"port"`
 	Host           string `json:"host"`
 	CloseCaptcha   string `json:"close_captcha"`
-	SysName        string `json:"app_name"`     // 产品名称
-	Copyright      string `json:"copyright"`    // 产品名称
-	Version        string `json:"version"`      // 版本
-	StoragePath    string `json:"root_storage"` // 存储路径, storage目录的路径即可，比如：./storage
-	CloseAuthToken string `json:"close_auth_token"`
+	SysName        string `json:"app_name"`         // 产品名称
+	Copyright      string `json:"copyright"`        // 产品名称
+	Version        string `json:"version"`          // 版本
+	StoragePath    string `json:"root_storage"`     // 存储路径, storage目录的路径即可，比如：./storage
+	CloseAuthToken string `json:"close_auth_token"` // 为 true 时允许未携带 token 的匿名请求，默认拒绝
+	ReadyTimeout   int    `json:"ready-timeout"`    // 就绪检查中每个依赖的超时时间(Millisecond)，默认 2000
+	DrainTimeout   int    `json:"drain-timeout"`    // 退出时等待处理中请求与本地任务结束的时间(Second)，默认 30
 }
 
 // LoadCommon 加载Common配置
 func LoadCommon() Common {
 	return GetInstance().Common
 }
+
+// AllowAnonymous 是否允许匿名请求访问 /api/v1
+func (c Common) AllowAnonymous() bool {
+	ok, _ := strconv.ParseBool(c.CloseAuthToken)
+	return ok
+}
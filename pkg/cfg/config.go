@@ -30,6 +30,18 @@ type Cfg struct {
 
 	// Jwt 配置
 	Jwt Jwt `json:"jwt"`
+
+	// Query SQL 查询限制
+	Query Query `json:"query"`
+
+	// Task 异步任务配置
+	Task Task `json:"task"`
+
+	// Cost 查询代价限制
+	Cost Cost `json:"cost"`
+
+	// Breaker 依赖的熔断与并发隔离
+	Breaker Breaker `json:"breaker"`
 }
 
 var (
@@ -67,6 +79,9 @@ func loadCfg() *Cfg {
 	onInitPath(conf)
 	// 更新默认配置
 	RefCfgDefVal(conf)
+	if err := conf.Query.Validate(); err != nil {
+		panic(pf("query", err))
+	}
 
 	return conf
 }
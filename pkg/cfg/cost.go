@@ -0,0 +1,27 @@
+package cfg
+
+// CostThresholds 查询代价阈值，为 0 的项不限制
+type CostThresholds struct {
+	MaxIndices   int     `json:"max-indices"`    // 通配符展开后命中的索引数
+	MaxTimeRange float64 `json:"max-time-range"` // 时间范围跨度(Hour)，设置后未限制时间范围的查询也视为超过阈值
+	MaxTermsSize int     `json:"max-terms-size"` // 各层 terms 聚合桶数的乘积
+	MaxAggDepth  int     `json:"max-agg-depth"`  // 桶聚合的嵌套层数
+	MaxScripts   int     `json:"max-scripts"`    // 脚本条件个数
+}
+
+// CostLimits 超过 confirm 阈值的查询需要确认后执行，超过 reject 阈值的查询被拒绝
+type CostLimits struct {
+	Confirm CostThresholds `json:"confirm"`
+	Reject  CostThresholds `json:"reject"`
+}
+
+// Cost 查询代价限制，roles 按 JWT 中的角色配置，请求者没有已配置的角色时使用 default
+type Cost struct {
+	Default CostLimits            `json:"default"`
+	Roles   map[string]CostLimits `json:"roles"`
+}
+
+// LoadCost 加载查询代价限制配置
+func LoadCost() Cost {
+	return GetInstance().Cost
+}
@@ -1,11 +1,30 @@
 package cfg
 
 type ElasticSearch struct {
-	Address  string `json:"address"`
-	Port     uint   `json:"port"`
-	UserName string `json:"username"`
-	Password string `json:"password"`
-	Sniff    bool   `json:"sniff"`
+	Address  string   `json:"address"`
+	Port     uint     `json:"port"`
+	Hosts    []string `json:"hosts"` // 节点地址列表，例如 https://es-1:9200，设置后忽略 address 与 port
+	UserName string   `json:"username"`
+	Password string   `json:"password"`
+	Sniff    bool     `json:"sniff"`
+	TLS      TLS      `json:"tls"`
+	Gzip     bool     `json:"gzip"` // 压缩请求与响应
+
+	MaxRetries          int `json:"max-retries"`          // 连接失败或 502 / 503 / 504 时的最大重试次数，默认 3，-1 表示不重试
+	RetryMinInterval    int `json:"retry-min-interval"`   // 首次重试的等待时间(Millisecond)，之后指数增长，默认 100
+	RetryMaxInterval    int `json:"retry-max-interval"`   // 重试等待时间的上限(Millisecond)，默认 5000
+	HealthcheckInterval int `json:"healthcheck-interval"` // 节点健康检查的间隔(Second)，为 0 时不检查
+
+	// Clusters 命名集群，通过 FROM cluster.index 或请求中的 cluster 访问，顶层配置为默认集群
+	Clusters map[string]ElasticSearch `json:"clusters"`
+}
+
+// TLS HTTPS 连接配置
+type TLS struct {
+	CAFile             string `json:"ca-file"`              // 校验服务端证书的 CA 证书
+	InsecureSkipVerify bool   `json:"insecure-skip-verify"` // 不校验服务端证书，只用于测试环境
+	CertFile           string `json:"cert-file"`            // 客户端证书，服务端要求双向认证时配置
+	KeyFile            string `json:"key-file"`             // 客户端证书的私钥
 }
 
 // LoadElastic 加载Elastic配置
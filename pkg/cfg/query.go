@@ -0,0 +1,35 @@
+package cfg
+
+import "fmt"
+
+// MaxResultWindow ES 默认的 index.max_result_window，JOIN 按 from / size 分页读取左表，扫描行数不能超过该值
+const MaxResultWindow = 10000
+
+// Query SQL 查询资源限制
+type Query struct {
+	MaxJoinRows   int `json:"max-join-rows"`    // JOIN 时最多扫描的 ES 行数，不能超过 MaxResultWindow
+	JoinBatchSize int `json:"join-batch-size"`  // JOIN 时每批查询 MySQL 的关联键个数
+	MaxJoinFanOut int `json:"max-join-fan-out"` // JOIN 时每行最多关联的右表行数
+	MaxJoinKeys   int `json:"max-join-keys"`    // 关联 ES 索引时最多下推的关联键个数
+
+	JoinTables []string `json:"join-tables"` // 允许 JOIN 的 MySQL 表，其它库的表写作 database.table
+
+	MaxSubqueryRows int `json:"max-subquery-rows"` // 子查询、派生表以及进程内过滤、排序在内存中保存的最大行数
+
+	Timeout        int            `json:"timeout"`          // 查询的默认超时时间(Second)，默认 30
+	MaxTimeout     int            `json:"max-timeout"`      // 请求中可以指定的最大超时时间(Second)，默认与 timeout 相同
+	RoleMaxTimeout map[string]int `json:"role-max-timeout"` // 按角色覆盖 max-timeout，有多个角色时取最大值
+}
+
+// LoadQuery 加载查询限制配置，未配置的项使用默认值
+func LoadQuery() Query {
+	return GetInstance().Query
+}
+
+// Validate 检查查询限制配置
+func (q Query) Validate() error {
+	if q.MaxJoinRows > MaxResultWindow {
+		return fmt.Errorf("max-join-rows %d exceeds the elasticsearch max_result_window of %d", q.MaxJoinRows, MaxResultWindow)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package cfg
+
+// Task 异步任务配置
+type Task struct {
+	NotifyURL    string `json:"notify-url"`    // 任务结束时以 POST JSON 通知的地址，为空时不通知
+	PollInterval int    `json:"poll-interval"` // 后台刷新运行中任务的间隔(Second)
+}
+
+// LoadTask 加载异步任务配置
+func LoadTask() Task {
+	return GetInstance().Task
+}
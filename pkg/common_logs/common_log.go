@@ -74,6 +74,22 @@ func getLogWriter(filename string, maxSize, maxBackup, maxAge int) zapcore.Write
 	return zapcore.AddSync(lumberJackLogger)
 }
 
+// With 返回带有固定字段的日志，例如 With("request_id", id)
+func (l *Logger) With(keysAndValues ...any) *Logger {
+	if l.Logger == nil {
+		return l
+	}
+	return &Logger{Logger: l.Logger.Sugar().With(keysAndValues...).Desugar()}
+}
+
+// Sync 将缓冲的日志写入输出，退出前调用
+func (l *Logger) Sync() error {
+	if l.Logger == nil {
+		return nil
+	}
+	return l.Logger.Sync()
+}
+
 func (l *Logger) Debug(args ...any) {
 	l.Logger.Sugar().WithOptions(zap.AddCallerSkip(1)).Debug(args...)
 }
@@ -0,0 +1,227 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"lium-product/es-search/pkg/cfg"
+)
+
+// ErrOpen 依赖连续失败后熔断，请求直接失败
+var ErrOpen = errors.New("circuit breaker is open")
+
+// ErrFull 依赖的并发请求数已满
+var ErrFull = errors.New("too many concurrent requests")
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    // 正常放行
+	StateOpen     = "open"      // 熔断中，请求直接失败
+	StateHalfOpen = "half-open" // 熔断超时后放行一个试探请求，成功后恢复，失败后继续熔断
+)
+
+// defaultOpenTimeout 未配置时熔断后放行试探请求的等待时间
+const defaultOpenTimeout = 30 * time.Second
+
+// Config 熔断与并发隔离配置
+type Config struct {
+	Failures      int           // 连续失败多少次后熔断，为 0 时不熔断
+	OpenTimeout   time.Duration // 熔断后多久放行试探请求，默认 30s
+	MaxConcurrent int           // 最大并发请求数，为 0 时不限制
+	MaxWait       time.Duration // 并发已满时最多等待的时间，为 0 时立即失败
+}
+
+// FromRule 将配置文件中的熔断规则转为熔断器配置
+func FromRule(r cfg.BreakerRule) Config {
+	return Config{
+		Failures:      r.Failures,
+		OpenTimeout:   time.Duration(r.OpenTimeout) * time.Second,
+		MaxConcurrent: r.MaxConcurrent,
+		MaxWait:       time.Duration(r.MaxWait) * time.Millisecond,
+	}
+}
+
+// Breaker 一个依赖的熔断器与并发隔离（bulkhead）
+type Breaker struct {
+	name string
+	conf Config
+	sem  chan struct{}
+
+	mu       sync.Mutex
+	state    string
+	failures int // 连续失败次数
+	openedAt time.Time
+	probing  bool // 半开状态下已放行试探请求
+	rejected int64
+}
+
+// Status 熔断器状态，由状态接口输出
+type Status struct {
+	Name          string     `json:"name"`
+	State         string     `json:"state"`
+	Failures      int        `json:"failures"`  // 连续失败次数
+	InFlight      int        `json:"in_flight"` // 执行中的请求数
+	MaxConcurrent int        `json:"max_concurrent,omitempty"`
+	Rejected      int64      `json:"rejected"` // 熔断或并发已满时拒绝的请求数
+	OpenedAt      *time.Time `json:"opened_at,omitempty"`
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Breaker)
+)
+
+// New 创建熔断器并以 name 登记到状态接口，同名的熔断器会被替换
+func New(name string, conf Config) *Breaker {
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = defaultOpenTimeout
+	}
+	b := &Breaker{name: name, conf: conf, state: StateClosed}
+	if conf.MaxConcurrent > 0 {
+		b.sem = make(chan struct{}, conf.MaxConcurrent)
+	}
+	registryMu.Lock()
+	registry[name] = b
+	registryMu.Unlock()
+	return b
+}
+
+// Statuses 全部熔断器的状态，按名称排序
+func Statuses() []Status {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	out := make([]Status, 0, len(registry))
+	for _, b := range registry {
+		out = append(out, b.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Status 熔断器当前的状态
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Status{Name: b.name, State: b.state, Failures: b.failures, InFlight: len(b.sem),
+		MaxConcurrent: b.conf.MaxConcurrent, Rejected: b.rejected}
+	if b.state == StateOpen && b.expired() {
+		s.State = StateHalfOpen
+	}
+	if b.state != StateClosed {
+		t := b.openedAt
+		s.OpenedAt = &t
+	}
+	return s
+}
+
+// Acquire 申请执行一次请求：熔断中返回 ErrOpen，并发已满且等待超时返回 ErrFull。
+// 成功时返回的 done 必须在请求结束时调用，failed 表示请求是否因依赖故障失败
+func (b *Breaker) Acquire(ctx context.Context) (done func(failed bool), err error) {
+	probe, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.enter(ctx); err != nil {
+		b.mu.Lock()
+		if probe {
+			b.probing = false
+		}
+		b.rejected++
+		b.mu.Unlock()
+		return nil, err
+	}
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() {
+			if b.sem != nil {
+				<-b.sem
+			}
+			b.record(failed, probe)
+		})
+	}, nil
+}
+
+// allow 检查熔断状态，熔断超时后的第一个请求作为试探请求放行
+func (b *Breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if !b.expired() {
+			b.rejected++
+			return false, fmt.Errorf("%s %w", b.name, ErrOpen)
+		}
+		b.state, b.probing = StateHalfOpen, true
+		return true, nil
+	case StateHalfOpen:
+		if b.probing {
+			b.rejected++
+			return false, fmt.Errorf("%s %w", b.name, ErrOpen)
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// enter 占用一个并发名额，已满时最多等待 MaxWait
+func (b *Breaker) enter(ctx context.Context) error {
+	if b.sem == nil {
+		return nil
+	}
+	select {
+	case b.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if b.conf.MaxWait <= 0 {
+		return fmt.Errorf("%s: %w", b.name, ErrFull)
+	}
+	timer := time.NewTimer(b.conf.MaxWait)
+	defer timer.Stop()
+	select {
+	case b.sem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%s: %w", b.name, ErrFull)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// record 记录请求结果：连续失败达到阈值时熔断，试探请求成功时恢复、失败时重新熔断
+func (b *Breaker) record(failed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+		if failed {
+			b.state, b.openedAt = StateOpen, time.Now()
+		} else {
+			b.state, b.failures = StateClosed, 0
+		}
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == StateClosed && b.conf.Failures > 0 && b.failures >= b.conf.Failures {
+		b.state, b.openedAt = StateOpen, time.Now()
+	}
+}
+
+// expired 熔断时间是否已超过 OpenTimeout
+func (b *Breaker) expired() bool {
+	return time.Since(b.openedAt) >= b.conf.OpenTimeout
+}
+
+// IsRejected 错误是否为熔断或并发已满导致的拒绝
+func IsRejected(err error) bool {
+	return errors.Is(err, ErrOpen) || errors.Is(err, ErrFull)
+}
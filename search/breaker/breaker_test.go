@@ -0,0 +1,77 @@
+package breaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := New("test", Config{Failures: 2, OpenTimeout: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	fail := func() {
+		done, err := b.Acquire(ctx)
+		if assert.NoError(t, err) {
+			done(true)
+		}
+	}
+	fail()
+	assert.Equal(t, StateClosed, b.Status().State)
+	fail()
+	assert.Equal(t, StateOpen, b.Status().State)
+	_, err := b.Acquire(ctx)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.True(t, IsRejected(err))
+
+	// 熔断超时后只放行一个试探请求，失败后继续熔断
+	time.Sleep(25 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.Status().State)
+	done, err := b.Acquire(ctx)
+	assert.NoError(t, err)
+	_, err = b.Acquire(ctx)
+	assert.ErrorIs(t, err, ErrOpen)
+	done(true)
+	assert.Equal(t, StateOpen, b.Status().State)
+
+	// 试探成功后恢复
+	time.Sleep(25 * time.Millisecond)
+	done, err = b.Acquire(ctx)
+	assert.NoError(t, err)
+	done(false)
+	s := b.Status()
+	assert.Equal(t, StateClosed, s.State)
+	assert.Equal(t, 0, s.Failures)
+	assert.Equal(t, int64(2), s.Rejected)
+	assert.Nil(t, s.OpenedAt)
+}
+
+func TestBulkhead(t *testing.T) {
+	b := New("bulkhead", Config{MaxConcurrent: 1, MaxWait: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	done, err := b.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.Status().InFlight)
+	_, err = b.Acquire(ctx)
+	assert.ErrorIs(t, err, ErrFull)
+
+	// 等待期间名额释放时可以执行
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		done(false)
+	}()
+	done, err = b.Acquire(ctx)
+	assert.NoError(t, err)
+	done(false)
+	done(false) // 重复调用只释放一次
+	assert.Equal(t, 0, b.Status().InFlight)
+
+	var names []string
+	for _, s := range Statuses() {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{"bulkhead", "test"}, names)
+}
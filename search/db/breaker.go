@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+
+	"lium-product/es-search/search/breaker"
+)
+
+// breakerPlugin gorm 插件，SQL 经过熔断器执行：熔断或并发已满时直接失败，连接失败与超时计为失败
+type breakerPlugin struct {
+	breaker *breaker.Breaker
+}
+
+const breakerDoneKey = "breaker:done"
+
+func (p *breakerPlugin) Name() string {
+	return "breaker"
+}
+
+func (p *breakerPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("breaker:before_create", p.before),
+		cb.Create().After("gorm:create").Register("breaker:after_create", p.after),
+		cb.Query().Before("gorm:query").Register("breaker:before_query", p.before),
+		cb.Query().After("gorm:query").Register("breaker:after_query", p.after),
+		cb.Update().Before("gorm:update").Register("breaker:before_update", p.before),
+		cb.Update().After("gorm:update").Register("breaker:after_update", p.after),
+		cb.Delete().Before("gorm:delete").Register("breaker:before_delete", p.before),
+		cb.Delete().After("gorm:delete").Register("breaker:after_delete", p.after),
+		cb.Row().Before("gorm:row").Register("breaker:before_row", p.before),
+		cb.Row().After("gorm:row").Register("breaker:after_row", p.after),
+		cb.Raw().Before("gorm:raw").Register("breaker:before_raw", p.before),
+		cb.Raw().After("gorm:raw").Register("breaker:after_raw", p.after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *breakerPlugin) before(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	done, err := p.breaker.Acquire(db.Statement.Context)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.InstanceSet(breakerDoneKey, done)
+}
+
+func (p *breakerPlugin) after(db *gorm.DB) {
+	if v, ok := db.InstanceGet(breakerDoneKey); ok {
+		v.(func(bool))(mysqlFailed(db.Error))
+	}
+}
+
+// mysqlFailed 错误是否说明 MySQL 不可用：MySQL 返回的错误（如语法错误）、记录不存在与请求取消不计为失败
+func mysqlFailed(err error) bool {
+	var me *mysql.MySQLError
+	switch {
+	case err == nil, errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, context.Canceled), errors.As(err, &me):
+		return false
+	}
+	return true
+}
+
+// redisHook go-redis 钩子，命令经过熔断器执行
+type redisHook struct {
+	breaker *breaker.Breaker
+}
+
+type redisDoneKey struct{}
+
+func (h *redisHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	done, err := h.breaker.Acquire(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, redisDoneKey{}, done), nil
+}
+
+func (h *redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if done, ok := ctx.Value(redisDoneKey{}).(func(bool)); ok {
+		done(redisFailed(cmd.Err()))
+	}
+	return nil
+}
+
+func (h *redisHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return h.BeforeProcess(ctx, nil)
+}
+
+func (h *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	done, ok := ctx.Value(redisDoneKey{}).(func(bool))
+	if !ok {
+		return nil
+	}
+	failed := false
+	for _, cmd := range cmds {
+		failed = failed || redisFailed(cmd.Err())
+	}
+	done(failed)
+	return nil
+}
+
+// redisFailed 错误是否说明 Redis 不可用：key 不存在、Redis 返回的错误与请求取消不计为失败
+func redisFailed(err error) bool {
+	var re redis.Error
+	switch {
+	case err == nil, err == redis.Nil, errors.Is(err, context.Canceled), errors.As(err, &re):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClose(t *testing.T) {
+	assert.NoError(t, Close())
+	_, err := GetMysql()
+	assert.ErrorIs(t, err, ErrClosed)
+	_, err = GetRedis()
+	assert.ErrorIs(t, err, ErrClosed)
+}
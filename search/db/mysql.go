@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/breaker"
+	"lium-product/es-search/search/logs"
+)
+
+// ErrClosed 服务退出时 Close 之后不再创建连接
+var ErrClosed = errors.New("database connections are closed")
+
+var (
+	mysqlMu     sync.Mutex
+	mysqlDB     *gorm.DB
+	mysqlClosed bool
+)
+
+// GetMysql 获取 MySQL 连接，首次调用时按配置初始化，初始化失败时下次调用会重试；Close 之后返回 ErrClosed
+func GetMysql() (*gorm.DB, error) {
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+	if mysqlClosed {
+		return nil, ErrClosed
+	}
+	if mysqlDB != nil {
+		return mysqlDB, nil
+	}
+	conf := cfg.LoadMysql()
+	charset := conf.CharSet
+	if charset == "" {
+		charset = "utf8mb4"
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
+		conf.UserName, conf.Password, conf.Address, conf.Port, conf.Database, charset)
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.New(gormWriter{}, logger.Config{
+			SlowThreshold: time.Duration(conf.SlowTime) * time.Millisecond,
+			LogLevel:      logLevel(conf.LogLevel),
+		}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect mysql failed: %v", err)
+	}
+	if err := db.Use(&breakerPlugin{breaker: breaker.New("mysql", breaker.FromRule(cfg.LoadBreaker().MySql))}); err != nil {
+		return nil, err
+	}
+	mysqlDB = db
+	return mysqlDB, nil
+}
+
+// SetMysql 设置 MySQL 连接，测试用
+func SetMysql(db *gorm.DB) {
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+	mysqlDB = db
+}
+
+// gormWriter 将 gorm 日志写入服务日志
+type gormWriter struct{}
+
+func (gormWriter) Printf(format string, args ...interface{}) {
+	logs.GetLogger().Infof(format, args...)
+}
+
+// logLevel 配置中的日志级别转为 gorm 日志级别
+func logLevel(level string) logger.LogLevel {
+	switch strings.ToLower(level) {
+	case "debug", "info", "-1":
+		return logger.Info
+	case "warn", "warning", "0", "1":
+		return logger.Warn
+	case "silent":
+		return logger.Silent
+	}
+	return logger.Error
+}
+
+// Close 关闭 MySQL 与 Redis 连接，服务退出前调用，之后 GetMysql 与 GetRedis 返回 ErrClosed
+func Close() error {
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+	mysqlClosed = true
+	var first error
+	if mysqlDB != nil {
+		if sqlDB, err := mysqlDB.DB(); err == nil {
+			first = sqlDB.Close()
+		}
+		mysqlDB = nil
+	}
+	if err := closeRedis(); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/breaker"
+)
+
+var (
+	redisMu     sync.Mutex
+	redisClient *redis.Client
+	redisClosed bool
+)
+
+// GetRedis 获取 Redis 客户端，首次调用时按配置创建，连接在执行命令时建立；Close 之后返回 ErrClosed
+func GetRedis() (*redis.Client, error) {
+	redisMu.Lock()
+	defer redisMu.Unlock()
+	if redisClosed {
+		return nil, ErrClosed
+	}
+	if redisClient == nil {
+		conf := cfg.LoadRedis()
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", conf.Address, conf.Port),
+			Password: conf.Password,
+			DB:       conf.Database,
+		})
+		redisClient.AddHook(&redisHook{breaker: breaker.New("redis", breaker.FromRule(cfg.LoadBreaker().Redis))})
+	}
+	return redisClient, nil
+}
+
+// closeRedis 关闭 Redis 客户端，之后 GetRedis 返回 ErrClosed
+func closeRedis() error {
+	redisMu.Lock()
+	defer redisMu.Unlock()
+	redisClosed = true
+	if redisClient == nil {
+		return nil
+	}
+	err := redisClient.Close()
+	redisClient = nil
+	return err
+}
@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/metrics"
+)
+
+// scanKeepAlive 分批读取时 point in time 与 scroll 的保留时间
+const scanKeepAlive = "5m"
+
+// Backend 执行翻译后的查询，屏蔽 Elasticsearch 7 / 8 与 OpenSearch 之间请求形式的差异
+type Backend interface {
+	// Search 执行一次查询，body 为 *elastic.SearchSource 或可以序列化为 JSON 的请求体，index 为空时不指定索引
+	Search(ctx context.Context, index string, body interface{}) (*elastic.SearchResult, error)
+	// OpenPointInTime 在索引上打开 point in time，服务端不支持时返回空字符串
+	OpenPointInTime(ctx context.Context, index, keepAlive string) (string, error)
+	// ClosePointInTime 关闭 point in time
+	ClosePointInTime(ctx context.Context, id string) error
+}
+
+// backend 按客户端所连服务端的发行版与版本选择 Backend
+func (e *Engine) backend(ctx context.Context) (Backend, error) {
+	if e.client == nil {
+		return nil, fmt.Errorf("elasticsearch client is not initialized")
+	}
+	server, err := esclient.ServerOf(ctx, e.client)
+	if err != nil {
+		return nil, err
+	}
+	if server.Distribution == esclient.OpenSearch {
+		return &openSearchBackend{client: e.client, server: server}, nil
+	}
+	return &elasticBackend{client: e.client, server: server}, nil
+}
+
+// elasticBackend Elasticsearch 7.x / 8.x，8.x 的兼容请求头由客户端的 transport 添加
+type elasticBackend struct {
+	client *elastic.Client
+	server *esclient.Server
+}
+
+func (b *elasticBackend) Search(ctx context.Context, index string, body interface{}) (*elastic.SearchResult, error) {
+	return search(ctx, b.client, index, body)
+}
+
+// OpenPointInTime POST /{index}/_pit，7.10 起支持
+func (b *elasticBackend) OpenPointInTime(ctx context.Context, index, keepAlive string) (string, error) {
+	if !b.server.AtLeast(7, 10) {
+		return "", nil
+	}
+	resp, err := esclient.Call(ctx, b.client, b.client.OpenPointInTime(index).KeepAlive(keepAlive).Do)
+	if err != nil {
+		return "", err
+	}
+	return resp.Id, nil
+}
+
+// ClosePointInTime DELETE /_pit {"id": ...}
+func (b *elasticBackend) ClosePointInTime(ctx context.Context, id string) error {
+	_, err := esclient.Call(ctx, b.client, b.client.ClosePointInTime(id).Do)
+	return err
+}
+
+// openSearchBackend OpenSearch 1.x / 2.x，point in time 的接口路径与请求体和 Elasticsearch 不同
+type openSearchBackend struct {
+	client *elastic.Client
+	server *esclient.Server
+}
+
+func (b *openSearchBackend) Search(ctx context.Context, index string, body interface{}) (*elastic.SearchResult, error) {
+	return search(ctx, b.client, index, body)
+}
+
+// OpenPointInTime POST /{index}/_search/point_in_time，2.4 起支持，返回的 ID 在 pit_id 中
+func (b *openSearchBackend) OpenPointInTime(ctx context.Context, index, keepAlive string) (string, error) {
+	if !b.server.AtLeast(2, 4) {
+		return "", nil
+	}
+	resp, err := esclient.Call(ctx, b.client, func(ctx context.Context) (*elastic.Response, error) {
+		return b.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: http.MethodPost,
+			Path:   "/" + url.PathEscape(index) + "/_search/point_in_time",
+			Params: url.Values{"keep_alive": []string{keepAlive}},
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		PitID string `json:"pit_id"`
+	}
+	if err := json.Unmarshal(resp.Body, &out); err != nil {
+		return "", err
+	}
+	return out.PitID, nil
+}
+
+// ClosePointInTime DELETE /_search/point_in_time {"pit_id": [...]}
+func (b *openSearchBackend) ClosePointInTime(ctx context.Context, id string) error {
+	_, err := esclient.Call(ctx, b.client, func(ctx context.Context) (*elastic.Response, error) {
+		return b.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: http.MethodDelete,
+			Path:   "/_search/point_in_time",
+			Body:   map[string]interface{}{"pit_id": []string{id}},
+		})
+	})
+	return err
+}
+
+// search 两种服务端的 _search 请求形式相同
+func search(ctx context.Context, client *elastic.Client, index string, body interface{}) (*elastic.SearchResult, error) {
+	svc := client.Search()
+	if index != "" {
+		svc = svc.Index(index)
+	}
+	return esclient.Call(ctx, client, svc.Source(body).Do)
+}
+
+// scanAll 按批读取查询的全部结果，page 返回 false 时停止。服务端支持 point in time 时使用 PIT 与 search_after，
+// 否则使用 scroll
+func (e *Engine) scanAll(ctx context.Context, index string, src *elastic.SearchSource, size int,
+	page func(hits []*elastic.SearchHit) (bool, error)) error {
+	b, err := e.backend(ctx)
+	if err != nil {
+		return err
+	}
+	pit, err := b.OpenPointInTime(ctx, index, scanKeepAlive)
+	if err != nil {
+		return err
+	}
+	if pit == "" {
+		return e.scroll(ctx, index, src, size, page)
+	}
+	defer func() { _ = b.ClosePointInTime(context.Background(), pit) }()
+
+	// search_after 需要排序，按 _doc 排序开销最小，ES 会在 PIT 查询中补充 _shard_doc 作为同值时的排序
+	body, err := src.From(0).Size(size).Sort("_doc", true).Source()
+	if err != nil {
+		return err
+	}
+	m, ok := body.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected search source %T", body)
+	}
+	for {
+		m["pit"] = map[string]interface{}{"id": pit, "keep_alive": scanKeepAlive}
+		start := time.Now()
+		resp, err := b.Search(ctx, "", m)
+		metrics.ObserveSearch(e.cluster, "scan", time.Since(start), err)
+		if err != nil {
+			return err
+		}
+		if resp.PitId != "" {
+			pit = resp.PitId
+		}
+		if resp.Hits == nil || len(resp.Hits.Hits) == 0 {
+			return nil
+		}
+		hits := resp.Hits.Hits
+		if more, err := page(hits); err != nil || !more {
+			return err
+		}
+		m["search_after"] = hits[len(hits)-1].Sort
+	}
+}
+
+// scroll 使用 scroll 分批读取，用于不支持 point in time 的服务端
+func (e *Engine) scroll(ctx context.Context, index string, src *elastic.SearchSource, size int,
+	page func(hits []*elastic.SearchHit) (bool, error)) error {
+	svc := e.client.Scroll(index).KeepAlive(scanKeepAlive).SearchSource(src.From(0).Size(size))
+	defer func() { _ = svc.Clear(context.Background()) }()
+	for {
+		start := time.Now()
+		resp, err := esclient.Call(ctx, e.client, svc.Do)
+		if err == io.EOF {
+			return nil
+		}
+		metrics.ObserveSearch(e.cluster, "scan", time.Since(start), err)
+		if err != nil {
+			return err
+		}
+		if more, err := page(resp.Hits.Hits); err != nil || !more {
+			return err
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// ErrUnknownCluster 没有该名称的 ES 集群
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+// ClusterProvider 按名称获取 ES 集群的客户端
+type ClusterProvider func(name string) (*elastic.Client, error)
+
+// bindCluster 去掉数据源名称中的 cluster. 前缀，返回使用该集群客户端的引擎。
+// 一条语句只能访问一个集群，语句中的前缀与请求指定的集群不一致时报错
+func (e *Engine) bindCluster(stmt sqlparser.Statement) (*Engine, error) {
+	cluster := e.cluster
+	for _, name := range tableNames(stmt) {
+		src, rest := splitSource(*name)
+		if src != SourceES {
+			continue
+		}
+		i := strings.Index(rest, ".")
+		if i <= 0 || !e.clusters[rest[:i]] {
+			continue
+		}
+		if cluster != "" && cluster != rest[:i] {
+			return nil, fmt.Errorf("statement uses clusters %s and %s, only one cluster per statement is supported", cluster, rest[:i])
+		}
+		cluster = rest[:i]
+		*name = strings.TrimSuffix(*name, rest) + rest[i+1:]
+	}
+	return e.withCluster(cluster)
+}
+
+// withCluster 返回使用指定集群客户端的引擎副本，cluster 为空时使用默认集群
+func (e *Engine) withCluster(cluster string) (*Engine, error) {
+	if cluster == "" {
+		return e, nil
+	}
+	if !e.clusters[cluster] {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCluster, cluster)
+	}
+	client, err := e.clusterClient(cluster)
+	if err != nil {
+		return nil, fmt.Errorf("connect cluster %s failed: %w", cluster, err)
+	}
+	c := *e
+	c.client, c.cluster = client, cluster
+	return &c, nil
+}
+
+// tableNames 语句中全部数据源名称，包括 JOIN、派生表、IN 子查询与 UNION 中的各个 SELECT
+func tableNames(stmt sqlparser.Statement) []*string {
+	var out []*string
+	var inSelect func(s *sqlparser.SelectStmt)
+	inWhere := func(where sqlparser.Expr) {
+		sqlparser.Walk(where, func(n sqlparser.Expr) bool {
+			if in, ok := n.(*sqlparser.InExpr); ok && in.Select != nil {
+				inSelect(in.Select)
+			}
+			return true
+		})
+	}
+	inTable := func(t *sqlparser.TableRef) {
+		if t == nil {
+			return
+		}
+		if t.Select != nil {
+			inSelect(t.Select)
+		} else {
+			out = append(out, &t.Name)
+		}
+	}
+	inSelect = func(s *sqlparser.SelectStmt) {
+		inTable(s.From)
+		for _, j := range s.Joins {
+			inTable(j.Table)
+		}
+		inWhere(s.Where)
+	}
+
+	switch s := stmt.(type) {
+	case *sqlparser.ExplainStmt:
+		return tableNames(s.Stmt)
+	case *sqlparser.SelectStmt:
+		inSelect(s)
+	case *sqlparser.UnionStmt:
+		for _, sel := range s.Selects {
+			inSelect(sel)
+		}
+	case *sqlparser.InsertStmt:
+		out = append(out, &s.Table)
+		if s.Select != nil {
+			inSelect(s.Select)
+		}
+	case *sqlparser.UpdateStmt:
+		inTable(s.Table)
+		inWhere(s.Where)
+	case *sqlparser.DeleteStmt:
+		inTable(s.Table)
+		inWhere(s.Where)
+	case *sqlparser.CreateTableStmt:
+		out = append(out, &s.Table)
+	case *sqlparser.AlterTableStmt:
+		out = append(out, &s.Table)
+	}
+	return out
+}
@@ -0,0 +1,313 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/translator"
+)
+
+// ErrCostExceeded 查询代价超过拒绝阈值
+var ErrCostExceeded = errors.New("query cost exceeds the limit")
+
+// ErrConfirmRequired 查询代价超过确认阈值，需要确认后才能执行
+var ErrConfirmRequired = errors.New("query cost requires confirmation")
+
+// 代价检查的结论
+const (
+	costAllow   = "allow"
+	costConfirm = "confirm"
+	costReject  = "reject"
+)
+
+// CostThresholds 代价阈值，为 0 的项不限制
+type CostThresholds struct {
+	MaxIndices   int     // 通配符展开后命中的索引数
+	MaxTimeRange float64 // 时间范围跨度(Hour)，设置后未限制时间范围的查询也视为超过阈值
+	MaxTermsSize int     // 各层 terms / composite 聚合桶数的乘积
+	MaxAggDepth  int     // 桶聚合的嵌套层数
+	MaxScripts   int     // 脚本条件个数
+}
+
+// CostLimits 查询代价限制：超过 Confirm 时需要确认后执行，超过 Reject 时拒绝执行
+type CostLimits struct {
+	Confirm CostThresholds
+	Reject  CostThresholds
+}
+
+// Cost 执行前的代价估算
+type Cost struct {
+	Indices   int     `json:"indices"`    // 通配符展开后命中的索引数
+	TimeRange float64 `json:"time_range"` // 时间范围跨度(Hour)，-1 表示未限制时间范围
+	TermsSize int     `json:"terms_size"` // 各层 terms / composite 聚合桶数的乘积
+	AggDepth  int     `json:"agg_depth"`  // 桶聚合的嵌套层数
+	Scripts   int     `json:"scripts"`    // 脚本条件个数
+
+	Decision string   `json:"decision"`          // allow / confirm / reject
+	Reasons  []string `json:"reasons,omitempty"` // 超过的阈值
+}
+
+// exceeded 超过的阈值
+func (c *Cost) exceeded(t CostThresholds) []string {
+	var out []string
+	if t.MaxIndices > 0 && c.Indices > t.MaxIndices {
+		out = append(out, fmt.Sprintf("indices %d > %d", c.Indices, t.MaxIndices))
+	}
+	if t.MaxTimeRange > 0 {
+		if c.TimeRange < 0 {
+			out = append(out, "time range is unbounded")
+		} else if c.TimeRange > t.MaxTimeRange {
+			out = append(out, fmt.Sprintf("time range %gh > %gh", c.TimeRange, t.MaxTimeRange))
+		}
+	}
+	if t.MaxTermsSize > 0 && c.TermsSize > t.MaxTermsSize {
+		out = append(out, fmt.Sprintf("terms size %d > %d", c.TermsSize, t.MaxTermsSize))
+	}
+	if t.MaxAggDepth > 0 && c.AggDepth > t.MaxAggDepth {
+		out = append(out, fmt.Sprintf("aggregation depth %d > %d", c.AggDepth, t.MaxAggDepth))
+	}
+	if t.MaxScripts > 0 && c.Scripts > t.MaxScripts {
+		out = append(out, fmt.Sprintf("scripts %d > %d", c.Scripts, t.MaxScripts))
+	}
+	return out
+}
+
+// checkCost 估算查询代价，超过拒绝阈值时报错，超过确认阈值且未确认时报错
+func (e *Engine) checkCost(ctx context.Context, req *translator.Request) error {
+	if e.cost == (CostLimits{}) {
+		return nil
+	}
+	c, err := e.estimateCost(ctx, req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.Decision == costReject:
+		return fmt.Errorf("%w: %s", ErrCostExceeded, strings.Join(c.Reasons, ", "))
+	case c.Decision == costConfirm && !e.confirm:
+		return fmt.Errorf("%w: %s, resend with confirm to run it", ErrConfirmRequired, strings.Join(c.Reasons, ", "))
+	}
+	return nil
+}
+
+// estimateCost 从翻译后的 DSL 估算查询代价
+func (e *Engine) estimateCost(ctx context.Context, req *translator.Request) (*Cost, error) {
+	src, err := req.Source.Source()
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, err
+	}
+
+	c := &Cost{Decision: costAllow}
+	if c.Indices, err = e.countIndices(ctx, req.Index); err != nil {
+		return nil, err
+	}
+	bounds := make(map[string]*timeBounds)
+	walkQuery(body["query"], true, func(key string, v interface{}, narrowing bool) {
+		switch {
+		case key == "script":
+			c.Scripts++
+		case narrowing:
+			collectRanges(v, bounds)
+		}
+	})
+	c.TimeRange = timeRange(bounds, time.Now())
+	aggs, _ := body["aggregations"].(map[string]interface{})
+	c.AggDepth, c.TermsSize = aggCost(aggs)
+
+	if c.Reasons = c.exceeded(e.cost.Reject); len(c.Reasons) > 0 {
+		c.Decision = costReject
+	} else if c.Reasons = c.exceeded(e.cost.Confirm); len(c.Reasons) > 0 {
+		c.Decision = costConfirm
+	}
+	return c, nil
+}
+
+// countIndices 逗号分隔的索引个数，带通配符的部分通过 _cat/indices 展开
+func (e *Engine) countIndices(ctx context.Context, index string) (int, error) {
+	n := 0
+	for _, name := range strings.Split(index, ",") {
+		if e.client == nil || !strings.ContainsAny(name, "*?") {
+			n++
+			continue
+		}
+		rows, err := esclient.Call(ctx, e.client, e.client.CatIndices().Index(name).Columns("index").Do)
+		if err != nil {
+			return 0, err
+		}
+		n += len(rows)
+	}
+	return n, nil
+}
+
+// walkQuery 遍历查询条件，narrowing 表示条件是否缩小结果范围，should 与 must_not 中的条件不缩小范围
+func walkQuery(v interface{}, narrowing bool, fn func(key string, v interface{}, narrowing bool)) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, child := range x {
+			// script 查询为 {"script": {"script": {...}}}
+			if m, ok := child.(map[string]interface{}); ok && k == "script" {
+				if _, ok := m["script"]; ok {
+					fn(k, child, narrowing)
+					continue
+				}
+			}
+			if k == "range" {
+				fn(k, child, narrowing)
+				continue
+			}
+			walkQuery(child, narrowing && k != "should" && k != "must_not", fn)
+		}
+	case []interface{}:
+		for _, child := range x {
+			walkQuery(child, narrowing, fn)
+		}
+	}
+}
+
+// timeBounds 同一字段上的时间范围，多个条件取交集
+type timeBounds struct {
+	lower, upper *time.Time
+}
+
+// collectRanges 记录 range 查询中取值为日期的上下界
+func collectRanges(v interface{}, bounds map[string]*timeBounds) {
+	fields, _ := v.(map[string]interface{})
+	for field, p := range fields {
+		params, _ := p.(map[string]interface{})
+		for k, x := range params {
+			t, ok := dateBound(x, time.Now())
+			if !ok {
+				continue
+			}
+			b := bounds[field]
+			if b == nil {
+				b = &timeBounds{}
+				bounds[field] = b
+			}
+			switch k {
+			case "from", "gt", "gte":
+				if b.lower == nil || t.After(*b.lower) {
+					b.lower = &t
+				}
+			case "to", "lt", "lte":
+				if b.upper == nil || t.Before(*b.upper) {
+					b.upper = &t
+				}
+			}
+		}
+	}
+}
+
+// timeRange 各日期字段中最窄的时间范围(Hour)，没有下界的字段视为未限制，缺少上界时截止到当前时间
+func timeRange(bounds map[string]*timeBounds, now time.Time) float64 {
+	width := -1.0
+	for _, b := range bounds {
+		if b.lower == nil {
+			continue
+		}
+		upper := now
+		if b.upper != nil {
+			upper = *b.upper
+		}
+		h := math.Max(upper.Sub(*b.lower).Hours(), 0)
+		if width < 0 || h < width {
+			width = h
+		}
+	}
+	return width
+}
+
+var dateMathRe = regexp.MustCompile(`([+-])(\d+)([yMwdhHms])`)
+
+// dateBound 解析 range 的日期取值：日期字符串或 now-7d 形式的日期表达式，数字不视为日期
+func dateBound(v interface{}, now time.Time) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	if strings.HasPrefix(s, "now") {
+		t := now
+		for _, m := range dateMathRe.FindAllStringSubmatch(s, -1) {
+			n, _ := strconv.Atoi(m[2])
+			if m[1] == "-" {
+				n = -n
+			}
+			switch m[3] {
+			case "y":
+				t = t.AddDate(n, 0, 0)
+			case "M":
+				t = t.AddDate(0, n, 0)
+			case "w":
+				t = t.AddDate(0, 0, 7*n)
+			case "d":
+				t = t.AddDate(0, 0, n)
+			case "h", "H":
+				t = t.Add(time.Duration(n) * time.Hour)
+			case "m":
+				t = t.Add(time.Duration(n) * time.Minute)
+			case "s":
+				t = t.Add(time.Duration(n) * time.Second)
+			}
+		}
+		return t, true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// aggCost 桶聚合的最大嵌套层数与各层 terms / composite 桶数乘积的最大值，未指定 size 时按 ES 默认的 10 计算
+func aggCost(aggs map[string]interface{}) (int, int) {
+	depth, size := 0, 0
+	for _, a := range aggs {
+		agg, _ := a.(map[string]interface{})
+		d, s := 0, 1
+		for _, kind := range []string{"terms", "composite", "date_histogram", "histogram"} {
+			body, ok := agg[kind].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			d = 1
+			if kind == "terms" || kind == "composite" {
+				s = 10
+				if n, ok := body["size"].(float64); ok {
+					s = int(n)
+				}
+			}
+		}
+		sub, _ := agg["aggregations"].(map[string]interface{})
+		sd, ss := aggCost(sub)
+		if d+sd == 0 {
+			continue
+		}
+		if d+sd > depth {
+			depth = d + sd
+		}
+		if ss > 0 {
+			s *= ss
+		}
+		if s > size {
+			size = s
+		}
+	}
+	return depth, size
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// translateDDL 检查权限并翻译 CREATE TABLE / ALTER TABLE
+func (e *Engine) translateDDL(stmt sqlparser.Statement) (*translator.DDLRequest, error) {
+	if !e.admin {
+		return nil, fmt.Errorf("%w: DDL statements require admin permission", ErrPermissionDenied)
+	}
+	switch s := stmt.(type) {
+	case *sqlparser.CreateTableStmt:
+		index, err := writeIndex(s.Table)
+		if err != nil {
+			return nil, err
+		}
+		c := *s
+		c.Table = index
+		return translator.TranslateCreateTable(&c)
+	case *sqlparser.AlterTableStmt:
+		index, err := writeIndex(s.Table)
+		if err != nil {
+			return nil, err
+		}
+		c := *s
+		c.Table = index
+		return translator.TranslateAlterTable(&c)
+	}
+	return nil, fmt.Errorf("unsupported statement")
+}
+
+// ddl 执行 CREATE TABLE / ALTER TABLE，dry-run 模式只做检查
+func (e *Engine) ddl(ctx context.Context, stmt sqlparser.Statement) (*Result, error) {
+	req, err := e.translateDDL(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if e.client == nil {
+		return nil, fmt.Errorf("elasticsearch client is not initialized")
+	}
+
+	switch s := stmt.(type) {
+	case *sqlparser.CreateTableStmt:
+		exists, err := esclient.Call(ctx, e.client, e.client.IndexExists(req.Index).Do)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			if s.IfNotExists {
+				return &Result{DryRun: e.dryRun}, nil
+			}
+			return nil, fmt.Errorf("table '%s' already exists", req.Index)
+		}
+		if e.dryRun {
+			return &Result{DryRun: true}, nil
+		}
+		if _, err := esclient.Call(ctx, e.client, e.client.CreateIndex(req.Index).BodyJson(req.Body).Do); err != nil {
+			return nil, err
+		}
+	case *sqlparser.AlterTableStmt:
+		mappings, err := esclient.Call(ctx, e.client, e.client.GetMapping().Index(req.Index).Do)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range s.Add {
+			if hasField(mappings, c.Name) {
+				return nil, fmt.Errorf("duplicate column name '%s': Elasticsearch cannot change the type of an existing field", c.Name)
+			}
+		}
+		if e.dryRun {
+			return &Result{DryRun: true}, nil
+		}
+		if _, err := esclient.Call(ctx, e.client, e.client.PutMapping().Index(req.Index).BodyJson(req.Body).Do); err != nil {
+			return nil, err
+		}
+		// 新增的字段可能是 nested 字段，需要重新读取索引结构
+		schemaMu.Lock()
+		delete(schemaCache, req.Index)
+		schemaMu.Unlock()
+	}
+	return &Result{}, nil
+}
+
+// hasField mapping 中是否已有该字段，带点号的字段按 properties 逐层查找
+func hasField(mappings map[string]interface{}, name string) bool {
+	for _, m := range mappings {
+		idx, _ := m.(map[string]interface{})
+		node, _ := idx["mappings"].(map[string]interface{})
+		for _, p := range strings.Split(name, ".") {
+			props, _ := node["properties"].(map[string]interface{})
+			node, _ = props[p].(map[string]interface{})
+			if node == nil {
+				break
+			}
+		}
+		if node != nil {
+			return true
+		}
+	}
+	return false
+}
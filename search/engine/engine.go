@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// Result 查询结果
+type Result struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	Total   int64           `json:"total"`
+	Took    int64           `json:"took"`
+	Explain *Explain        `json:"explain,omitempty"`
+
+	TimedOut bool `json:"timed_out,omitempty"` // 有分片在 ES 端超时
+	Partial  bool `json:"partial,omitempty"`   // 有分片超时或失败，结果不完整
+
+	Affected int64 `json:"affected,omitempty"` // 写语句影响的行数，dry-run 时为将受影响的行数
+	DryRun   bool  `json:"dry_run,omitempty"`
+	Task     *Task `json:"task,omitempty"` // 异步执行的写语句返回任务，通过任务接口查询进度
+}
+
+// Explain EXPLAIN 输出
+type Explain struct {
+	Index  string         `json:"index"`
+	DSL    interface{}    `json:"dsl"`
+	Joins  []*JoinExplain `json:"joins,omitempty"`
+	Filter string         `json:"filter,omitempty"` // 在进程内执行的条件：JOIN 关联后的条件或派生表外层的条件
+	Union  []*Explain     `json:"union,omitempty"`  // UNION 中各个 SELECT 的执行计划
+	Plan   *PlanNode      `json:"plan,omitempty"`   // 执行计划树，标明每个算子下推到 ES 还是在进程内执行
+	Cost   *Cost          `json:"cost,omitempty"`   // 执行前的代价估算
+
+	// INSERT ... SELECT 的执行方式：reindex 使用 _reindex 与 painless 脚本，scroll_bulk 在进程内计算后批量写入
+	Reindex string `json:"reindex,omitempty"`
+}
+
+// JoinExplain EXPLAIN 中的一次 JOIN
+type JoinExplain struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	Table  string `json:"table"`
+	On     string `json:"on"`
+	Where  string `json:"where,omitempty"` // 下推到右表的条件
+
+	// 以下字段只用于关联 ES 索引
+	Build     string `json:"build,omitempty"`      // 哈希关联的构建端：left / right
+	LeftRows  int64  `json:"left_rows,omitempty"`  // 左表命中的文档数
+	RightRows int64  `json:"right_rows,omitempty"` // 右表命中的文档数
+	Keys      int64  `json:"keys,omitempty"`       // 下推的关联键个数，左表为构建端时为估算值
+}
+
+// Engine SQL 执行引擎
+type Engine struct {
+	client *elastic.Client
+	mysql  MysqlProvider
+	limits Limits
+	admin  bool // 允许执行写语句
+	dryRun bool // 写语句只统计受影响的行数，不实际执行
+	async  bool // UPDATE / DELETE 以异步任务执行
+	owner  string
+	notify TaskNotifier
+
+	cost    CostLimits
+	confirm bool          // 已确认执行超过确认阈值的查询
+	timeout time.Duration // 查询的超时时间，为 0 时不限制
+
+	joinTables map[string]bool // 允许 JOIN 的 MySQL 表
+
+	clusters      map[string]bool // 已配置的集群名称
+	clusterClient ClusterProvider
+	cluster       string // 语句访问的集群，为空时使用默认集群
+}
+
+// New 创建执行引擎
+func New(client *elastic.Client, opts ...Option) *Engine {
+	e := &Engine{client: client, limits: DefaultLimits}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Execute 解析并执行一条 SQL
+func (e *Engine) Execute(ctx context.Context, sql string) (*Result, error) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	e, err = e.bindCluster(stmt)
+	if err != nil {
+		return nil, err
+	}
+	switch s := stmt.(type) {
+	case *sqlparser.ExplainStmt:
+		return e.read(ctx, func(ctx context.Context) (*Result, error) { return e.explain(ctx, s.Stmt) })
+	case *sqlparser.SelectStmt:
+		return e.read(ctx, func(ctx context.Context) (*Result, error) { return e.query(ctx, s) })
+	case *sqlparser.UnionStmt:
+		return e.read(ctx, func(ctx context.Context) (*Result, error) { return e.union(ctx, s) })
+	case *sqlparser.InsertStmt, *sqlparser.UpdateStmt, *sqlparser.DeleteStmt:
+		return e.write(ctx, s, sql)
+	case *sqlparser.CreateTableStmt, *sqlparser.AlterTableStmt:
+		return e.ddl(ctx, s)
+	}
+	return nil, fmt.Errorf("unsupported statement")
+}
+
+func (e *Engine) explain(ctx context.Context, stmt sqlparser.Statement) (*Result, error) {
+	if s, ok := stmt.(*sqlparser.InsertStmt); ok && s.Select != nil {
+		req, _, err := e.translateReindex(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		body, err := req.Body()
+		if err != nil {
+			return nil, err
+		}
+		ex := &Explain{Index: req.Dest, DSL: body}
+		if req.Fallback {
+			ex.Reindex = "scroll_bulk"
+		} else {
+			ex.Reindex = "reindex"
+		}
+		return &Result{Explain: ex}, nil
+	}
+	switch stmt.(type) {
+	case *sqlparser.InsertStmt, *sqlparser.UpdateStmt, *sqlparser.DeleteStmt:
+		req, err := e.translateWrite(ctx, stmt)
+		if err != nil {
+			return nil, err
+		}
+		dsl, err := req.DSL()
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Explain: &Explain{Index: req.Index, DSL: dsl}}, nil
+	case *sqlparser.CreateTableStmt, *sqlparser.AlterTableStmt:
+		req, err := e.translateDDL(stmt)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Explain: &Explain{Index: req.Index, DSL: req.Body}}, nil
+	}
+	if u, ok := stmt.(*sqlparser.UnionStmt); ok {
+		ex := &Explain{Plan: &PlanNode{Op: "union", On: onGo}}
+		for _, s := range u.Selects {
+			res, err := e.explain(ctx, s)
+			if err != nil {
+				return nil, err
+			}
+			ex.Union = append(ex.Union, res.Explain)
+			ex.Plan.Input = append(ex.Plan.Input, res.Explain.Plan)
+		}
+		ex.Plan = pipe(ex.Plan, sortNode(u.OrderBy, onGo), limitNode(&sqlparser.SelectStmt{Limit: u.Limit, Offset: u.Offset}, onGo))
+		return &Result{Explain: ex}, nil
+	}
+	sel, ok := stmt.(*sqlparser.SelectStmt)
+	if !ok {
+		return nil, fmt.Errorf("EXPLAIN only supports SELECT")
+	}
+	// IN 子查询需要先执行，才能得到外层查询的 DSL
+	sel, err := e.resolveSubqueries(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	if sel.From != nil && sel.From.Select != nil {
+		res, err := e.explain(ctx, sel.From.Select)
+		if err != nil {
+			return nil, err
+		}
+		if sel.Where != nil {
+			res.Explain.Filter = sel.Where.String()
+		}
+		res.Explain.Plan = pipe(res.Explain.Plan,
+			filterNode(sel.Where, onGo),
+			sortNode(sel.OrderBy, onGo),
+			projectNode(sel, onGo),
+			limitNode(sel, onGo))
+		return res, nil
+	}
+	if len(sel.Joins) > 0 {
+		plan, err := planJoin(sel)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.checkJoinTables(plan); err != nil {
+			return nil, err
+		}
+		if e.client == nil {
+			return nil, fmt.Errorf("elasticsearch client is not initialized")
+		}
+		if err := e.prepareES(ctx, plan, true); err != nil {
+			return nil, err
+		}
+		ex, err := e.explainSelect(ctx, plan.left)
+		if err != nil {
+			return nil, err
+		}
+		ex.Joins, ex.Filter = plan.explain()
+		ex.Plan = plan.tree(ex.Plan)
+		return &Result{Explain: ex}, nil
+	}
+	if sel, err = esStatement(sel); err != nil {
+		return nil, err
+	}
+	ex, err := e.explainSearch(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Explain: ex}, nil
+}
+
+func (e *Engine) explainSelect(ctx context.Context, sel *sqlparser.SelectStmt) (*Explain, error) {
+	schema, err := e.schema(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	req, err := translator.Translate(sel, schema)
+	if err != nil {
+		return nil, err
+	}
+	dsl, err := req.DSL()
+	if err != nil {
+		return nil, err
+	}
+	detail := req.Index
+	if sel.Where != nil {
+		detail += " WHERE " + sel.Where.String()
+	}
+	cost, err := e.estimateCost(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &Explain{Index: req.Index, DSL: dsl, Plan: &PlanNode{Op: "search", On: onES, Detail: detail}, Cost: cost}, nil
+}
+
+func (e *Engine) query(ctx context.Context, stmt *sqlparser.SelectStmt) (*Result, error) {
+	stmt, err := e.resolveSubqueries(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.From != nil && stmt.From.Select != nil {
+		return e.derived(ctx, stmt)
+	}
+	if len(stmt.Joins) > 0 {
+		return e.join(ctx, stmt)
+	}
+	if stmt, err = esStatement(stmt); err != nil {
+		return nil, err
+	}
+	if e.client == nil {
+		return nil, fmt.Errorf("elasticsearch client is not initialized")
+	}
+	return e.search(ctx, stmt)
+}
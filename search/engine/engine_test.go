@@ -0,0 +1,1048 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	testcommon "lium-product/es-search/tests/common_test"
+)
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestExecuteFullText(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/docs/_mapping", json.RawMessage(`{"docs":{"mappings":{}}}`))
+	mockServer.Register("/docs/_search", []*elastic.SearchHit{
+		{
+			Id:        "1",
+			Score:     floatPtr(2.5),
+			Source:    []byte(`{"title":"foo bar","author":{"name":"tom"}}`),
+			Highlight: elastic.SearchHitHighlight{"title": {"<em>foo</em> bar"}},
+		},
+		{
+			Id:     "2",
+			Score:  floatPtr(1.2),
+			Source: []byte(`{"title":"foo","author":{"name":"amy"}}`),
+		},
+	})
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT _id, _score, title, author.name, HIGHLIGHT(title) AS hl FROM docs WHERE MATCH(title, 'foo') ORDER BY _score DESC")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"_id", "_score", "title", "author.name", "hl"}, res.Columns)
+	assert.Equal(t, int64(2), res.Total)
+	assert.Equal(t, []interface{}{"1", 2.5, "foo bar", "tom", []string{"<em>foo</em> bar"}}, res.Rows[0])
+	assert.Equal(t, []interface{}{"2", 1.2, "foo", "amy", nil}, res.Rows[1])
+}
+
+func TestExecuteAggregate(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/orders/_search", json.RawMessage(`{
+		"took": 3,
+		"hits": {"total": {"value": 60, "relation": "eq"}, "hits": []},
+		"aggregations": {"group_0": {"buckets": [
+			{"key": "beijing", "doc_count": 30, "agg_1": {"value": 300}},
+			{"key": "shanghai", "doc_count": 20, "agg_1": {"value": 500}},
+			{"key": "shenzhen", "doc_count": 10, "agg_1": {"value": 50}}
+		]}}
+	}`))
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT city, COUNT(*) AS cnt, SUM(amount) FROM orders GROUP BY city HAVING cnt > 10 ORDER BY SUM(amount) DESC")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"city", "cnt", "SUM(amount)"}, res.Columns)
+	assert.Equal(t, [][]interface{}{
+		{"shanghai", int64(20), 500.0},
+		{"beijing", int64(30), 300.0},
+	}, res.Rows)
+}
+
+func TestExplain(t *testing.T) {
+	e := New(nil)
+	res, err := e.Execute(context.Background(), "EXPLAIN SELECT title FROM docs WHERE MATCH(title, 'foo') LIMIT 1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "docs", res.Explain.Index)
+	b, _ := json.Marshal(res.Explain.DSL)
+	assert.JSONEq(t, `{"_source":{"includes":["title"]},"from":0,"size":1,
+		"query":{"bool":{"must":{"match":{"title":{"query":"foo"}}}}}}`, string(b))
+}
+
+func TestExecuteNestedAggregate(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/shop_orders/_mapping", json.RawMessage(`{
+		"shop_orders": {"mappings": {"properties": {
+			"user_id": {"type": "keyword"},
+			"items": {"type": "nested", "properties": {"sku": {"type": "keyword"}, "qty": {"type": "long"}}}
+		}}}
+	}`))
+	mockServer.Register("/shop_orders/_search", json.RawMessage(`{
+		"took": 2,
+		"hits": {"total": {"value": 5, "relation": "eq"}, "hits": []},
+		"aggregations": {"group_0_nested": {"doc_count": 9, "group_0": {"buckets": [
+			{"key": "A", "doc_count": 4, "agg_0": {"value": 12}, "agg_1_reverse": {"doc_count": 3, "agg_1": {"value": 3}}},
+			{"key": "B", "doc_count": 5, "agg_0": {"value": 7}, "agg_1_reverse": {"doc_count": 2, "agg_1": {"value": 2}}}
+		]}}}
+	}`))
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT items.sku, SUM(items.qty) AS qty, COUNT(DISTINCT user_id) AS users FROM shop_orders GROUP BY items.sku")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"items.sku", "qty", "users"}, res.Columns)
+	assert.Equal(t, [][]interface{}{
+		{"A", 12.0, int64(3)},
+		{"B", 7.0, int64(2)},
+	}, res.Rows)
+}
+
+func TestSchemaError(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/secret/_mapping", &elastic.Error{Status: http.StatusForbidden,
+		Details: &elastic.ErrorDetails{Type: "security_exception", Reason: "action is unauthorized"}})
+	mockServer.Register("/secret/_search", []*elastic.SearchHit{{Id: "1", Source: []byte(`{"msg":"hi"}`)}})
+
+	// 引用带点号的字段时必须读取 mapping，读取失败时报错而不是按普通字段翻译
+	e := New(testcommon.GetElasticClient())
+	_, err := e.Execute(context.Background(), "SELECT msg FROM secret WHERE user.name = 'tom'")
+	var esErr *elastic.Error
+	if assert.ErrorAs(t, err, &esErr) {
+		assert.Equal(t, http.StatusForbidden, esErr.Status)
+		assert.Contains(t, err.Error(), "read mapping of secret failed")
+	}
+
+	// 没有带点号的字段时不读取 mapping
+	res, err := e.Execute(context.Background(), "SELECT msg FROM secret")
+	if assert.NoError(t, err) {
+		assert.Equal(t, [][]interface{}{{"hi"}}, res.Rows)
+	}
+}
+
+func TestExecuteMetrics(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/perf/_mapping", json.RawMessage(`{"perf":{"mappings":{}}}`))
+	mockServer.Register("/perf/_search", json.RawMessage(`{
+		"took": 4,
+		"hits": {"total": {"value": 100, "relation": "eq"}, "hits": []},
+		"aggregations": {
+			"agg_0": {"values": {"95.0": 830.5}},
+			"agg_1": {"values": {"50.0": 120, "99.9": null}},
+			"agg_2": {"count": 100, "min": 12, "max": 2300, "avg": 210.5, "sum": 21050},
+			"agg_3": {"value": 1704067200000, "value_as_string": "2024-01-01T00:00:00.000Z"},
+			"agg_4": {"hits": {"total": {"value": 100, "relation": "eq"}, "hits": [
+				{"_index": "perf", "_id": "9", "_source": {"page": {"url": "/home"}}, "sort": [1704153600000]}
+			]}}
+		}
+	}`))
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT PERCENTILE(latency, 95), PERCENTILES(latency, 50, 99.9), STATS(latency), MIN(ts), LAST(page.url ORDER BY ts) FROM perf")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, [][]interface{}{{
+		830.5,
+		map[string]interface{}{"50": 120.0, "99.9": nil},
+		map[string]interface{}{"count": int64(100), "min": int64(12), "max": int64(2300), "avg": 210.5, "sum": int64(21050)},
+		"2024-01-01T00:00:00.000Z",
+		"/home",
+	}}, res.Rows)
+}
+
+func TestExecuteWindow(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/stats/_search", json.RawMessage(`{
+		"took": 5,
+		"hits": {"total": {"value": 30, "relation": "eq"}, "hits": []},
+		"aggregations": {"group_0": {"buckets": [
+			{"key_as_string": "2024-01-01", "key": 1704067200000, "doc_count": 10, "agg_0": {"value": 100}, "agg_1": {"value": 100}},
+			{"key_as_string": "2024-01-02", "key": 1704153600000, "doc_count": 8, "agg_0": {"value": 80}, "agg_1": {"value": 180}, "agg_2": {"value": -20}},
+			{"key_as_string": "2024-01-03", "key": 1704240000000, "doc_count": 12, "agg_0": {"value": 150}, "agg_1": {"value": 330}, "agg_2": {"value": 70}}
+		]}}
+	}`))
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT DATE_HISTOGRAM(ts, '1d') AS day, SUM(pv) AS pv, CUMULATIVE_SUM(SUM(pv)) OVER (ORDER BY day) AS total, "+
+			"DERIVATIVE(SUM(pv)) OVER (ORDER BY day) AS diff FROM stats GROUP BY day ORDER BY day DESC LIMIT 2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"day", "pv", "total", "diff"}, res.Columns)
+	assert.Equal(t, [][]interface{}{
+		{"2024-01-03", 150.0, 330.0, 70.0},
+		{"2024-01-02", 80.0, 180.0, -20.0},
+	}, res.Rows)
+}
+
+func TestExecuteScalar(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/users/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"name":"tom","age":null}`), Fields: map[string]interface{}{"expr_1": []interface{}{"TOM"}}},
+		{Id: "2", Source: []byte(`{"name":"amélie"}`), Fields: map[string]interface{}{"expr_1": []interface{}{"AMÉLIE"}}},
+	})
+	mockServer.Register("/orders/_search", json.RawMessage(`{
+		"took": 2,
+		"hits": {"total": {"value": 3, "relation": "eq"}, "hits": []},
+		"aggregations": {"group_0": {"buckets": [
+			{"key": "beijing", "doc_count": 2, "agg_0": {"value": 1696118400000, "value_as_string": "2023-10-01T00:00:00.000Z"}, "agg_1": {"value": 12.345}},
+			{"key": "shanghai", "doc_count": 1, "agg_0": {"value": null}, "agg_1": {"value": 8}}
+		]}}
+	}`))
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT name, UPPER(name) AS up, CONCAT(name, ':', LENGTH(name)) AS n, COALESCE(age, LENGTH(name)) AS age FROM users")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"name", "up", "n", "age"}, res.Columns)
+	assert.Equal(t, [][]interface{}{
+		{"tom", "TOM", "tom:3", int64(3)},
+		{"amélie", "AMÉLIE", "amélie:7", int64(7)},
+	}, res.Rows)
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(mockServer.LastRequest().Body, &body))
+	assert.Equal(t, map[string]interface{}{"includes": []interface{}{"name", "age"}}, body["_source"])
+	assert.Contains(t, body["script_fields"], "expr_1")
+
+	res, err = e.Execute(context.Background(),
+		"SELECT city, DATE_FORMAT(MAX(ts), '%Y/%m/%d') AS last, ROUND(AVG(price), 1) AS p, "+
+			"CASE WHEN COUNT(*) > 1 THEN 'many' ELSE 'one' END AS n FROM orders GROUP BY city ORDER BY p")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"city", "last", "p", "n"}, res.Columns)
+	assert.Equal(t, [][]interface{}{
+		{"shanghai", nil, int64(8), "one"},
+		{"beijing", "2023/10/01", 12.3, "many"},
+	}, res.Rows)
+}
+
+func TestExecutePlan(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/users/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"name":"tom","age":30}`)},
+		{Id: "2", Source: []byte(`{"name":"jo","age":20}`)},
+		{Id: "3", Source: []byte(`{"name":"amélie","age":25}`)},
+		{Id: "4", Source: []byte(`{"name":"bob","age":40}`)},
+	})
+
+	// LENGTH 只能在进程内计算：条件与排序在 ES 返回的行上执行，额外读取的 name 不输出
+	e := New(testcommon.GetElasticClient())
+	sql := "SELECT age FROM users WHERE age > 18 AND LENGTH(name) > 2 ORDER BY LENGTH(name) DESC, age LIMIT 2"
+	res, err := e.Execute(context.Background(), sql)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"age"}, res.Columns)
+	assert.Equal(t, [][]interface{}{{int64(25)}, {int64(30)}}, res.Rows)
+	assert.Equal(t, int64(3), res.Total)
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(mockServer.LastRequest().Body, &body))
+	assert.Equal(t, map[string]interface{}{"includes": []interface{}{"age", "name"}}, body["_source"])
+	assert.Equal(t, float64(DefaultLimits.MaxSubqueryRows), body["size"])
+	assert.Nil(t, body["sort"])
+
+	res, err = e.Execute(context.Background(), "EXPLAIN "+sql)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "LENGTH(name) > 2", res.Explain.Filter)
+	b, _ := json.Marshal(res.Explain.Plan)
+	assert.JSONEq(t, `{"op":"project","on":"es","detail":"age","input":[
+		{"op":"limit","on":"go","detail":"limit 2 offset 0","input":[
+		{"op":"sort","on":"go","detail":"LENGTH(name) DESC, age","input":[
+		{"op":"filter","on":"go","detail":"LENGTH(name) > 2","input":[
+		{"op":"search","on":"es","detail":"users WHERE age > 18 (up to 10000 rows)"}]}]}]}]}`, string(b))
+
+	_, err = New(testcommon.GetElasticClient(), WithLimits(Limits{MaxSubqueryRows: 3})).Execute(context.Background(), sql)
+	assert.EqualError(t, err, "query needs more than 3 rows to be filtered or sorted in memory, "+
+		"add a more selective WHERE or raise query.max-subquery-rows: "+
+		"SELECT age FROM users WHERE (age > 18) AND (LENGTH(name) > 2) ORDER BY LENGTH(name) DESC, age LIMIT 2")
+
+	_, err = e.Execute(context.Background(), "SELECT COUNT(*) FROM users WHERE LENGTH(name) > 2")
+	assert.EqualError(t, err, "condition cannot be pushed down to elasticsearch in an aggregate query: LENGTH(name) > 2")
+}
+
+func TestCostGuardrails(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/_cat/indices/logs-", json.RawMessage(`[{"index":"logs-1"},{"index":"logs-2"},{"index":"logs-3"}]`))
+	mockServer.Register("/logs-\\*/_search", []*elastic.SearchHit{{Id: "1", Source: []byte(`{"msg":"ok"}`)}})
+
+	limits := CostLimits{
+		Confirm: CostThresholds{MaxIndices: 2, MaxTimeRange: 24 * 7},
+		Reject:  CostThresholds{MaxAggDepth: 1, MaxScripts: 1},
+	}
+	e := New(testcommon.GetElasticClient(), WithCostLimits(limits))
+	sql := "SELECT msg FROM logs-* WHERE ts >= '2024-01-01' AND ts < '2024-01-03'"
+	_, err := e.Execute(context.Background(), sql)
+	assert.ErrorIs(t, err, ErrConfirmRequired)
+	assert.EqualError(t, err, "query cost requires confirmation: indices 3 > 2, resend with confirm to run it")
+
+	res, err := New(testcommon.GetElasticClient(), WithCostLimits(limits), WithConfirm(true)).Execute(context.Background(), sql)
+	if assert.NoError(t, err) {
+		assert.Equal(t, [][]interface{}{{"ok"}}, res.Rows)
+	}
+
+	res, err = e.Execute(context.Background(), "EXPLAIN "+sql)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Cost{Indices: 3, TimeRange: 48, Decision: "confirm", Reasons: []string{"indices 3 > 2"}}, res.Explain.Cost)
+	}
+
+	// 未限制时间范围与两层 terms 聚合
+	res, err = e.Execute(context.Background(), "EXPLAIN SELECT host, status, COUNT(*) FROM logs-* WHERE LOWER(host) = 'a' GROUP BY host, status LIMIT 50")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Cost{Indices: 3, TimeRange: -1, TermsSize: 1000000, AggDepth: 2, Scripts: 1, Decision: "reject",
+			Reasons: []string{"aggregation depth 2 > 1"}}, res.Explain.Cost)
+	}
+	_, err = e.Execute(context.Background(), "SELECT host, status, COUNT(*) FROM logs-* GROUP BY host, status")
+	assert.ErrorIs(t, err, ErrCostExceeded)
+	assert.EqualError(t, err, "query cost exceeds the limit: aggregation depth 2 > 1")
+}
+
+func TestQueryTimeout(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/logs/_search", json.RawMessage(`{
+		"took": 5, "timed_out": true,
+		"_shards": {"total": 3, "successful": 3, "skipped": 0, "failed": 0},
+		"hits": {"total": {"value": 1, "relation": "eq"}, "hits": [{"_id": "1", "_source": {"msg": "a"}}]}
+	}`))
+	mockServer.RegisterHandler("/slow/_search", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	res, err := New(testcommon.GetElasticClient(), WithTimeout(time.Second)).Execute(context.Background(), "SELECT msg FROM logs")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, [][]interface{}{{"a"}}, res.Rows)
+	assert.True(t, res.TimedOut)
+	assert.True(t, res.Partial)
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(mockServer.LastRequest().Body, &body))
+	assert.Regexp(t, `^\d+ms$`, body["timeout"])
+
+	_, err = New(testcommon.GetElasticClient(), WithTimeout(50*time.Millisecond)).Execute(context.Background(), "SELECT msg FROM slow")
+	assert.ErrorIs(t, err, ErrQueryTimeout)
+
+	// 客户端断开连接时取消查询
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = New(testcommon.GetElasticClient()).Execute(ctx, "SELECT msg FROM slow")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestExecuteCluster(t *testing.T) {
+	hot := testcommon.NewMockServer()
+	defer hot.Close()
+	archive := testcommon.NewMockServer()
+	defer archive.Close()
+
+	hot.Register("/logs/_search", []*elastic.SearchHit{{Id: "1", Source: []byte(`{"msg":"hot"}`)}})
+	archive.Register("/logs/_search", []*elastic.SearchHit{{Id: "1", Source: []byte(`{"msg":"archive"}`)}})
+	archiveClient := archive.NewElasticClient()
+	clusters := WithClusters([]string{"archive", "cold"}, func(name string) (*elastic.Client, error) {
+		return archiveClient, nil
+	})
+
+	tests := []struct {
+		name string
+		opts []Option
+		sql  string
+		want interface{}
+		err  string
+	}{
+		{name: "default cluster", sql: "SELECT msg FROM logs", want: "hot"},
+		{name: "cluster prefix", sql: "SELECT msg FROM archive.logs", want: "archive"},
+		{name: "request cluster", opts: []Option{WithCluster("archive")}, sql: "SELECT msg FROM logs", want: "archive"},
+		{name: "unknown cluster", opts: []Option{WithCluster("warm")}, sql: "SELECT msg FROM logs", err: "unknown cluster: warm"},
+		{name: "conflicting clusters", sql: "SELECT msg FROM archive.logs UNION ALL SELECT msg FROM cold.logs",
+			err: "statement uses clusters archive and cold, only one cluster per statement is supported"},
+		{name: "conflicting request cluster", opts: []Option{WithCluster("cold")}, sql: "SELECT msg FROM archive.logs",
+			err: "statement uses clusters cold and archive, only one cluster per statement is supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New(hot.NewElasticClient(), append([]Option{clusters}, tt.opts...)...)
+			res, err := e.Execute(context.Background(), tt.sql)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, [][]interface{}{{tt.want}}, res.Rows)
+			}
+		})
+	}
+}
+
+func TestBackendScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		open     string // 打开 PIT 的请求
+		close    string // 关闭 PIT 的请求与请求体
+		closeReq string
+	}{
+		{name: "elasticsearch", version: `{"version":{"number":"8.11.1"}}`,
+			open: "POST /logs/_pit keep_alive=5m", close: "DELETE /_pit", closeReq: `{"id":"pit-2"}`},
+		{name: "opensearch", version: `{"version":{"distribution":"opensearch","number":"2.11.0"}}`,
+			open: "POST /logs/_search/point_in_time keep_alive=5m", close: "DELETE /_search/point_in_time", closeReq: `{"pit_id":["pit-2"]}`},
+		{name: "scroll", version: `{"version":{"number":"7.9.3"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := testcommon.NewMockServer()
+			defer mockServer.Close()
+			mockServer.Register("^/$", json.RawMessage(tt.version))
+			mockServer.RegisterHandler("(_pit|point_in_time)$", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"id":"pit-1","pit_id":"pit-1","succeeded":true}`))
+			})
+			pages := 0
+			mockServer.RegisterHandler("^/_search$", func(w http.ResponseWriter, r *http.Request) {
+				pages++
+				if pages > 1 {
+					_, _ = w.Write([]byte(`{"pit_id":"pit-2","hits":{"total":{"value":2},"hits":[]}}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"pit_id":"pit-2","hits":{"total":{"value":2},"hits":[
+					{"_id":"1","_source":{},"sort":[3]},{"_id":"2","_source":{},"sort":[7]}]}}`))
+			})
+			mockServer.Register("/logs/_search$", []*elastic.SearchHit{{Id: "1", Source: []byte(`{}`)}, {Id: "2", Source: []byte(`{}`)}})
+			mockServer.RegisterEmptyScrollHandler()
+
+			e := New(testcommon.GetElasticClient())
+			var ids []string
+			err := e.scanAll(context.Background(), "logs", elastic.NewSearchSource(), 2, func(hits []*elastic.SearchHit) (bool, error) {
+				for _, h := range hits {
+					ids = append(ids, h.Id)
+				}
+				return true, nil
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, []string{"1", "2"}, ids)
+
+			var paths []string
+			var bodies []string
+			for _, r := range mockServer.Requests() {
+				if r.Path == "/" {
+					continue
+				}
+				paths = append(paths, r.Method+" "+r.Path+" "+r.Query)
+				bodies = append(bodies, string(r.Body))
+			}
+			if tt.open == "" {
+				assert.Equal(t, "POST /logs/_search scroll=5m", paths[0])
+				return
+			}
+			if assert.Len(t, paths, 4) {
+				assert.Equal(t, tt.open, paths[0])
+				assert.JSONEq(t, `{"pit":{"id":"pit-1","keep_alive":"5m"},"from":0,"size":2,"sort":[{"_doc":{"order":"asc"}}]}`, bodies[1])
+				assert.JSONEq(t, `{"pit":{"id":"pit-2","keep_alive":"5m"},"from":0,"size":2,"sort":[{"_doc":{"order":"asc"}}],"search_after":[7]}`, bodies[2])
+				assert.Equal(t, tt.close+" ", paths[3])
+				assert.JSONEq(t, tt.closeReq, bodies[3])
+			}
+		})
+	}
+}
+
+func TestExecuteJoin(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+	md := testcommon.InitSqlMock()
+	defer md.Close()
+
+	mockServer.Register("/events/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"page":10,"uid":1,"ts":3}`)},
+		{Id: "2", Source: []byte(`{"page":11,"uid":2,"ts":2}`)},
+		{Id: "3", Source: []byte(`{"page":12,"uid":1,"ts":1}`)},
+	})
+	md.Mock.ExpectQuery("SELECT `status`, `id`, `title` FROM `pages` WHERE `id` IN \\(\\?,\\?,\\?\\) AND \\(`status` = \\?\\)").
+		WithArgs(int64(10), int64(11), int64(12), int64(1)).
+		WillReturnRows(md.NewRows([]string{"status", "id", "title"}).
+			AddRow(1, 10, "home").
+			AddRow(1, 11, "about"))
+	md.Mock.ExpectQuery("SELECT `id`, `name` FROM `users` WHERE `id` IN \\(\\?,\\?\\)").
+		WithArgs(int64(1), int64(2)).
+		WillReturnRows(md.NewRows([]string{"id", "name"}).AddRow(1, "tom"))
+
+	e := New(testcommon.GetElasticClient(), WithMysql(func() (*gorm.DB, error) { return md.MockGorm, nil }),
+		WithOwner("ops"), WithJoinTables([]string{"pages", "users"}))
+	res, err := e.Execute(context.Background(),
+		"SELECT e.page, p.title, u.name FROM es.events e JOIN mysql.pages p ON p.id = e.page "+
+			"LEFT JOIN mysql.users u ON u.id = e.uid WHERE p.status = 1 ORDER BY e.ts DESC LIMIT 10")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, md.ExpectationsWereMet())
+	assert.Equal(t, []string{"e.page", "p.title", "u.name"}, res.Columns)
+	assert.Equal(t, int64(2), res.Total)
+	assert.Equal(t, [][]interface{}{{int64(10), "home", "tom"}, {int64(11), "about", nil}}, res.Rows)
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(mockServer.LastRequest().Body, &body))
+	assert.Equal(t, []interface{}{map[string]interface{}{"ts": map[string]interface{}{"order": "desc"}}}, body["sort"])
+}
+
+func TestJoinRowLimit(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+	md := testcommon.InitSqlMock()
+	defer md.Close()
+
+	// 共 4 个文档，按 from / size 分页返回
+	mockServer.RegisterHandler("/events/_search", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ From, Size int }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		res := elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: &elastic.TotalHits{Value: 4, Relation: "eq"}}}
+		for i := body.From; i < 4 && i < body.From+body.Size; i++ {
+			res.Hits.Hits = append(res.Hits.Hits, &elastic.SearchHit{Id: fmt.Sprint(i), Source: []byte(fmt.Sprintf(`{"page":%d}`, i))})
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	sql := "SELECT e.page, p.title FROM events e LEFT JOIN mysql.pages p ON p.id = e.page"
+	run := func(maxRows int) (*Result, error) {
+		for i := 0; i < 2; i++ {
+			md.Mock.ExpectQuery("SELECT `id`, `title` FROM `pages`").WillReturnRows(md.NewRows([]string{"id", "title"}))
+		}
+		return New(testcommon.GetElasticClient(), WithMysql(func() (*gorm.DB, error) { return md.MockGorm, nil }),
+			WithOwner("ops"), WithJoinTables([]string{"pages"}),
+			WithLimits(Limits{MaxJoinRows: maxRows, JoinBatchSize: 2})).Execute(context.Background(), sql)
+	}
+
+	// 命中数恰好等于限制，最后一页是满页
+	res, err := run(4)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(4), res.Total)
+	}
+	assert.NoError(t, md.ExpectationsWereMet())
+
+	_, err = run(3)
+	assert.EqualError(t, err, "JOIN scanned more than 3 rows of events, add a more selective WHERE or LIMIT")
+	assert.NoError(t, md.ExpectationsWereMet())
+}
+
+func TestJoinError(t *testing.T) {
+	e := New(nil)
+	for sql, msg := range map[string]string{
+		"SELECT * FROM mysql.pages":                                         "right side of a JOIN",
+		"SELECT e.page FROM events e JOIN mysql.pages p ON p.id > e.page":   "unsupported ON condition",
+		"SELECT COUNT(*) FROM events e JOIN mysql.pages p ON p.id = e.page": "aggregate functions",
+		"SELECT e.page FROM events e JOIN mysql.pages e ON e.id = e.page":   "duplicate table alias",
+	} {
+		_, err := e.Execute(context.Background(), sql)
+		if assert.Error(t, err, sql) {
+			assert.Contains(t, err.Error(), msg, sql)
+		}
+	}
+}
+
+func TestJoinTables(t *testing.T) {
+	sql := "SELECT e.page FROM events e JOIN %s p ON p.id = e.page"
+	for _, c := range []struct {
+		engine *Engine
+		table  string
+		msg    string
+	}{
+		{New(nil, WithJoinTables([]string{"pages"})), "mysql.pages", "requires an authenticated identity"},
+		{New(nil, WithOwner("ops")), "mysql.pages", "not allowed to be joined"},
+		{New(nil, WithOwner("ops"), WithJoinTables([]string{"pages"})), "mysql.users", "not allowed to be joined"},
+		{New(nil, WithOwner("ops"), WithJoinTables([]string{"pages"})), "mysql.mysql.user", "not allowed to be joined"},
+	} {
+		for _, prefix := range []string{"", "EXPLAIN "} {
+			_, err := c.engine.Execute(context.Background(), prefix+fmt.Sprintf(sql, c.table))
+			if assert.ErrorIs(t, err, ErrPermissionDenied, c.table) {
+				assert.Contains(t, err.Error(), c.msg, c.table)
+			}
+		}
+	}
+
+	// 允许列表中的 database.table 可以关联
+	_, err := New(nil, WithOwner("ops"), WithJoinTables([]string{"report.pages"})).
+		Execute(context.Background(), fmt.Sprintf(sql, "mysql.report.pages"))
+	assert.EqualError(t, err, "elasticsearch client is not initialized")
+}
+
+func TestExecuteESJoin(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/events/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"page":"home","uid":1}`)},
+		{Id: "2", Source: []byte(`{"page":"about","uid":2}`)},
+		{Id: "3", Source: []byte(`{"page":"faq","uid":3}`)},
+	})
+	mockServer.Register("/users/_search", []*elastic.SearchHit{
+		{Id: "u1", Source: []byte(`{"id":1,"name":"tom"}`)},
+		{Id: "u3", Source: []byte(`{"id":3,"name":"amy"}`)},
+	})
+
+	e := New(testcommon.GetElasticClient())
+	sql := "SELECT e.page, u.name FROM events e JOIN es.users u ON u.id = e.uid WHERE u.vip = true"
+	res, err := e.Execute(context.Background(), sql)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"e.page", "u.name"}, res.Columns)
+	assert.Equal(t, [][]interface{}{{"home", "tom"}, {"faq", "amy"}}, res.Rows)
+
+	// 右表较小，作为构建端，关联键以 terms 下推到左表
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(mockServer.LastRequest().Body, &body))
+	assert.Equal(t, map[string]interface{}{"bool": map[string]interface{}{"filter": map[string]interface{}{
+		"terms": map[string]interface{}{"uid": []interface{}{1.0, 3.0}}}}}, body["query"])
+
+	res, err = e.Execute(context.Background(), "EXPLAIN "+sql)
+	if !assert.NoError(t, err) {
+		return
+	}
+	join := res.Explain.Joins[0]
+	assert.Equal(t, BuildRight, join.Build)
+	assert.Equal(t, int64(2), join.Keys)
+	assert.Equal(t, int64(3), join.LeftRows)
+	assert.Equal(t, int64(2), join.RightRows)
+	assert.Equal(t, "u.vip = TRUE", join.Where)
+}
+
+func TestExecuteSubquery(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/orders/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"user_id":1}`)},
+		{Id: "2", Source: []byte(`{"user_id":2}`)},
+		{Id: "3", Source: []byte(`{"user_id":1}`)},
+	})
+	mockServer.Register("/users/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"user_id":1,"name":"tom"}`)},
+	})
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT name FROM users WHERE user_id IN (SELECT user_id FROM orders WHERE amount > 100)")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, [][]interface{}{{"tom"}}, res.Rows)
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(mockServer.LastRequest().Body, &body))
+	assert.Equal(t, map[string]interface{}{"bool": map[string]interface{}{"filter": map[string]interface{}{
+		"terms": map[string]interface{}{"user_id": []interface{}{1.0, 2.0}}}}}, body["query"])
+
+	e = New(testcommon.GetElasticClient(), WithLimits(Limits{MaxSubqueryRows: 2}))
+	_, err = e.Execute(context.Background(), "SELECT name FROM users WHERE user_id IN (SELECT user_id FROM orders)")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "subquery returns more than 2 rows")
+	}
+}
+
+func TestExecuteDerivedTable(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/orders/_search", json.RawMessage(`{
+		"took": 2,
+		"hits": {"total": {"value": 60, "relation": "eq"}, "hits": []},
+		"aggregations": {"group_0": {"buckets": [
+			{"key": "beijing", "doc_count": 30},
+			{"key": "shanghai", "doc_count": 20},
+			{"key": "shenzhen", "doc_count": 5}
+		]}}
+	}`))
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT t.city, t.cnt * 2 AS double FROM (SELECT city, COUNT(*) AS cnt FROM orders GROUP BY city) t "+
+			"WHERE t.cnt > 10 ORDER BY double LIMIT 5")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"t.city", "double"}, res.Columns)
+	assert.Equal(t, int64(2), res.Total)
+	assert.Equal(t, [][]interface{}{{"shanghai", int64(40)}, {"beijing", int64(60)}}, res.Rows)
+}
+
+func TestExecuteUnion(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/metrics-a/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"host":"a1","cpu":50}`)},
+		{Id: "2", Source: []byte(`{"host":"a2","cpu":70}`)},
+	})
+	mockServer.Register("/metrics-b/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"node":"b1","load":"high"}`)},
+		{Id: "2", Source: []byte(`{"node":"a2","load":70.5}`)},
+		{Id: "3", Source: []byte(`{"node":"a2","load":70.5}`)},
+	})
+
+	e := New(testcommon.GetElasticClient())
+	res, err := e.Execute(context.Background(),
+		"SELECT host, cpu FROM metrics-a UNION ALL SELECT node, load FROM metrics-b ORDER BY 1 DESC, cpu LIMIT 4")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"host", "cpu"}, res.Columns)
+	assert.Equal(t, int64(5), res.Total)
+	// 数值与字符串混合的列统一转为字符串
+	assert.Equal(t, [][]interface{}{{"b1", "high"}, {"a2", "70"}, {"a2", "70.5"}, {"a2", "70.5"}}, res.Rows)
+
+	res, err = e.Execute(context.Background(), "SELECT node FROM metrics-b UNION SELECT host FROM metrics-a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, [][]interface{}{{"b1"}, {"a2"}, {"a1"}}, res.Rows)
+	}
+
+	_, err = e.Execute(context.Background(), "SELECT host, cpu FROM metrics-a UNION SELECT node FROM metrics-b")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "different number of columns")
+	}
+}
+
+func TestExecuteWrite(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.Register("/logs/_mapping", json.RawMessage(`{"logs":{"mappings":{"properties":{"level":{"type":"keyword"}}}}}`))
+	mockServer.Register("/logs/_count", json.RawMessage(`{"count":7}`))
+	mockServer.Register("/logs/_update_by_query", json.RawMessage(`{"took":5,"total":3,"updated":3,"failures":[]}`))
+	mockServer.Register("/logs/_delete_by_query", json.RawMessage(`{"took":4,"total":2,"deleted":2,"failures":[]}`))
+	mockServer.Register("/_bulk", json.RawMessage(`{"took":2,"errors":false,"items":[
+		{"index":{"_index":"logs","_id":"1","status":201,"result":"created"}},
+		{"index":{"_index":"logs","_id":"2","status":201,"result":"created"}}
+	]}`))
+
+	ctx := context.Background()
+	_, err := New(testcommon.GetElasticClient()).Execute(ctx, "DELETE FROM logs WHERE level = 'debug'")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	e := New(testcommon.GetElasticClient(), WithAdmin(true))
+	_, err = e.Execute(ctx, "UPDATE logs SET level = 'warn'")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "UPDATE requires a WHERE clause")
+	}
+
+	res, err := e.Execute(ctx, "UPDATE logs SET level = UPPER(level), hits = hits + 1 WHERE level = 'info'")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3), res.Affected)
+		assert.JSONEq(t, `{
+			"query":{"bool":{"filter":{"term":{"level":"info"}}}},
+			"script":{"lang":"painless","params":{"p0":1},
+				"source":"ctx._source['level'] = ctx._source['level'].toUpperCase(); ctx._source['hits'] = (ctx._source['hits'] + params.p0);"}
+		}`, string(mockServer.LastRequest().Body))
+	}
+
+	res, err = e.Execute(ctx, "DELETE FROM logs WHERE level = 'debug'")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), res.Affected)
+		assert.Equal(t, "/logs/_delete_by_query", mockServer.LastRequest().Path)
+	}
+
+	res, err = e.Execute(ctx, "INSERT INTO logs (_id, level, user.name) VALUES ('1', 'info', 'tom'), ('2', 'warn', 'amy')")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), res.Affected)
+		assert.Equal(t, `{"index":{"_index":"logs","_id":"1"}}
+{"level":"info","user":{"name":"tom"}}
+{"index":{"_index":"logs","_id":"2"}}
+{"level":"warn","user":{"name":"amy"}}
+`, string(mockServer.LastRequest().Body))
+	}
+
+	dry := New(testcommon.GetElasticClient(), WithAdmin(true), WithDryRun(true))
+	res, err = dry.Execute(ctx, "DELETE FROM logs WHERE level = 'debug'")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Result{Affected: 7, DryRun: true}, res)
+		assert.Equal(t, "/logs/_count", mockServer.LastRequest().Path)
+	}
+}
+
+func TestAsyncTask(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+	md := testcommon.InitSqlMock()
+	defer md.Close()
+
+	mockServer.Register("/logs/_mapping", json.RawMessage(`{"logs":{"mappings":{}}}`))
+	mockServer.Register("/logs/_delete_by_query", json.RawMessage(`{"task":"node1:42"}`))
+	mockServer.Register("/_tasks/node1:42", json.RawMessage(`{"completed":true,
+		"task":{"status":{"total":5,"deleted":5},"cancelled":false},
+		"response":{"deleted":5,"failures":[]}}`))
+
+	md.Mock.ExpectBegin()
+	md.Mock.ExpectExec("INSERT INTO `es_search_tasks`").
+		WithArgs("node1:42", "ops", "delete", "logs", "", "DELETE FROM logs WHERE level = 'debug'", TaskRunning,
+			int64(0), int64(0), "", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	md.Mock.ExpectCommit()
+	md.Mock.ExpectQuery("SELECT \\* FROM `es_search_tasks` WHERE id = \\? LIMIT \\?").
+		WithArgs("node1:42", 1).
+		WillReturnRows(md.NewRows([]string{"id", "owner", "kind", "index_name", "status"}).
+			AddRow("node1:42", "ops", "delete", "logs", TaskRunning))
+	md.Mock.ExpectBegin()
+	md.Mock.ExpectExec("UPDATE `es_search_tasks` SET `affected`=\\?,`error`=\\?,`finished_at`=\\?,`status`=\\?,`total`=\\?,`updated_at`=\\? WHERE id = \\? AND status = \\?").
+		WithArgs(int64(5), "", sqlmock.AnyArg(), TaskCompleted, int64(5), sqlmock.AnyArg(), "node1:42", TaskRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	md.Mock.ExpectCommit()
+
+	var notified []*Task
+	e := New(testcommon.GetElasticClient(),
+		WithMysql(func() (*gorm.DB, error) { return md.MockGorm, nil }),
+		WithAdmin(true), WithAsync(true), WithOwner("ops"),
+		WithTaskNotifier(func(ctx context.Context, t *Task) { notified = append(notified, t) }))
+	ctx := context.Background()
+	res, err := e.Execute(ctx, "DELETE FROM logs WHERE level = 'debug'")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "node1:42", res.Task.ID)
+	assert.Contains(t, mockServer.LastRequest().Query, "wait_for_completion=false")
+
+	task, err := e.Task(ctx, "node1:42")
+	if assert.NoError(t, err) {
+		assert.Equal(t, TaskCompleted, task.Status)
+		assert.Equal(t, int64(5), task.Affected)
+		assert.Len(t, notified, 1)
+	}
+	assert.NoError(t, md.ExpectationsWereMet())
+
+	md.Mock.ExpectQuery("SELECT \\* FROM `es_search_tasks` WHERE id = \\?").
+		WillReturnRows(md.NewRows([]string{"id", "owner", "status"}).AddRow("node1:42", "ops", TaskRunning))
+	_, err = New(testcommon.GetElasticClient(), WithMysql(func() (*gorm.DB, error) { return md.MockGorm, nil }),
+		WithOwner("guest")).CancelTask(ctx, "node1:42")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// 没有发起人时不提交任务，也不能查看与取消任务
+	anonymous := New(testcommon.GetElasticClient(), WithMysql(func() (*gorm.DB, error) { return md.MockGorm, nil }),
+		WithAdmin(true), WithAsync(true))
+	requests := len(mockServer.Requests())
+	_, err = anonymous.Execute(ctx, "DELETE FROM logs WHERE level = 'debug'")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	for _, r := range mockServer.Requests()[requests:] {
+		assert.NotContains(t, r.Path, "_delete_by_query")
+	}
+	_, err = anonymous.Tasks(ctx, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = anonymous.Task(ctx, "node1:42")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = anonymous.CancelTask(ctx, "node1:42")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.NoError(t, md.ExpectationsWereMet())
+}
+
+func TestStopLocalTasks(t *testing.T) {
+	md := testcommon.InitSqlMock()
+	defer md.Close()
+
+	md.Mock.ExpectBegin()
+	md.Mock.ExpectExec("INSERT INTO `es_search_tasks`").WillReturnResult(sqlmock.NewResult(1, 1))
+	md.Mock.ExpectCommit()
+	md.Mock.ExpectBegin()
+	md.Mock.ExpectExec("UPDATE `es_search_tasks` SET .* WHERE id = \\? AND status = \\?").
+		WithArgs(int64(0), "", sqlmock.AnyArg(), TaskCancelled, int64(0), sqlmock.AnyArg(), sqlmock.AnyArg(), TaskRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	md.Mock.ExpectCommit()
+
+	e := New(nil, WithMysql(func() (*gorm.DB, error) { return md.MockGorm, nil }), WithOwner("ops"))
+	started := make(chan struct{})
+	_, err := e.startLocalTask(context.Background(), "reindex", "errors", "INSERT INTO errors SELECT * FROM logs",
+		func(ctx context.Context, progress func(total, affected int64)) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-started
+
+	// 退出时取消本地任务，等待任务记录为 cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, StopLocalTasks(ctx))
+	assert.NoError(t, md.ExpectationsWereMet())
+}
+
+func TestExecuteDDL(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+
+	mockServer.RegisterHandler("^/metrics$", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"acknowledged":true,"index":"metrics"}`))
+	})
+	mockServer.RegisterHandler("^/logs$", func(w http.ResponseWriter, r *http.Request) {})
+	mockServer.Register("^/logs/_mapping", json.RawMessage(`{"logs":{"mappings":{"properties":{
+		"url":{"type":"keyword"},"user":{"properties":{"name":{"type":"keyword"}}}}}}}`))
+
+	ctx := context.Background()
+	_, err := New(testcommon.GetElasticClient()).Execute(ctx, "CREATE TABLE metrics (ts DATETIME)")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	e := New(testcommon.GetElasticClient(), WithAdmin(true))
+	_, err = e.Execute(ctx, "CREATE TABLE metrics (ts DATETIME, cpu DOUBLE) WITH (shards=3)")
+	if assert.NoError(t, err) {
+		last := mockServer.LastRequest()
+		assert.Equal(t, http.MethodPut, last.Method)
+		assert.JSONEq(t, `{"settings":{"number_of_shards":3},"mappings":{"properties":{
+			"ts":{"type":"date","format":"yyyy-MM-dd HH:mm:ss||strict_date_optional_time||epoch_millis"},
+			"cpu":{"type":"double"}}}}`, string(last.Body))
+	}
+
+	_, err = e.Execute(ctx, "CREATE TABLE logs (url KEYWORD)")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "table 'logs' already exists")
+	}
+	_, err = e.Execute(ctx, "CREATE TABLE IF NOT EXISTS logs (url KEYWORD)")
+	assert.NoError(t, err)
+
+	_, err = e.Execute(ctx, "ALTER TABLE logs ADD COLUMN user.name TEXT")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "duplicate column name 'user.name'")
+	}
+	_, err = e.Execute(ctx, "ALTER TABLE logs ADD COLUMN referer KEYWORD, ADD user.age INT")
+	if assert.NoError(t, err) {
+		last := mockServer.LastRequest()
+		assert.Equal(t, http.MethodPut, last.Method)
+		assert.Equal(t, "/logs/_mapping", last.Path)
+		assert.JSONEq(t, `{"properties":{"referer":{"type":"keyword"},
+			"user":{"type":"object","properties":{"age":{"type":"integer"}}}}}`, string(last.Body))
+	}
+}
+
+func TestExecuteInsertSelect(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+	md := testcommon.InitSqlMock()
+	defer md.Close()
+
+	mockServer.Register("/_reindex", json.RawMessage(`{"task":"node1:7"}`))
+	mockServer.Register("/logs/_count", json.RawMessage(`{"count":2}`))
+	mockServer.Register("/logs/_search", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"url":"/a","code":500}`)},
+		{Id: "2", Source: []byte(`{"url":"/b","code":200}`)},
+	})
+	// 进程内计算时通过 point in time 分批读取源索引
+	mockServer.RegisterHandler("/_pit$", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"pit-1","succeeded":true}`))
+	})
+	mockServer.Register("^/_search$", []*elastic.SearchHit{
+		{Id: "1", Source: []byte(`{"url":"/a","code":500}`)},
+		{Id: "2", Source: []byte(`{"url":"/b","code":200}`)},
+	})
+	mockServer.Register("/_bulk", json.RawMessage(`{"took":1,"errors":false,"items":[
+		{"index":{"_index":"errors","_id":"1","status":201}},
+		{"index":{"_index":"errors","_id":"2","status":201}}
+	]}`))
+
+	insertTask := func(id interface{}) {
+		md.Mock.ExpectBegin()
+		md.Mock.ExpectExec("INSERT INTO `es_search_tasks`").
+			WithArgs(id, "ops", "reindex", "errors", "", sqlmock.AnyArg(), TaskRunning,
+				int64(0), int64(0), "", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		md.Mock.ExpectCommit()
+	}
+	expectUpdate := func() {
+		md.Mock.ExpectBegin()
+		md.Mock.ExpectExec("UPDATE `es_search_tasks`").WillReturnResult(sqlmock.NewResult(0, 1))
+		md.Mock.ExpectCommit()
+	}
+
+	e := New(testcommon.GetElasticClient(), WithMysql(func() (*gorm.DB, error) { return md.MockGorm, nil }),
+		WithAdmin(true), WithOwner("ops"))
+	ctx := context.Background()
+
+	insertTask("node1:7")
+	res, err := e.Execute(ctx, "INSERT INTO errors SELECT url, UPPER(url) AS path FROM logs WHERE code >= 500")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "node1:7", res.Task.ID)
+		last := mockServer.LastRequest()
+		assert.Contains(t, last.Query, "wait_for_completion=false")
+		assert.JSONEq(t, `{"source":{"index":"logs","query":{"bool":{"filter":{"range":{"code":{"from":500,"include_lower":true,"include_upper":true,"to":null}}}}}},
+			"dest":{"index":"errors"},
+			"script":{"lang":"painless","source":"Map d = new HashMap(); d['url'] = ctx._source['url']; d['path'] = ctx._source['url'].toUpperCase(); ctx._source = d;"}}`,
+			string(last.Body))
+	}
+
+	// IN 不能翻译为 painless，在进程内计算后批量写入
+	insertTask(sqlmock.AnyArg())
+	expectUpdate()
+	expectUpdate()
+	expectUpdate()
+	res, err = e.Execute(ctx, "INSERT INTO errors (url, failed) SELECT url, code IN (500, 502) FROM logs")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Regexp(t, "^local:[0-9a-f]{16}$", res.Task.ID)
+	for i := 0; i < 100; i++ {
+		localMu.Lock()
+		_, running := localTasks[res.Task.ID]
+		localMu.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, md.ExpectationsWereMet())
+	var bulk string
+	for _, r := range mockServer.Requests() {
+		if r.Path == "/errors/_bulk" {
+			bulk = string(r.Body)
+		}
+	}
+	assert.Equal(t, `{"index":{"_id":"1"}}
+{"failed":true,"url":"/a"}
+{"index":{"_id":"2"}}
+{"failed":false,"url":"/b"}
+`, bulk)
+}
@@ -0,0 +1,361 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// 哈希关联的构建端
+const (
+	BuildLeft  = "left"
+	BuildRight = "right"
+)
+
+// hitRecords 将命中的文档转为行，附带 _id、_index、_score 元字段；同时返回 _source 中出现的字段名
+func hitRecords(hits []*elastic.SearchHit) ([]string, []record, error) {
+	recs := make([]record, 0, len(hits))
+	sources := make([]map[string]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		src, err := decodeSource(hit.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, src)
+		rec := make(record, len(src)+3)
+		for k, v := range src {
+			rec[k] = v
+		}
+		for _, meta := range []string{"_id", "_index", translator.ScoreField} {
+			rec[meta] = metaValue(hit, meta)
+		}
+		recs = append(recs, rec)
+	}
+	return sourceKeys(sources), recs, nil
+}
+
+// prepareES 为关联的 ES 索引选择哈希关联的构建端：
+//
+//   - 右表结果较少时先查询右表（构建端），将关联键以 terms 条件下推到左表查询
+//   - 否则以左表为构建端，按页收集左表的关联键，以 terms 条件批量查询右表
+//
+// LEFT JOIN 以及关联键不是左表字段时只能以左表为构建端。explain 为 true 时额外估算左表关联键个数
+func (e *Engine) prepareES(ctx context.Context, plan *joinPlan, explain bool) error {
+	for _, s := range plan.steps {
+		if s.source != SourceES {
+			continue
+		}
+		right := s.statement()
+		lookup := &esLookup{engine: e, step: s, stmt: right}
+		s.lookup = lookup
+		s.explain = &JoinExplain{Build: BuildLeft}
+
+		leftRows, err := e.count(ctx, plan.left)
+		if err != nil {
+			return err
+		}
+		rightRows, err := e.count(ctx, right)
+		if err != nil {
+			return err
+		}
+		s.explain.LeftRows, s.explain.RightRows = leftRows, rightRows
+
+		outer, ok := plan.leftKeys(s)
+		if ok && !s.join.Left && rightRows <= leftRows && rightRows <= int64(e.limits.MaxJoinRows) {
+			built, err := e.buildRight(ctx, plan, s, outer)
+			if err != nil {
+				return err
+			}
+			if built {
+				continue
+			}
+		}
+		if explain && ok {
+			if s.explain.Keys, err = e.cardinality(ctx, plan.left, outer[0]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// buildRight 查询右表全部结果作为构建端，关联键个数超过 MaxJoinKeys 时放弃并返回 false
+func (e *Engine) buildRight(ctx context.Context, plan *joinPlan, s *joinStep, outer []*sqlparser.ColumnRef) (bool, error) {
+	cols, recs, err := e.scan(ctx, s.statement(), e.limits.MaxJoinRows)
+	if err != nil {
+		return false, err
+	}
+	values := make([][]sqlparser.Expr, len(s.keys))
+	seen := make([]map[string]bool, len(s.keys))
+	tuples := make(map[string]bool)
+	for i := range seen {
+		seen[i] = make(map[string]bool)
+	}
+	for _, rec := range recs {
+		null := false
+		for _, k := range s.keys {
+			null = null || s.value(rec, k.inner) == nil
+		}
+		if null {
+			continue
+		}
+		tuples[s.key(rec)] = true
+		for i, k := range s.keys {
+			v := s.value(rec, k.inner)
+			if key := toString(v); !seen[i][key] {
+				seen[i][key] = true
+				values[i] = append(values[i], literal(v))
+			}
+		}
+	}
+	if len(tuples) > e.limits.MaxJoinKeys {
+		return false, nil
+	}
+
+	// 多个关联键时逐列下推，得到的是结果的超集，关联时再精确匹配
+	var where []sqlparser.Expr
+	if plan.left.Where != nil {
+		where = flattenAnd(plan.left.Where)
+	}
+	for i, c := range outer {
+		if len(values[i]) == 0 {
+			where = append(where, &sqlparser.BoolLit{Val: false})
+			break
+		}
+		where = append(where, &sqlparser.InExpr{Expr: c, List: values[i]})
+	}
+	plan.left.Where = joinAnd(where)
+
+	s.lookup = &hashLookup{step: s, columns: cols, records: recs}
+	s.explain.Build = BuildRight
+	s.explain.Keys = int64(len(tuples))
+	return true, nil
+}
+
+// leftKeys 关联键全部为左表字段时返回对应的字段引用
+func (p *joinPlan) leftKeys(s *joinStep) ([]*sqlparser.ColumnRef, bool) {
+	out := make([]*sqlparser.ColumnRef, len(s.keys))
+	for i, k := range s.keys {
+		c, ok := k.outer.(*sqlparser.ColumnRef)
+		if !ok {
+			return nil, false
+		}
+		if alias, _ := p.resolve(c.Name); alias != p.leftAlias {
+			return nil, false
+		}
+		out[i] = c
+	}
+	return out, true
+}
+
+// statement 右表（ES）的查询语句，只包含下推到右表的条件
+func (s *joinStep) statement() *sqlparser.SelectStmt {
+	var fields []*sqlparser.SelectField
+	if s.star {
+		fields = []*sqlparser.SelectField{{Expr: &sqlparser.StarExpr{}}}
+	} else {
+		var names []string
+		for _, k := range s.keys {
+			names = append(names, k.inner)
+		}
+		for _, c := range appendMissing(s.columns, names) {
+			fields = append(fields, &sqlparser.SelectField{Expr: &sqlparser.ColumnRef{Name: s.alias + "." + c}})
+		}
+	}
+	return &sqlparser.SelectStmt{
+		Fields: fields,
+		From:   &sqlparser.TableRef{Name: s.table, Alias: s.alias},
+		Where:  joinAnd(s.where),
+		Limit:  -1,
+	}
+}
+
+// count 统计查询命中的文档数
+func (e *Engine) count(ctx context.Context, stmt *sqlparser.SelectStmt) (int64, error) {
+	schema, err := e.schema(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+	req, err := translator.Translate(stmt, schema)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := e.doSearch(ctx, req.Index, req.Source.Size(0).TrackTotalHits(true))
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalHits(), nil
+}
+
+// cardinality 估算查询结果中字段的不同取值个数
+func (e *Engine) cardinality(ctx context.Context, stmt *sqlparser.SelectStmt, c *sqlparser.ColumnRef) (int64, error) {
+	schema, err := e.schema(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+	req, err := translator.Translate(stmt, schema)
+	if err != nil {
+		return 0, err
+	}
+	field := c.Name
+	if stmt.From.Alias != "" {
+		field = strings.TrimPrefix(field, stmt.From.Alias+".")
+	}
+	src := req.Source.Size(0).Aggregation("keys", elastic.NewCardinalityAggregation().Field(field))
+	resp, err := e.doSearch(ctx, req.Index, src)
+	if err != nil {
+		return 0, err
+	}
+	agg, ok := resp.Aggregations.Cardinality("keys")
+	if !ok || agg.Value == nil {
+		return 0, nil
+	}
+	return int64(*agg.Value), nil
+}
+
+// scan 分页读取查询的全部结果，超过 max 行时报错
+func (e *Engine) scan(ctx context.Context, stmt *sqlparser.SelectStmt, max int) ([]string, []record, error) {
+	schema, err := e.schema(ctx, stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := translator.Translate(stmt, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Source.Sort("_doc", true)
+	var (
+		cols []string
+		out  []record
+		seen = make(map[string]bool)
+	)
+	pageSize := e.limits.JoinBatchSize
+	for from := 0; ; from += pageSize {
+		if from >= max {
+			return nil, nil, fmt.Errorf("JOIN scanned more than %d rows of %s, add a more selective WHERE", max, req.Index)
+		}
+		resp, err := e.doSearch(ctx, req.Index, req.Source.From(from).Size(pageSize))
+		if err != nil {
+			return nil, nil, err
+		}
+		var hits []*elastic.SearchHit
+		if resp.Hits != nil {
+			hits = resp.Hits.Hits
+		}
+		keys, recs, err := hitRecords(hits)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, k := range keys {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+		out = append(out, recs...)
+		if len(hits) < pageSize {
+			return cols, out, nil
+		}
+	}
+}
+
+// esLookup 以 terms 条件按关联键批量查询右表（ES）
+type esLookup struct {
+	engine *Engine
+	step   *joinStep
+	stmt   *sqlparser.SelectStmt
+}
+
+func (l *esLookup) query(ctx context.Context, values [][]interface{}) ([]string, []record, error) {
+	if len(values) == 0 {
+		return nil, nil, nil
+	}
+	e := l.engine
+	where := []sqlparser.Expr{}
+	if l.stmt.Where != nil {
+		where = append(where, l.stmt.Where)
+	}
+	for i, k := range l.step.keys {
+		list := make([]sqlparser.Expr, len(values))
+		for j, v := range values {
+			list[j] = literal(v[i])
+		}
+		ref := &sqlparser.ColumnRef{Name: l.step.alias + "." + k.inner}
+		where = append(where, &sqlparser.InExpr{Expr: ref, List: list})
+	}
+	stmt := *l.stmt
+	stmt.Where = joinAnd(where)
+
+	schema, err := e.schema(ctx, &stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := translator.Translate(&stmt, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	size := len(values) * e.limits.MaxJoinFanOut
+	if size > e.limits.MaxJoinRows {
+		size = e.limits.MaxJoinRows
+	}
+	resp, err := e.doSearch(ctx, req.Index, req.Source.Size(size).TrackTotalHits(true))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.TotalHits() > int64(size) {
+		return nil, nil, fmt.Errorf("JOIN %s: %d keys match more than %d rows", l.step.join.Table.Name, len(values), size)
+	}
+	var hits []*elastic.SearchHit
+	if resp.Hits != nil {
+		hits = resp.Hits.Hits
+	}
+	return hitRecords(hits)
+}
+
+// hashLookup 右表为构建端时，在内存中按关联键匹配
+type hashLookup struct {
+	step    *joinStep
+	columns []string
+	records []record
+	index   map[string][]record
+}
+
+func (l *hashLookup) query(_ context.Context, values [][]interface{}) ([]string, []record, error) {
+	if l.index == nil {
+		l.index = make(map[string][]record, len(l.records))
+		for _, rec := range l.records {
+			key := l.step.key(rec)
+			l.index[key] = append(l.index[key], rec)
+		}
+	}
+	var out []record
+	for _, v := range values {
+		parts := make([]string, len(v))
+		for i, x := range v {
+			parts[i] = toString(x)
+		}
+		out = append(out, l.index[strings.Join(parts, "\x00")]...)
+	}
+	return l.columns, out, nil
+}
+
+// literal 将值转为 SQL 字面量，用于生成下推的 IN 条件
+func literal(v interface{}) sqlparser.Expr {
+	switch t := v.(type) {
+	case int64:
+		return &sqlparser.NumberLit{Raw: strconv.FormatInt(t, 10)}
+	case int:
+		return &sqlparser.NumberLit{Raw: strconv.Itoa(t)}
+	case float64:
+		return &sqlparser.NumberLit{Raw: strconv.FormatFloat(t, 'f', -1, 64)}
+	case bool:
+		return &sqlparser.BoolLit{Val: t}
+	}
+	return &sqlparser.StringLit{Val: toString(v)}
+}
@@ -0,0 +1,427 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// evalEnv 表达式求值上下文，lookup 返回表达式在当前行中的值
+type evalEnv interface {
+	lookup(e sqlparser.Expr) (interface{}, bool)
+}
+
+// rowEnv 进程内表达式求值的行上下文
+type rowEnv struct {
+	cols []*translator.Column
+	row  []interface{}
+}
+
+// lookup 表达式与结果列匹配时直接取列值：聚合函数按表达式匹配，字段按列名或源字段匹配。
+// 进程内计算的列按表达式重新计算，避免计算该列时读到它自身尚未填充的值
+func (env rowEnv) lookup(e sqlparser.Expr) (interface{}, bool) {
+	key := e.String()
+	for i, c := range env.cols {
+		if c.Expr != nil && c.Kind != translator.ColumnComputed && c.Expr.String() == key {
+			return env.row[i], true
+		}
+	}
+	if ref, ok := e.(*sqlparser.ColumnRef); ok {
+		for i, c := range env.cols {
+			if c.Name == ref.Name || c.Field == ref.Name {
+				return env.row[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// eval 按 MySQL 语义在进程内计算表达式，nil 表示 NULL
+func eval(e sqlparser.Expr, env evalEnv) (interface{}, error) {
+	if v, ok := env.lookup(e); ok {
+		return v, nil
+	}
+	switch n := e.(type) {
+	case *sqlparser.StringLit:
+		return n.Val, nil
+	case *sqlparser.NumberLit:
+		return n.Value(), nil
+	case *sqlparser.BoolLit:
+		return n.Val, nil
+	case *sqlparser.NullLit:
+		return nil, nil
+	case *sqlparser.ColumnRef:
+		return nil, fmt.Errorf("unknown column '%s'", n.Name)
+	case *sqlparser.UnaryExpr:
+		v, err := eval(n.Expr, env)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if n.Op == "NOT" {
+			return !truthy(v), nil
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %v", v)
+		}
+		return numberResult(-f), nil
+	case *sqlparser.BinaryExpr:
+		return evalBinary(n, env)
+	case *sqlparser.InExpr:
+		v, err := eval(n.Expr, env)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		sawNull := false
+		for _, item := range n.List {
+			x, err := eval(item, env)
+			if err != nil {
+				return nil, err
+			}
+			if x == nil {
+				sawNull = true
+				continue
+			}
+			if c, ok := compare(v, x); ok && c == 0 {
+				return !n.Not, nil
+			}
+		}
+		if sawNull {
+			return nil, nil
+		}
+		return n.Not, nil
+	case *sqlparser.BetweenExpr:
+		v, err := eval(n.Expr, env)
+		if err != nil {
+			return nil, err
+		}
+		lower, err := eval(n.Lower, env)
+		if err != nil {
+			return nil, err
+		}
+		upper, err := eval(n.Upper, env)
+		if err != nil {
+			return nil, err
+		}
+		c1, ok1 := compare(v, lower)
+		c2, ok2 := compare(v, upper)
+		if !ok1 || !ok2 {
+			return nil, nil
+		}
+		return (c1 >= 0 && c2 <= 0) != n.Not, nil
+	case *sqlparser.IsNullExpr:
+		v, err := eval(n.Expr, env)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != n.Not, nil
+	case *sqlparser.LikeExpr:
+		v, err := eval(n.Expr, env)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		p, err := eval(n.Pattern, env)
+		if err != nil || p == nil {
+			return nil, err
+		}
+		re, err := likeRegexp(toString(p), n.Escape, n.CaseInsensitive)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(toString(v)) != n.Not, nil
+	case *sqlparser.FuncCall:
+		if translator.IsScalarFunc(n) {
+			if err := translator.CheckScalarCall(n); err != nil {
+				return nil, err
+			}
+			return evalFunc(n, env)
+		}
+	case *sqlparser.CaseExpr:
+		return evalCase(n, env)
+	}
+	return nil, fmt.Errorf("cannot evaluate expression: %s", e.String())
+}
+
+func evalBinary(n *sqlparser.BinaryExpr, env evalEnv) (interface{}, error) {
+	left, err := eval(n.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	// AND / OR 三值逻辑
+	switch n.Op {
+	case "AND":
+		if left != nil && !truthy(left) {
+			return false, nil
+		}
+		right, err := eval(n.Right, env)
+		if err != nil {
+			return nil, err
+		}
+		if right != nil && !truthy(right) {
+			return false, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return true, nil
+	case "OR":
+		if left != nil && truthy(left) {
+			return true, nil
+		}
+		right, err := eval(n.Right, env)
+		if err != nil {
+			return nil, err
+		}
+		if right != nil && truthy(right) {
+			return true, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return false, nil
+	}
+
+	right, err := eval(n.Right, env)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	switch n.Op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		c, ok := compare(left, right)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v with %v", left, right)
+		}
+		switch n.Op {
+		case "=":
+			return c == 0, nil
+		case "!=":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+
+	a, ok1 := toFloat(left)
+	b, ok2 := toFloat(right)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("arithmetic on non-numeric values: %s", n.String())
+	}
+	switch n.Op {
+	case "+":
+		return numberResult(a + b), nil
+	case "-":
+		return numberResult(a - b), nil
+	case "*":
+		return numberResult(a * b), nil
+	case "/":
+		if b == 0 {
+			return nil, nil
+		}
+		return a / b, nil
+	case "DIV":
+		if b == 0 {
+			return nil, nil
+		}
+		return int64(a / b), nil
+	case "%":
+		if b == 0 {
+			return nil, nil
+		}
+		return numberResult(math.Mod(a, b)), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.Op)
+}
+
+// filterRows 只保留条件为真的行
+func filterRows(cols []*translator.Column, rows [][]interface{}, cond sqlparser.Expr) ([][]interface{}, error) {
+	if cond == nil {
+		return rows, nil
+	}
+	out := rows[:0]
+	for _, row := range rows {
+		v, err := eval(cond, rowEnv{cols: cols, row: row})
+		if err != nil {
+			return nil, err
+		}
+		if v != nil && truthy(v) {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// sortRows 按 ORDER BY 稳定排序，NULL 排在最前（与 MySQL 一致）
+func sortRows(cols []*translator.Column, rows [][]interface{}, orderBy []*sqlparser.OrderItem) error {
+	idx, err := sortIndex(len(rows), orderBy, func(i int) evalEnv {
+		return rowEnv{cols: cols, row: rows[i]}
+	})
+	if err != nil || idx == nil {
+		return err
+	}
+	sorted := make([][]interface{}, len(rows))
+	for i, j := range idx {
+		sorted[i] = rows[j]
+	}
+	copy(rows, sorted)
+	return nil
+}
+
+// sortIndex 计算 n 行按 ORDER BY 稳定排序后的下标，envAt 返回第 i 行的求值上下文
+func sortIndex(n int, orderBy []*sqlparser.OrderItem, envAt func(i int) evalEnv) ([]int, error) {
+	if len(orderBy) == 0 {
+		return nil, nil
+	}
+	keys := make([][]interface{}, n)
+	for i := range keys {
+		keys[i] = make([]interface{}, len(orderBy))
+		for j, o := range orderBy {
+			v, err := eval(o.Expr, envAt(i))
+			if err != nil {
+				return nil, err
+			}
+			keys[i][j] = v
+		}
+	}
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		for j, o := range orderBy {
+			c := compareNullable(keys[idx[a]][j], keys[idx[b]][j])
+			if c == 0 {
+				continue
+			}
+			if o.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return idx, nil
+}
+
+func compareNullable(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := compare(a, b)
+	return c
+}
+
+// compare 比较两个非空值，数字按数值比较，其余按字符串比较
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	return strings.Compare(toString(a), toString(b)), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case float64:
+		return t, true
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func truthy(v interface{}) bool {
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return v != nil && toString(v) != ""
+}
+
+// numberResult 整数值的计算结果保持为 int64
+func numberResult(f float64) interface{} {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return f
+}
+
+// likeRegexp 将 LIKE 模式转为正则表达式，与 ES 查询一致默认区分大小写
+func likeRegexp(pattern, escape string, insensitive bool) (*regexp.Regexp, error) {
+	esc := '\\'
+	if escape != "" {
+		esc = []rune(escape)[0]
+	}
+	var sb strings.Builder
+	if insensitive {
+		sb.WriteString("(?i)")
+	}
+	sb.WriteString("(?s)^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == esc && i+1 < len(runes):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case r == '%':
+			sb.WriteString(".*")
+		case r == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
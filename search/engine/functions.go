@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// evalFunc 按 MySQL 语义在进程内计算标量函数，调用方已检查参数个数
+func evalFunc(n *sqlparser.FuncCall, env evalEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.Args))
+	for i, a := range n.Args {
+		v, err := eval(a, env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	switch n.Name {
+	case "COALESCE", "IFNULL":
+		for _, v := range args {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	case "NULLIF":
+		if c, ok := compare(args[0], args[1]); ok && c == 0 {
+			return nil, nil
+		}
+		return args[0], nil
+	}
+	// 其余函数的任一参数为 NULL 时结果为 NULL
+	for _, v := range args {
+		if v == nil {
+			return nil, nil
+		}
+	}
+
+	switch n.Name {
+	case "CONCAT":
+		var b strings.Builder
+		for _, v := range args {
+			b.WriteString(toString(v))
+		}
+		return b.String(), nil
+	case "LOWER":
+		return strings.ToLower(toString(args[0])), nil
+	case "UPPER":
+		return strings.ToUpper(toString(args[0])), nil
+	case "TRIM":
+		return strings.TrimSpace(toString(args[0])), nil
+	case "LENGTH":
+		return int64(len(toString(args[0]))), nil
+	case "CHAR_LENGTH":
+		return int64(utf8.RuneCountInString(toString(args[0]))), nil
+	case "SUBSTRING", "SUBSTR":
+		return substring(n, args)
+	case "ROUND":
+		x, err := numberArg(n, args[0])
+		if err != nil {
+			return nil, err
+		}
+		d := 0.0
+		if len(args) == 2 {
+			if d, err = numberArg(n, args[1]); err != nil {
+				return nil, err
+			}
+		}
+		m := math.Pow(10, math.Trunc(d))
+		return numberResult(math.Round(x*m) / m), nil
+	case "FLOOR", "CEIL", "CEILING", "ABS":
+		x, err := numberArg(n, args[0])
+		if err != nil {
+			return nil, err
+		}
+		switch n.Name {
+		case "FLOOR":
+			return numberResult(math.Floor(x)), nil
+		case "ABS":
+			return numberResult(math.Abs(x)), nil
+		}
+		return numberResult(math.Ceil(x)), nil
+	case "DATE_FORMAT":
+		t, ok := toTime(args[0])
+		if !ok {
+			return nil, nil
+		}
+		return formatDate(t, toString(args[1])), nil
+	}
+	return nil, fmt.Errorf("cannot evaluate function %s", n.Name)
+}
+
+// evalCase CASE 依次匹配 WHEN 分支，条件为 NULL 时视为不匹配
+func evalCase(n *sqlparser.CaseExpr, env evalEnv) (interface{}, error) {
+	var operand interface{}
+	if n.Operand != nil {
+		v, err := eval(n.Operand, env)
+		if err != nil {
+			return nil, err
+		}
+		operand = v
+	}
+	for _, w := range n.Whens {
+		v, err := eval(w.Cond, env)
+		if err != nil {
+			return nil, err
+		}
+		matched := v != nil && truthy(v)
+		if n.Operand != nil {
+			c, ok := compare(operand, v)
+			matched = ok && c == 0
+		}
+		if matched {
+			return eval(w.Result, env)
+		}
+	}
+	if n.Else == nil {
+		return nil, nil
+	}
+	return eval(n.Else, env)
+}
+
+func numberArg(n *sqlparser.FuncCall, v interface{}) (float64, error) {
+	f, ok := toFloat(v)
+	if !ok {
+		return 0, fmt.Errorf("%s expects a number, got %v", n.Name, v)
+	}
+	return f, nil
+}
+
+// substring SUBSTRING(s, pos[, len])：pos 从 1 开始，负数表示从末尾倒数，按字符计算
+func substring(n *sqlparser.FuncCall, args []interface{}) (interface{}, error) {
+	s := []rune(toString(args[0]))
+	pos, err := numberArg(n, args[1])
+	if err != nil {
+		return nil, err
+	}
+	length := math.Inf(1)
+	if len(args) == 3 {
+		if length, err = numberArg(n, args[2]); err != nil {
+			return nil, err
+		}
+	}
+	start := int(pos) - 1
+	if pos < 0 {
+		start = len(s) + int(pos)
+	}
+	if pos == 0 || start < 0 || start >= len(s) || length <= 0 {
+		return "", nil
+	}
+	end := len(s)
+	if float64(len(s)-start) > length {
+		end = start + int(length)
+	}
+	return string(s[start:end]), nil
+}
+
+// dateLayouts _source 中日期字符串的常见格式
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// toTime 解析日期值：字符串按常见格式解析，数字按毫秒时间戳处理，统一转为 UTC
+func toTime(v interface{}) (time.Time, bool) {
+	if s, ok := v.(string); ok {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC(), true
+			}
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return time.Time{}, false
+		}
+	}
+	ms, ok := toFloat(v)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(ms)).UTC(), true
+}
+
+// formatDate 按 MySQL DATE_FORMAT 的格式符格式化日期，未知的格式符原样输出其字符
+func formatDate(t time.Time, format string) string {
+	var b strings.Builder
+	hour12 := t.Hour() % 12
+	if hour12 == 0 {
+		hour12 = 12
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'c':
+			fmt.Fprintf(&b, "%d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'e':
+			fmt.Fprintf(&b, "%d", t.Day())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'k':
+			fmt.Fprintf(&b, "%d", t.Hour())
+		case 'h', 'I':
+			fmt.Fprintf(&b, "%02d", hour12)
+		case 'l':
+			fmt.Fprintf(&b, "%d", hour12)
+		case 'i':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 's', 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'f':
+			fmt.Fprintf(&b, "%06d", t.Nanosecond()/1000)
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'M':
+			b.WriteString(t.Month().String())
+		case 'b':
+			b.WriteString(t.Format("Jan"))
+		case 'W':
+			b.WriteString(t.Weekday().String())
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'T':
+			b.WriteString(t.Format("15:04:05"))
+		case 'r':
+			b.WriteString(t.Format("03:04:05 PM"))
+		default:
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,765 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+	"gorm.io/gorm"
+
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// 数据源前缀，例如 FROM es.events e JOIN mysql.pages p
+const (
+	SourceES    = "es"
+	SourceMysql = "mysql"
+)
+
+// splitSource 拆分表名中的数据源前缀，无前缀时为 ES 索引
+func splitSource(name string) (string, string) {
+	for _, src := range []string{SourceES, SourceMysql} {
+		if strings.HasPrefix(name, src+".") {
+			return src, name[len(src)+1:]
+		}
+	}
+	return SourceES, name
+}
+
+// tableAlias 表别名，未指定时使用表名的最后一段
+func tableAlias(t *sqlparser.TableRef) string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	_, name := splitSource(t.Name)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// esStatement 去掉 FROM 中的 es. 前缀，MySQL 表不能单独查询
+func esStatement(stmt *sqlparser.SelectStmt) (*sqlparser.SelectStmt, error) {
+	if stmt.From == nil {
+		return stmt, nil
+	}
+	src, name := splitSource(stmt.From.Name)
+	if src != SourceES {
+		return nil, fmt.Errorf("%s: MySQL tables can only be used on the right side of a JOIN", stmt.From.Name)
+	}
+	if name == stmt.From.Name {
+		return stmt, nil
+	}
+	s := *stmt
+	s.From = &sqlparser.TableRef{Name: name, Alias: stmt.From.Alias}
+	return &s, nil
+}
+
+// record 一行数据，键为字段名
+type record map[string]interface{}
+
+// joinRow 关联后的一行，键为表别名
+type joinRow map[string]record
+
+// joinEnv 关联行的求值上下文：alias.field 引用对应表的字段，不带别名的字段属于左表（ES）
+type joinEnv struct {
+	plan *joinPlan
+	row  joinRow
+}
+
+func (env joinEnv) lookup(e sqlparser.Expr) (interface{}, bool) {
+	c, ok := e.(*sqlparser.ColumnRef)
+	if !ok {
+		return nil, false
+	}
+	alias, field := env.plan.resolve(c.Name)
+	rec := env.row[alias]
+	if rec == nil {
+		return nil, true
+	}
+	if alias == env.plan.leftAlias {
+		return lookup(rec, field), true
+	}
+	return env.plan.step(alias).value(rec, field), true
+}
+
+// joinKey 等值关联条件：outer 为已关联部分的表达式，inner 为右表字段
+type joinKey struct {
+	outer sqlparser.Expr
+	inner string
+}
+
+// joinLookup 按关联键批量查询右表，values 的每一项与关联键一一对应；返回列名与匹配的行
+type joinLookup interface {
+	query(ctx context.Context, values [][]interface{}) ([]string, []record, error)
+}
+
+// joinStep 一次 JOIN
+type joinStep struct {
+	join    *sqlparser.Join
+	source  string
+	table   string
+	alias   string
+	keys    []joinKey
+	where   []sqlparser.Expr // 下推到右表的条件
+	columns []string         // 需要查询的列，为空时查询全部列
+	star    bool             // 查询字段中包含 alias.* 或 *
+	lookup  joinLookup
+
+	resultColumns []string // 右表返回的列名，用于展开 *
+	explain       *JoinExplain
+}
+
+// value 读取右表行中的字段，ES 文档按点号路径读取
+func (s *joinStep) value(rec record, field string) interface{} {
+	if s.source == SourceES {
+		return lookup(rec, field)
+	}
+	return rec[field]
+}
+
+// pushable 条件能否下推到右表
+func (s *joinStep) pushable(c sqlparser.Expr) bool {
+	if s.source == SourceES {
+		return true
+	}
+	_, _, err := mysqlCondition(c, s.alias)
+	return err == nil
+}
+
+// joinPlan JOIN 执行计划：先查询左表（ES），再按批次关联各个右表
+type joinPlan struct {
+	stmt      *sqlparser.SelectStmt
+	left      *sqlparser.SelectStmt // 左表查询，只包含下推到 ES 的条件与排序
+	leftAlias string
+	leftStar  bool
+	steps     []*joinStep
+	residual  sqlparser.Expr // 关联后在进程内执行的条件
+	sortAfter bool           // ORDER BY 无法下推到 ES，关联后在进程内排序
+}
+
+// resolve 解析字段引用所属的表别名与字段名
+func (p *joinPlan) resolve(name string) (string, string) {
+	for _, s := range p.steps {
+		if strings.HasPrefix(name, s.alias+".") {
+			return s.alias, name[len(s.alias)+1:]
+		}
+	}
+	if p.leftAlias != "" && strings.HasPrefix(name, p.leftAlias+".") {
+		return p.leftAlias, name[len(p.leftAlias)+1:]
+	}
+	return p.leftAlias, name
+}
+
+// aliasesOf 表达式引用的表别名集合
+func (p *joinPlan) aliasesOf(e sqlparser.Expr) map[string]bool {
+	out := make(map[string]bool)
+	sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+		if c, ok := n.(*sqlparser.ColumnRef); ok {
+			alias, _ := p.resolve(c.Name)
+			out[alias] = true
+		}
+		return true
+	})
+	return out
+}
+
+func (p *joinPlan) step(alias string) *joinStep {
+	for _, s := range p.steps {
+		if s.alias == alias {
+			return s
+		}
+	}
+	return nil
+}
+
+// planJoin 拆分 JOIN 语句：只引用 ES 的条件下推到 ES，只引用某个 INNER JOIN 表的条件下推到 MySQL，其余关联后在进程内执行
+func planJoin(stmt *sqlparser.SelectStmt) (*joinPlan, error) {
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil || stmt.Distinct {
+		return nil, fmt.Errorf("GROUP BY, HAVING and DISTINCT are not supported with JOIN")
+	}
+	for _, f := range stmt.Fields {
+		found := false
+		sqlparser.Walk(f.Expr, func(n sqlparser.Expr) bool {
+			found = found || translator.IsAggregateFunc(n) || translator.IsWindowFunc(n)
+			return !found
+		})
+		if found {
+			return nil, fmt.Errorf("aggregate functions are not supported with JOIN: %s", f.Raw)
+		}
+	}
+	left, err := esStatement(stmt)
+	if err != nil {
+		return nil, err
+	}
+	plan := &joinPlan{stmt: stmt, leftAlias: stmt.From.Alias}
+
+	known := map[string]bool{plan.leftAlias: true}
+	for _, j := range stmt.Joins {
+		src, table := splitSource(j.Table.Name)
+		if src == SourceMysql && !mysqlTablePattern.MatchString(table) {
+			return nil, fmt.Errorf("JOIN %s: invalid table name", j.Table.Name)
+		}
+		s := &joinStep{join: j, source: src, table: table, alias: tableAlias(j.Table)}
+		if known[s.alias] {
+			return nil, fmt.Errorf("JOIN %s: duplicate table alias '%s'", j.Table.Name, s.alias)
+		}
+		plan.steps = append(plan.steps, s)
+		for _, c := range flattenAnd(j.On) {
+			if err := plan.addJoinCondition(s, c, known); err != nil {
+				return nil, err
+			}
+		}
+		if len(s.keys) == 0 {
+			return nil, fmt.Errorf("JOIN %s: ON requires an equality condition such as %s.id = ...", j.Table.Name, s.alias)
+		}
+		known[s.alias] = true
+	}
+
+	// WHERE 条件按引用的表拆分
+	var leftWhere, residual []sqlparser.Expr
+	for _, c := range flattenAnd(stmt.Where) {
+		if c == nil {
+			continue
+		}
+		aliases := plan.aliasesOf(c)
+		if len(aliases) == 0 || (len(aliases) == 1 && aliases[plan.leftAlias]) {
+			leftWhere = append(leftWhere, c)
+			continue
+		}
+		if len(aliases) == 1 {
+			for alias := range aliases {
+				if s := plan.step(alias); !s.join.Left && s.pushable(c) {
+					s.where = append(s.where, c)
+					continue
+				}
+				residual = append(residual, c)
+			}
+			continue
+		}
+		residual = append(residual, c)
+	}
+	plan.residual = joinAnd(residual)
+
+	// ORDER BY 只引用 ES 字段时下推
+	var pushed []*sqlparser.OrderItem
+	for _, o := range stmt.OrderBy {
+		aliases := plan.aliasesOf(o.Expr)
+		if _, ok := o.Expr.(*sqlparser.ColumnRef); !ok || len(aliases) != 1 || !aliases[plan.leftAlias] {
+			plan.sortAfter = true
+			pushed = nil
+			break
+		}
+		pushed = append(pushed, o)
+	}
+
+	// 各表需要查询的字段
+	exprs := []sqlparser.Expr{stmt.Where}
+	for _, j := range stmt.Joins {
+		exprs = append(exprs, j.On)
+	}
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+	for _, f := range stmt.Fields {
+		if star, ok := f.Expr.(*sqlparser.StarExpr); ok {
+			if star.Table == "" || star.Table == plan.leftAlias {
+				plan.leftStar = true
+			}
+			for _, s := range plan.steps {
+				if star.Table == "" || star.Table == s.alias {
+					s.star = true
+				}
+			}
+			continue
+		}
+		exprs = append(exprs, f.Expr)
+	}
+	var leftFields []*sqlparser.SelectField
+	seen := make(map[string]bool)
+	for _, e := range exprs {
+		sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+			c, ok := n.(*sqlparser.ColumnRef)
+			if !ok {
+				return true
+			}
+			alias, field := plan.resolve(c.Name)
+			if seen[alias+"\x00"+field] {
+				return true
+			}
+			seen[alias+"\x00"+field] = true
+			if alias == plan.leftAlias {
+				leftFields = append(leftFields, &sqlparser.SelectField{Expr: c})
+			} else if s := plan.step(alias); !s.star {
+				s.columns = append(s.columns, field)
+			}
+			return true
+		})
+	}
+	if plan.leftStar || len(leftFields) == 0 {
+		leftFields = []*sqlparser.SelectField{{Expr: &sqlparser.StarExpr{}}}
+	}
+
+	plan.left = &sqlparser.SelectStmt{
+		Fields:  leftFields,
+		From:    left.From,
+		Where:   joinAnd(leftWhere),
+		OrderBy: pushed,
+		Limit:   -1,
+	}
+	return plan, nil
+}
+
+// addJoinCondition ON 条件：右表字段与已关联表达式的等值条件作为关联键，只引用右表的条件下推到右表
+func (p *joinPlan) addJoinCondition(s *joinStep, c sqlparser.Expr, known map[string]bool) error {
+	aliases := p.aliasesOf(c)
+	if len(aliases) == 1 && aliases[s.alias] {
+		if !s.pushable(c) {
+			return fmt.Errorf("JOIN %s: unsupported ON condition %s", s.join.Table.Name, c.String())
+		}
+		s.where = append(s.where, c)
+		return nil
+	}
+	if b, ok := c.(*sqlparser.BinaryExpr); ok && b.Op == "=" {
+		for _, pair := range [][2]sqlparser.Expr{{b.Left, b.Right}, {b.Right, b.Left}} {
+			ref, ok := pair[0].(*sqlparser.ColumnRef)
+			if !ok {
+				continue
+			}
+			alias, field := p.resolve(ref.Name)
+			if alias != s.alias {
+				continue
+			}
+			outer := p.aliasesOf(pair[1])
+			valid := len(outer) > 0 && !outer[s.alias]
+			for a := range outer {
+				valid = valid && known[a]
+			}
+			if valid {
+				s.keys = append(s.keys, joinKey{outer: pair[1], inner: field})
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("JOIN %s: unsupported ON condition %s", s.join.Table.Name, c.String())
+}
+
+// checkJoinTables MySQL 表只能由已认证的请求者关联，并且必须在允许 JOIN 的表中；
+// database.table 形式同样需要完整地出现在允许列表中
+func (e *Engine) checkJoinTables(plan *joinPlan) error {
+	for _, s := range plan.steps {
+		if s.source != SourceMysql {
+			continue
+		}
+		if e.owner == "" {
+			return fmt.Errorf("%w: JOIN %s requires an authenticated identity", ErrPermissionDenied, s.join.Table.Name)
+		}
+		if !e.joinTables[s.table] {
+			return fmt.Errorf("%w: JOIN %s: table is not allowed to be joined", ErrPermissionDenied, s.join.Table.Name)
+		}
+	}
+	return nil
+}
+
+// prepareMysql 创建各个 MySQL 表的批量查询
+func (e *Engine) prepareMysql(plan *joinPlan) error {
+	var db *gorm.DB
+	for _, s := range plan.steps {
+		if s.source != SourceMysql {
+			continue
+		}
+		if db == nil {
+			if e.mysql == nil {
+				return fmt.Errorf("mysql is not configured")
+			}
+			var err error
+			if db, err = e.mysql(); err != nil {
+				return err
+			}
+		}
+		l := &mysqlLookup{db: db, table: s.table}
+		for _, k := range s.keys {
+			l.keys = append(l.keys, k.inner)
+		}
+		if !s.star {
+			l.columns = appendMissing(s.columns, l.keys)
+		}
+		if len(s.where) > 0 {
+			var err error
+			if l.where, l.args, err = mysqlCondition(joinAnd(s.where), s.alias); err != nil {
+				return err
+			}
+		}
+		s.lookup = l
+	}
+	return nil
+}
+
+// join 执行 JOIN：按页查询 ES，每页按批次关联右表，满足 LIMIT 后提前结束
+func (e *Engine) join(ctx context.Context, stmt *sqlparser.SelectStmt) (*Result, error) {
+	plan, err := planJoin(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkJoinTables(plan); err != nil {
+		return nil, err
+	}
+	if e.client == nil {
+		return nil, fmt.Errorf("elasticsearch client is not initialized")
+	}
+	if err := e.prepareES(ctx, plan, false); err != nil {
+		return nil, err
+	}
+	if err := e.prepareMysql(plan); err != nil {
+		return nil, err
+	}
+
+	schema, err := e.schema(ctx, plan.left)
+	if err != nil {
+		return nil, err
+	}
+	req, err := translator.Translate(plan.left, schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkCost(ctx, req); err != nil {
+		return nil, err
+	}
+	if len(plan.left.OrderBy) == 0 {
+		// 未指定排序时按 _doc 排序，保证分页稳定
+		req.Source.Sort("_doc", true)
+	}
+
+	need := int64(-1)
+	if !plan.sortAfter && stmt.HasLimit() {
+		need = stmt.Offset + stmt.Limit
+	}
+	pageSize := e.limits.JoinBatchSize
+	var (
+		rows     []joinRow
+		starKeys []string
+		seenKeys = make(map[string]bool)
+		took     int64
+	)
+	for from := 0; ; from += pageSize {
+		size := pageSize
+		if rest := e.limits.MaxJoinRows - from; rest < size {
+			size = rest
+		}
+		resp, err := e.doSearch(ctx, req.Index, req.Source.From(from).Size(size))
+		if err != nil {
+			return nil, err
+		}
+		took += resp.TookInMillis
+		var hits []*elastic.SearchHit
+		if resp.Hits != nil {
+			hits = resp.Hits.Hits
+		}
+
+		keys, recs, err := hitRecords(hits)
+		if err != nil {
+			return nil, err
+		}
+		batch := make([]joinRow, len(recs))
+		for i, rec := range recs {
+			batch[i] = joinRow{plan.leftAlias: rec}
+		}
+		for _, k := range keys {
+			if !seenKeys[k] {
+				seenKeys[k] = true
+				starKeys = append(starKeys, k)
+			}
+		}
+
+		for _, s := range plan.steps {
+			if batch, err = e.joinBatch(ctx, plan, s, batch); err != nil {
+				return nil, err
+			}
+		}
+		for _, row := range batch {
+			if plan.residual != nil {
+				v, err := eval(plan.residual, joinEnv{plan: plan, row: row})
+				if err != nil {
+					return nil, err
+				}
+				if v == nil || !truthy(v) {
+					continue
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		if len(hits) < size || (need >= 0 && int64(len(rows)) >= need) {
+			break
+		}
+		if scanned := int64(from + len(hits)); scanned >= int64(e.limits.MaxJoinRows) {
+			// 恰好读完全部命中时不算超过限制
+			if t := resp.Hits.TotalHits; t != nil && t.Relation == "eq" && t.Value <= scanned {
+				break
+			}
+			return nil, fmt.Errorf("JOIN scanned more than %d rows of %s, add a more selective WHERE or LIMIT", e.limits.MaxJoinRows, req.Index)
+		}
+	}
+
+	if plan.sortAfter {
+		idx, err := sortIndex(len(rows), stmt.OrderBy, func(i int) evalEnv {
+			return joinEnv{plan: plan, row: rows[i]}
+		})
+		if err != nil {
+			return nil, err
+		}
+		sorted := make([]joinRow, len(rows))
+		for i, j := range idx {
+			sorted[i] = rows[j]
+		}
+		rows = sorted
+	}
+
+	// 右表的 * 需要列名，未查询过时单独获取
+	for _, s := range plan.steps {
+		if s.star && s.resultColumns == nil {
+			if s.resultColumns, _, err = s.lookup.query(ctx, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res := &Result{Took: took, Total: int64(len(rows))}
+	out, err := plan.project(rows, starKeys)
+	if err != nil {
+		return nil, err
+	}
+	res.Columns = out.Columns
+	res.Rows = pageRows(out.Rows, stmt.Offset, stmt.Limit)
+	return res, nil
+}
+
+// joinBatch 将一批行与右表关联：按关联键去重后分批查询，LEFT JOIN 未关联到的行右表字段为 NULL
+func (e *Engine) joinBatch(ctx context.Context, plan *joinPlan, s *joinStep, batch []joinRow) ([]joinRow, error) {
+	keyOf := func(row joinRow) ([]interface{}, string, error) {
+		values := make([]interface{}, len(s.keys))
+		parts := make([]string, len(s.keys))
+		for i, k := range s.keys {
+			v, err := eval(k.outer, joinEnv{plan: plan, row: row})
+			if err != nil || v == nil {
+				// NULL 不与任何值相等
+				return nil, "", err
+			}
+			values[i], parts[i] = v, toString(v)
+		}
+		return values, strings.Join(parts, "\x00"), nil
+	}
+
+	keys := make([]string, len(batch))
+	var pending [][]interface{}
+	seen := make(map[string]bool)
+	for i, row := range batch {
+		values, key, err := keyOf(row)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+		if values != nil && !seen[key] {
+			seen[key] = true
+			pending = append(pending, values)
+		}
+	}
+
+	matches := make(map[string][]record)
+	for start := 0; start < len(pending); start += e.limits.JoinBatchSize {
+		end := start + e.limits.JoinBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		cols, recs, err := s.lookup.query(ctx, pending[start:end])
+		if err != nil {
+			return nil, err
+		}
+		s.resultColumns = cols
+		for _, rec := range recs {
+			key := s.key(rec)
+			matches[key] = append(matches[key], rec)
+			if len(matches[key]) > e.limits.MaxJoinFanOut {
+				return nil, fmt.Errorf("JOIN %s: key %s matches more than %d rows", s.join.Table.Name,
+					strings.ReplaceAll(key, "\x00", ", "), e.limits.MaxJoinFanOut)
+			}
+		}
+	}
+
+	out := make([]joinRow, 0, len(batch))
+	for i, row := range batch {
+		recs := matches[keys[i]]
+		if keys[i] == "" || len(recs) == 0 {
+			if s.join.Left {
+				out = append(out, row)
+			}
+			continue
+		}
+		for _, rec := range recs {
+			joined := make(joinRow, len(row)+1)
+			for k, v := range row {
+				joined[k] = v
+			}
+			joined[s.alias] = rec
+			out = append(out, joined)
+		}
+	}
+	return out, nil
+}
+
+// project 计算查询字段，* 依次展开左表与各右表的全部字段
+func (p *joinPlan) project(rows []joinRow, starKeys []string) (*Result, error) {
+	type column struct {
+		alias string
+		field string
+		expr  sqlparser.Expr
+	}
+	var cols []column
+	res := &Result{}
+	for _, f := range p.stmt.Fields {
+		star, ok := f.Expr.(*sqlparser.StarExpr)
+		if !ok {
+			cols = append(cols, column{expr: f.Expr})
+			res.Columns = append(res.Columns, f.Name())
+			continue
+		}
+		if star.Table == "" || star.Table == p.leftAlias {
+			for _, k := range starKeys {
+				cols = append(cols, column{alias: p.leftAlias, field: k})
+				res.Columns = append(res.Columns, k)
+			}
+		}
+		for _, s := range p.steps {
+			if star.Table == "" || star.Table == s.alias {
+				for _, k := range s.resultColumns {
+					cols = append(cols, column{alias: s.alias, field: k})
+					res.Columns = append(res.Columns, k)
+				}
+			}
+		}
+	}
+	if star, ok := firstStar(p.stmt); ok && star.Table != "" && p.step(star.Table) == nil && star.Table != p.leftAlias {
+		return nil, fmt.Errorf("unknown table '%s' in %s.*", star.Table, star.Table)
+	}
+
+	res.Rows = make([][]interface{}, len(rows))
+	for i, row := range rows {
+		out := make([]interface{}, len(cols))
+		for j, c := range cols {
+			if c.expr == nil {
+				out[j] = row[c.alias][c.field]
+				continue
+			}
+			v, err := eval(c.expr, joinEnv{plan: p, row: row})
+			if err != nil {
+				return nil, err
+			}
+			out[j] = v
+		}
+		res.Rows[i] = out
+	}
+	return res, nil
+}
+
+func firstStar(stmt *sqlparser.SelectStmt) (*sqlparser.StarExpr, bool) {
+	for _, f := range stmt.Fields {
+		if star, ok := f.Expr.(*sqlparser.StarExpr); ok && star.Table != "" {
+			return star, true
+		}
+	}
+	return nil, false
+}
+
+// key 右表行的关联键
+func (s *joinStep) key(rec record) string {
+	parts := make([]string, len(s.keys))
+	for i, k := range s.keys {
+		parts[i] = toString(s.value(rec, k.inner))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// explain EXPLAIN 中的 JOIN 说明，返回各个 JOIN 与关联后在进程内执行的条件
+func (p *joinPlan) explain() ([]*JoinExplain, string) {
+	out := make([]*JoinExplain, 0, len(p.steps))
+	for _, s := range p.steps {
+		je := &JoinExplain{Type: "INNER", Source: s.source, Table: s.table, On: s.join.On.String()}
+		if s.explain != nil {
+			je = s.explain
+			je.Type, je.Source, je.Table, je.On = "INNER", s.source, s.table, s.join.On.String()
+		}
+		if s.join.Left {
+			je.Type = "LEFT"
+		}
+		if len(s.where) > 0 {
+			je.Where = joinAnd(s.where).String()
+		}
+		out = append(out, je)
+	}
+	residual := ""
+	if p.residual != nil {
+		residual = p.residual.String()
+	}
+	return out, residual
+}
+
+// tree JOIN 的执行计划树，left 为左表查询的计划
+func (p *joinPlan) tree(left *PlanNode) *PlanNode {
+	root := left
+	for _, s := range p.steps {
+		on := onMysql
+		if s.source == SourceES {
+			on = onES
+		}
+		scan := &PlanNode{Op: "scan", On: on, Detail: s.table}
+		if len(s.where) > 0 {
+			scan.Detail += " WHERE " + joinAnd(s.where).String()
+		}
+		typ := "INNER JOIN"
+		if s.join.Left {
+			typ = "LEFT JOIN"
+		}
+		root = &PlanNode{Op: "join", On: onGo, Detail: typ + " ON " + s.join.On.String(), Input: []*PlanNode{root, scan}}
+	}
+	sorted := onES
+	if p.sortAfter {
+		sorted = onGo
+	}
+	return pipe(root,
+		filterNode(p.residual, onGo),
+		sortNode(p.stmt.OrderBy, sorted),
+		limitNode(p.stmt, onGo),
+		projectNode(p.stmt, onGo))
+}
+
+func appendMissing(list, items []string) []string {
+	out := append([]string(nil), list...)
+	for _, item := range items {
+		found := false
+		for _, x := range out {
+			found = found || x == item
+		}
+		if !found {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func flattenAnd(e sqlparser.Expr) []sqlparser.Expr {
+	if b, ok := e.(*sqlparser.BinaryExpr); ok && b.Op == "AND" {
+		return append(flattenAnd(b.Left), flattenAnd(b.Right)...)
+	}
+	return []sqlparser.Expr{e}
+}
+
+func joinAnd(exprs []sqlparser.Expr) sqlparser.Expr {
+	var out sqlparser.Expr
+	for _, e := range exprs {
+		if out == nil {
+			out = e
+		} else {
+			out = &sqlparser.BinaryExpr{Op: "AND", Left: out, Right: e}
+		}
+	}
+	return out
+}
@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// mysqlTablePattern 允许关联的 MySQL 表名：table 或 database.table
+var mysqlTablePattern = regexp.MustCompile(`^[A-Za-z0-9_$]+(\.[A-Za-z0-9_$]+)?$`)
+
+// mysqlLookup 按关联键批量查询 MySQL 表
+type mysqlLookup struct {
+	db      *gorm.DB
+	table   string
+	columns []string      // 需要查询的列，为空时查询全部列
+	keys    []string      // 关联键列
+	where   string        // 下推的过滤条件
+	args    []interface{} // 过滤条件参数
+}
+
+// query 查询关联键在 values 中的行，values 的每一项与 keys 一一对应；values 为空时只返回列名
+func (l *mysqlLookup) query(ctx context.Context, values [][]interface{}) ([]string, []record, error) {
+	q := l.db.WithContext(ctx).Table(l.table)
+	if len(l.columns) > 0 {
+		cols := make([]string, len(l.columns))
+		for i, c := range l.columns {
+			cols[i] = quoteIdent(c)
+		}
+		q = q.Select(strings.Join(cols, ", "))
+	}
+	switch {
+	case len(values) == 0:
+		q = q.Where("1 = 0")
+	case len(l.keys) == 1:
+		flat := make([]interface{}, len(values))
+		for i, v := range values {
+			flat[i] = v[0]
+		}
+		q = q.Where(quoteIdent(l.keys[0])+" IN ?", flat)
+	default:
+		cols := make([]string, len(l.keys))
+		for i, k := range l.keys {
+			cols[i] = quoteIdent(k)
+		}
+		q = q.Where("("+strings.Join(cols, ", ")+") IN ?", values)
+	}
+	if l.where != "" {
+		q = q.Where(l.where, l.args...)
+	}
+
+	rows, err := q.Rows()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanRecords(rows)
+}
+
+// scanRecords 读取全部行，文本列转为字符串，数值列转为 int64 / float64
+func scanRecords(rows *sql.Rows) ([]string, []record, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []record
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		rec := make(record, len(cols))
+		for i, c := range cols {
+			rec[c] = mysqlValue(values[i], types[i])
+		}
+		out = append(out, rec)
+	}
+	return cols, out, rows.Err()
+}
+
+func mysqlValue(v interface{}, t *sql.ColumnType) interface{} {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	s := string(b)
+	switch strings.ToUpper(t.DatabaseTypeName()) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		if i, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return numberResult(float64(i))
+		}
+	case "DECIMAL", "FLOAT", "DOUBLE":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// mysqlCondition 将只引用 alias 表字段的条件渲染为 MySQL 条件，字面量使用占位符。
+// 无法渲染的表达式返回错误，由调用方改为关联后在进程内过滤
+func mysqlCondition(e sqlparser.Expr, alias string) (string, []interface{}, error) {
+	r := &mysqlRenderer{alias: alias}
+	s, err := r.render(e)
+	return s, r.args, err
+}
+
+type mysqlRenderer struct {
+	alias string
+	args  []interface{}
+}
+
+func (r *mysqlRenderer) render(e sqlparser.Expr) (string, error) {
+	switch n := e.(type) {
+	case *sqlparser.ColumnRef:
+		if !strings.HasPrefix(n.Name, r.alias+".") {
+			return "", fmt.Errorf("column %s does not belong to %s", n.Name, r.alias)
+		}
+		return quoteIdent(n.Name[len(r.alias)+1:]), nil
+	case *sqlparser.StringLit:
+		r.args = append(r.args, n.Val)
+		return "?", nil
+	case *sqlparser.NumberLit:
+		r.args = append(r.args, n.Value())
+		return "?", nil
+	case *sqlparser.BoolLit:
+		if n.Val {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case *sqlparser.NullLit:
+		return "NULL", nil
+	case *sqlparser.UnaryExpr:
+		x, err := r.render(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s (%s)", n.Op, x), nil
+	case *sqlparser.BinaryExpr:
+		l, err := r.render(n.Left)
+		if err != nil {
+			return "", err
+		}
+		rt, err := r.render(n.Right)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s %s %s)", l, n.Op, rt), nil
+	case *sqlparser.InExpr:
+		x, err := r.render(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		items := make([]string, 0, len(n.List))
+		for _, item := range n.List {
+			s, err := r.render(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return fmt.Sprintf("%s %sIN (%s)", x, not(n.Not), strings.Join(items, ", ")), nil
+	case *sqlparser.BetweenExpr:
+		x, err := r.render(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		lower, err := r.render(n.Lower)
+		if err != nil {
+			return "", err
+		}
+		upper, err := r.render(n.Upper)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %sBETWEEN %s AND %s", x, not(n.Not), lower, upper), nil
+	case *sqlparser.IsNullExpr:
+		x, err := r.render(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s IS %sNULL", x, not(n.Not)), nil
+	case *sqlparser.LikeExpr:
+		x, err := r.render(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		p, err := r.render(n.Pattern)
+		if err != nil {
+			return "", err
+		}
+		if n.CaseInsensitive {
+			x, p = "LOWER("+x+")", "LOWER("+p+")"
+		}
+		s := fmt.Sprintf("%s %sLIKE %s", x, not(n.Not), p)
+		if n.Escape != "" {
+			r.args = append(r.args, n.Escape)
+			s += " ESCAPE ?"
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("cannot push down to mysql: %s", e.String())
+}
+
+func not(b bool) string {
+	if b {
+		return "NOT "
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Limits 查询资源限制，为 0 的项使用默认值
+type Limits struct {
+	MaxJoinRows   int // JOIN 时最多扫描的 ES 行数
+	JoinBatchSize int // JOIN 时每批查询 MySQL 的关联键个数，同时也是 ES 分页大小
+	MaxJoinFanOut int // JOIN 时每行最多关联的右表行数
+	MaxJoinKeys   int // 关联 ES 索引时最多下推到左表的关联键个数
+
+	MaxSubqueryRows int // 子查询、派生表以及进程内过滤、排序在内存中保存的最大行数
+}
+
+// DefaultLimits 默认资源限制
+var DefaultLimits = Limits{
+	MaxJoinRows:   10000,
+	JoinBatchSize: 500,
+	MaxJoinFanOut: 100,
+	MaxJoinKeys:   10000,
+
+	MaxSubqueryRows: 10000,
+}
+
+// withDefaults 未设置的项使用默认值
+func (l Limits) withDefaults() Limits {
+	if l.MaxJoinRows <= 0 {
+		l.MaxJoinRows = DefaultLimits.MaxJoinRows
+	}
+	if l.JoinBatchSize <= 0 {
+		l.JoinBatchSize = DefaultLimits.JoinBatchSize
+	}
+	if l.MaxJoinFanOut <= 0 {
+		l.MaxJoinFanOut = DefaultLimits.MaxJoinFanOut
+	}
+	if l.MaxJoinKeys <= 0 {
+		l.MaxJoinKeys = DefaultLimits.MaxJoinKeys
+	}
+	if l.MaxSubqueryRows <= 0 {
+		l.MaxSubqueryRows = DefaultLimits.MaxSubqueryRows
+	}
+	return l
+}
+
+// MysqlProvider 获取 MySQL 连接，只在需要关联 MySQL 表时调用
+type MysqlProvider func() (*gorm.DB, error)
+
+// Option 执行引擎选项
+type Option func(*Engine)
+
+// WithMysql 设置 JOIN 使用的 MySQL 连接
+func WithMysql(p MysqlProvider) Option {
+	return func(e *Engine) {
+		e.mysql = p
+	}
+}
+
+// WithLimits 设置查询资源限制
+func WithLimits(l Limits) Option {
+	return func(e *Engine) {
+		e.limits = l.withDefaults()
+	}
+}
+
+// WithJoinTables 设置允许 JOIN 的 MySQL 表，未设置时不允许关联任何 MySQL 表
+func WithJoinTables(tables []string) Option {
+	return func(e *Engine) {
+		e.joinTables = make(map[string]bool, len(tables))
+		for _, t := range tables {
+			e.joinTables[t] = true
+		}
+	}
+}
+
+// WithAdmin 是否允许执行 INSERT / UPDATE / DELETE
+func WithAdmin(admin bool) Option {
+	return func(e *Engine) {
+		e.admin = admin
+	}
+}
+
+// WithDryRun 写语句只返回将受影响的行数，不实际执行
+func WithDryRun(dryRun bool) Option {
+	return func(e *Engine) {
+		e.dryRun = dryRun
+	}
+}
+
+// WithAsync UPDATE / DELETE 以 wait_for_completion=false 执行，立即返回任务
+func WithAsync(async bool) Option {
+	return func(e *Engine) {
+		e.async = async
+	}
+}
+
+// WithOwner 设置请求者，记录为异步任务的发起人
+func WithOwner(owner string) Option {
+	return func(e *Engine) {
+		e.owner = owner
+	}
+}
+
+// WithTaskNotifier 设置任务结束时的通知
+func WithTaskNotifier(n TaskNotifier) Option {
+	return func(e *Engine) {
+		e.notify = n
+	}
+}
+
+// WithCostLimits 设置查询代价的确认与拒绝阈值
+func WithCostLimits(l CostLimits) Option {
+	return func(e *Engine) {
+		e.cost = l
+	}
+}
+
+// WithConfirm 确认执行代价超过确认阈值的查询
+func WithConfirm(confirm bool) Option {
+	return func(e *Engine) {
+		e.confirm = confirm
+	}
+}
+
+// WithTimeout 设置查询的超时时间，同时作为 ES 端的 timeout，超时的分片不影响其余分片返回结果
+func WithTimeout(d time.Duration) Option {
+	return func(e *Engine) {
+		e.timeout = d
+	}
+}
+
+// WithClusters 设置可以通过 FROM cluster.index 或 WithCluster 访问的命名集群
+func WithClusters(names []string, p ClusterProvider) Option {
+	return func(e *Engine) {
+		e.clusters = make(map[string]bool, len(names))
+		for _, n := range names {
+			e.clusters[n] = true
+		}
+		e.clusterClient = p
+	}
+}
+
+// WithCluster 语句中没有集群前缀时访问的集群，为空时使用默认集群
+func WithCluster(name string) Option {
+	return func(e *Engine) {
+		e.cluster = name
+	}
+}
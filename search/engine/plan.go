@@ -0,0 +1,415 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// 算子的执行位置
+const (
+	onES    = "es"
+	onGo    = "go"
+	onMysql = "mysql"
+)
+
+// PlanNode 执行计划中的一个算子，Input 为它的输入算子，EXPLAIN 中从根到叶依次为最后到最先执行的算子
+type PlanNode struct {
+	Op     string      `json:"op"` // search / aggregate / join / scan / union / filter / sort / limit / project
+	On     string      `json:"on"` // 执行位置：es 表示下推到 ES，go 表示在进程内执行，mysql 表示在 MySQL 中执行
+	Detail string      `json:"detail,omitempty"`
+	Input  []*PlanNode `json:"input,omitempty"`
+}
+
+// pipe 将算子依次叠加在 input 之上，返回最后执行的算子，为 nil 的算子被跳过
+func pipe(input *PlanNode, ops ...*PlanNode) *PlanNode {
+	for _, op := range ops {
+		if op != nil {
+			op.Input = []*PlanNode{input}
+			input = op
+		}
+	}
+	return input
+}
+
+func filterNode(cond sqlparser.Expr, on string) *PlanNode {
+	if cond == nil {
+		return nil
+	}
+	return &PlanNode{Op: "filter", On: on, Detail: cond.String()}
+}
+
+func sortNode(orderBy []*sqlparser.OrderItem, on string) *PlanNode {
+	if len(orderBy) == 0 {
+		return nil
+	}
+	items := make([]string, len(orderBy))
+	for i, o := range orderBy {
+		items[i] = o.Expr.String()
+		if o.Desc {
+			items[i] += " DESC"
+		}
+	}
+	return &PlanNode{Op: "sort", On: on, Detail: strings.Join(items, ", ")}
+}
+
+func limitNode(stmt *sqlparser.SelectStmt, on string) *PlanNode {
+	if !stmt.HasLimit() && stmt.Offset == 0 {
+		return nil
+	}
+	detail := fmt.Sprintf("offset %d", stmt.Offset)
+	if stmt.HasLimit() {
+		detail = fmt.Sprintf("limit %d offset %d", stmt.Limit, stmt.Offset)
+	}
+	return &PlanNode{Op: "limit", On: on, Detail: detail}
+}
+
+func projectNode(stmt *sqlparser.SelectStmt, on string) *PlanNode {
+	fields := make([]string, len(stmt.Fields))
+	for i, f := range stmt.Fields {
+		fields[i] = f.Expr.String()
+		if f.Alias != "" {
+			fields[i] += " AS " + f.Alias
+		}
+	}
+	detail := strings.Join(fields, ", ")
+	if stmt.Distinct {
+		detail = "DISTINCT " + detail
+	}
+	return &PlanNode{Op: "project", On: on, Detail: detail}
+}
+
+// selectPlan 单个索引查询的物理计划：能翻译为 DSL 的部分下推到 ES，其余部分在进程内执行
+type selectPlan struct {
+	stmt   *sqlparser.SelectStmt // 原始语句
+	pushed *sqlparser.SelectStmt // 下推到 ES 的语句
+	filter sqlparser.Expr        // 无法翻译为 DSL，在进程内执行的 WHERE 条件
+	sort   bool                  // ORDER BY 无法下推，在进程内排序
+	extra  int                   // 为进程内算子额外读取的字段个数，位于结果列的末尾
+	max    int64                 // 进程内算子最多处理的行数
+}
+
+// inProcess 是否有在进程内执行的算子
+func (p *selectPlan) inProcess() bool {
+	return p.filter != nil || p.sort
+}
+
+// planSelect 逐个判断 WHERE 条件与 ORDER BY 能否下推到 ES。
+// 不能下推时从 ES 读取最多 max 行，在进程内完成过滤、排序与分页
+func planSelect(stmt *sqlparser.SelectStmt, schema *translator.Schema, max int) (*selectPlan, error) {
+	p := &selectPlan{stmt: stmt, pushed: stmt, max: int64(max)}
+	alias := ""
+	if stmt.From != nil {
+		alias = stmt.From.Alias
+	}
+	var pushed, local []sqlparser.Expr
+	if stmt.Where != nil {
+		for _, c := range flattenAnd(stmt.Where) {
+			// 无法在进程内计算的条件（如全文检索）仍交给翻译器，由它报告错误
+			if _, err := translator.BuildQuery(c, alias, schema); err != nil && evaluable(c) {
+				local = append(local, c)
+			} else {
+				pushed = append(pushed, c)
+			}
+		}
+	}
+	aggregate := isAggregateStmt(stmt)
+	if len(local) > 0 && aggregate {
+		return nil, fmt.Errorf("condition cannot be pushed down to elasticsearch in an aggregate query: %s", joinAnd(local).String())
+	}
+	if !aggregate {
+		for _, o := range stmt.OrderBy {
+			if !translator.SortPushable(stmt, o) && evaluable(o.Expr) {
+				p.sort = true
+			}
+		}
+	}
+	p.filter = joinAnd(local)
+	if !p.inProcess() {
+		return p, nil
+	}
+
+	s := *stmt
+	s.Where = joinAnd(pushed)
+	s.Offset, s.Limit = 0, p.max
+	if p.sort {
+		s.OrderBy = nil
+	}
+	// 进程内算子引用的字段不在 SELECT 中时额外读取，输出前去掉
+	names := make(map[string]bool)
+	for _, f := range stmt.Fields {
+		names[f.Name()] = true
+	}
+	var refs []sqlparser.Expr
+	if p.filter != nil {
+		refs = append(refs, p.filter)
+	}
+	if p.sort {
+		for _, o := range stmt.OrderBy {
+			refs = append(refs, o.Expr)
+		}
+	}
+	s.Fields = append([]*sqlparser.SelectField(nil), stmt.Fields...)
+	for _, x := range refs {
+		sqlparser.Walk(x, func(n sqlparser.Expr) bool {
+			if c, ok := n.(*sqlparser.ColumnRef); ok && !names[c.Name] {
+				names[c.Name] = true
+				s.Fields = append(s.Fields, &sqlparser.SelectField{Expr: c, Raw: c.Name})
+				p.extra++
+			}
+			return true
+		})
+	}
+	p.pushed = &s
+	return p, nil
+}
+
+// evaluable 表达式能否在进程内计算
+func evaluable(e sqlparser.Expr) bool {
+	ok := true
+	sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+		switch x := n.(type) {
+		case *sqlparser.FuncCall:
+			ok = ok && translator.IsScalarFunc(x) && translator.CheckScalarCall(x) == nil
+		case *sqlparser.ColumnRef:
+			// _score 只存在于 ES 中，由翻译器报告错误
+			ok = ok && x.Name != translator.ScoreField && !strings.HasSuffix(x.Name, "."+translator.ScoreField)
+		case *sqlparser.StringLit, *sqlparser.NumberLit, *sqlparser.BoolLit, *sqlparser.NullLit,
+			*sqlparser.UnaryExpr, *sqlparser.BinaryExpr, *sqlparser.InExpr,
+			*sqlparser.BetweenExpr, *sqlparser.IsNullExpr, *sqlparser.LikeExpr, *sqlparser.CaseExpr:
+		default:
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// isAggregateStmt 查询是否以聚合执行：GROUP BY、DISTINCT 或字段中有聚合函数、窗口函数
+func isAggregateStmt(stmt *sqlparser.SelectStmt) bool {
+	if len(stmt.GroupBy) > 0 || stmt.Distinct || stmt.Having != nil {
+		return true
+	}
+	found := false
+	for _, f := range stmt.Fields {
+		sqlparser.Walk(f.Expr, func(n sqlparser.Expr) bool {
+			found = found || translator.IsAggregateFunc(n) || translator.IsWindowFunc(n)
+			return !found
+		})
+	}
+	return found
+}
+
+// tree 执行计划树，req 为下推语句翻译后的请求
+func (p *selectPlan) tree(req *translator.Request) *PlanNode {
+	detail := req.Index
+	if p.pushed.Where != nil {
+		detail += " WHERE " + p.pushed.Where.String()
+	}
+	search := &PlanNode{Op: "search", On: onES, Detail: detail}
+	project := onES
+	for _, c := range req.Columns {
+		if c.Kind == translator.ColumnComputed {
+			project = onGo
+		}
+	}
+	if req.Aggregate {
+		var groups []string
+		for _, g := range p.stmt.GroupBy {
+			groups = append(groups, g.String())
+		}
+		agg := &PlanNode{Op: "aggregate", On: onES}
+		if len(groups) > 0 {
+			agg.Detail = "GROUP BY " + strings.Join(groups, ", ")
+		}
+		return pipe(search, agg,
+			filterNode(p.stmt.Having, onGo),
+			sortNode(p.stmt.OrderBy, onGo),
+			limitNode(p.stmt, onGo),
+			projectNode(p.stmt, project))
+	}
+	if !p.inProcess() {
+		return pipe(search,
+			sortNode(p.stmt.OrderBy, onES),
+			limitNode(p.stmt, onES),
+			projectNode(p.stmt, project))
+	}
+	search.Detail += fmt.Sprintf(" (up to %d rows)", p.max)
+	order := onES
+	if p.sort {
+		order = onGo
+	}
+	return pipe(search,
+		filterNode(p.filter, onGo),
+		sortNode(p.stmt.OrderBy, order),
+		limitNode(p.stmt, onGo),
+		projectNode(p.stmt, project))
+}
+
+// run 在 ES 返回的行上执行进程内的过滤、排序与分页
+func (p *selectPlan) run(alias string, res *Result) (*Result, error) {
+	if res.Total > p.max {
+		return nil, fmt.Errorf("query needs more than %d rows to be filtered or sorted in memory, add a more selective WHERE or raise query.max-subquery-rows: %s", p.max, p.stmt.String())
+	}
+	rs := newRowSet(alias, res.Columns, res.Rows)
+	if err := rs.filter(p.filter); err != nil {
+		return nil, err
+	}
+	if p.sort {
+		if err := rs.sort(p.stmt.OrderBy); err != nil {
+			return nil, err
+		}
+	}
+	n := len(res.Columns) - p.extra
+	for i, row := range rs.rows {
+		rs.rows[i] = row[:n]
+	}
+	return &Result{
+		Columns: res.Columns[:n],
+		Rows:    pageRows(rs.rows, p.stmt.Offset, p.stmt.Limit),
+		Total:   int64(len(rs.rows)),
+		Took:    res.Took,
+	}, nil
+}
+
+// rowSet 进程内算子（过滤、排序、投影、分页）处理的一组行，字段按列名引用，可以带表别名
+type rowSet struct {
+	alias string
+	index map[string]int
+	rows  [][]interface{}
+}
+
+func newRowSet(alias string, columns []string, rows [][]interface{}) *rowSet {
+	index := make(map[string]int, len(columns))
+	for i, c := range columns {
+		if _, ok := index[c]; !ok {
+			index[c] = i
+		}
+	}
+	return &rowSet{alias: alias, index: index, rows: rows}
+}
+
+func (s *rowSet) env(row []interface{}) evalEnv {
+	return derivedEnv{alias: s.alias, index: s.index, row: row}
+}
+
+// filter 只保留条件为真的行
+func (s *rowSet) filter(cond sqlparser.Expr) error {
+	if cond == nil {
+		return nil
+	}
+	var kept [][]interface{}
+	for _, row := range s.rows {
+		v, err := eval(cond, s.env(row))
+		if err != nil {
+			return err
+		}
+		if v != nil && truthy(v) {
+			kept = append(kept, row)
+		}
+	}
+	s.rows = kept
+	return nil
+}
+
+// sort 按 ORDER BY 稳定排序
+func (s *rowSet) sort(orderBy []*sqlparser.OrderItem) error {
+	idx, err := sortIndex(len(s.rows), orderBy, func(i int) evalEnv { return s.env(s.rows[i]) })
+	if err != nil || idx == nil {
+		return err
+	}
+	sorted := make([][]interface{}, len(s.rows))
+	for i, j := range idx {
+		sorted[i] = s.rows[j]
+	}
+	s.rows = sorted
+	return nil
+}
+
+// project 计算输出列，distinct 时去掉重复的行
+func (s *rowSet) project(exprs []sqlparser.Expr, distinct bool) ([][]interface{}, error) {
+	out := make([][]interface{}, 0, len(s.rows))
+	seen := make(map[string]bool)
+	for _, row := range s.rows {
+		projected := make([]interface{}, len(exprs))
+		for i, x := range exprs {
+			v, err := eval(x, s.env(row))
+			if err != nil {
+				return nil, err
+			}
+			projected[i] = v
+		}
+		if distinct {
+			key := fmt.Sprintf("%#v", projected)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		out = append(out, projected)
+	}
+	return out, nil
+}
+
+// search 执行单个索引的查询
+func (e *Engine) search(ctx context.Context, stmt *sqlparser.SelectStmt) (*Result, error) {
+	schema, err := e.schema(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	p, err := planSelect(stmt, schema, e.limits.MaxSubqueryRows)
+	if err != nil {
+		return nil, err
+	}
+	req, err := translator.Translate(p.pushed, schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkCost(ctx, req); err != nil {
+		return nil, err
+	}
+	resp, err := e.doSearch(ctx, req.Index, req.Source)
+	if err != nil {
+		return nil, err
+	}
+	if req.Aggregate {
+		return aggregateResult(req, resp)
+	}
+	res, err := hitsResult(req, resp)
+	if err != nil || !p.inProcess() {
+		return res, err
+	}
+	return p.run(req.Alias, res)
+}
+
+// explainSearch 单个索引查询的 DSL 与执行计划
+func (e *Engine) explainSearch(ctx context.Context, stmt *sqlparser.SelectStmt) (*Explain, error) {
+	schema, err := e.schema(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	p, err := planSelect(stmt, schema, e.limits.MaxSubqueryRows)
+	if err != nil {
+		return nil, err
+	}
+	req, err := translator.Translate(p.pushed, schema)
+	if err != nil {
+		return nil, err
+	}
+	dsl, err := req.DSL()
+	if err != nil {
+		return nil, err
+	}
+	cost, err := e.estimateCost(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ex := &Explain{Index: req.Index, DSL: dsl, Plan: p.tree(req), Cost: cost}
+	if p.filter != nil {
+		ex.Filter = p.filter.String()
+	}
+	return ex, nil
+}
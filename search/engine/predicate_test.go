@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+
+	testcommon "lium-product/es-search/tests/common_test"
+)
+
+// TestPredicateDSL 谓词到 ES 查询的映射，断言发送到 MockServer 的 query
+func TestPredicateDSL(t *testing.T) {
+	mockServer := testcommon.NewMockServer()
+	defer mockServer.Close()
+	mockServer.Register("/t/_search", []*elastic.SearchHit{})
+
+	tests := []struct {
+		name  string
+		where string
+		want  string
+	}{
+		// LIKE
+		{
+			name:  "like wildcard",
+			where: "name LIKE 'a%b_c'",
+			want:  `{"wildcard":{"name":{"value":"a*b?c"}}}`,
+		},
+		{
+			name:  "like prefix",
+			where: "name LIKE 'abc%'",
+			want:  `{"prefix":{"name":"abc"}}`,
+		},
+		{
+			name:  "like without wildcard",
+			where: "name LIKE 'abc'",
+			want:  `{"term":{"name":"abc"}}`,
+		},
+		{
+			name:  "like any",
+			where: "name LIKE '%%'",
+			want:  `{"exists":{"field":"name"}}`,
+		},
+		{
+			name:  "like escapes es wildcard chars",
+			where: `name LIKE '%a*b?%'`,
+			want:  `{"wildcard":{"name":{"value":"*a\\*b\\?*"}}}`,
+		},
+		{
+			name:  "like backslash escape",
+			where: `name LIKE '100\%%'`,
+			want:  `{"prefix":{"name":"100%"}}`,
+		},
+		{
+			name:  "like custom escape",
+			where: `name LIKE '%a!_b%' ESCAPE '!'`,
+			want:  `{"wildcard":{"name":{"value":"*a_b*"}}}`,
+		},
+		{
+			name:  "ilike",
+			where: "name ILIKE '%Foo%'",
+			want:  `{"wildcard":{"name":{"value":"*Foo*","case_insensitive":true}}}`,
+		},
+		{
+			name:  "not like excludes missing",
+			where: "name NOT LIKE '%a%'",
+			want: `{"bool":{"filter":{"exists":{"field":"name"}},
+				"must_not":{"wildcard":{"name":{"value":"*a*"}}}}}`,
+		},
+		// IN
+		{
+			name:  "in",
+			where: "status IN (200, 301)",
+			want:  `{"terms":{"status":[200,301]}}`,
+		},
+		{
+			name:  "in ignores null",
+			where: "status IN (200, NULL)",
+			want:  `{"terms":{"status":[200]}}`,
+		},
+		{
+			name:  "not in",
+			where: "status NOT IN ('a', 'b')",
+			want:  `{"bool":{"filter":{"exists":{"field":"status"}},"must_not":{"terms":{"status":["a","b"]}}}}`,
+		},
+		{
+			name:  "not in with null",
+			where: "status NOT IN (1, NULL)",
+			want:  `{"match_none":{}}`,
+		},
+		// BETWEEN
+		{
+			name:  "between",
+			where: "ts BETWEEN '2024-01-01' AND '2024-01-31'",
+			want: `{"range":{"ts":{"from":"2024-01-01","include_lower":true,
+				"include_upper":true,"to":"2024-01-31"}}}`,
+		},
+		{
+			name:  "not between",
+			where: "n NOT BETWEEN 1 AND 5",
+			want: `{"bool":{"minimum_should_match":"1","should":[
+				{"range":{"n":{"from":null,"include_lower":true,"include_upper":false,"to":1}}},
+				{"range":{"n":{"from":5,"include_lower":false,"include_upper":true,"to":null}}}]}}`,
+		},
+		{
+			name:  "not between null bound",
+			where: "n NOT BETWEEN NULL AND 5",
+			want: `{"bool":{"minimum_should_match":"1","should":[{"match_none":{}},
+				{"range":{"n":{"from":5,"include_lower":false,"include_upper":true,"to":null}}}]}}`,
+		},
+		// IS NULL
+		{
+			name:  "is null",
+			where: "city IS NULL",
+			want:  `{"bool":{"must_not":{"exists":{"field":"city"}}}}`,
+		},
+		{
+			name:  "is not null",
+			where: "city IS NOT NULL",
+			want:  `{"exists":{"field":"city"}}`,
+		},
+		// 比较与 NOT
+		{
+			name:  "not equal excludes missing",
+			where: "city != 'beijing'",
+			want:  `{"bool":{"filter":{"exists":{"field":"city"}},"must_not":{"term":{"city":"beijing"}}}}`,
+		},
+		{
+			name:  "equal null",
+			where: "city = NULL",
+			want:  `{"match_none":{}}`,
+		},
+		{
+			name:  "not pushed down to leaf",
+			where: "NOT (city = 'a' OR n > 3)",
+			want: `{"bool":{"filter":[
+				{"bool":{"filter":{"exists":{"field":"city"}},"must_not":{"term":{"city":"a"}}}},
+				{"range":{"n":{"from":null,"include_lower":true,"include_upper":true,"to":3}}}]}}`,
+		},
+		{
+			name:  "not is null",
+			where: "NOT city IS NULL",
+			want:  `{"exists":{"field":"city"}}`,
+		},
+		{
+			name:  "not match",
+			where: "NOT MATCH(title, 'foo')",
+			want:  `{"bool":{"must_not":{"match":{"title":{"query":"foo"}}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(testcommon.GetElasticClient()).Execute(context.Background(), "SELECT * FROM t WHERE "+tt.where)
+			if !assert.NoError(t, err) {
+				return
+			}
+			var body struct {
+				Query struct {
+					Bool struct {
+						Filter json.RawMessage `json:"filter"`
+						Must   json.RawMessage `json:"must"`
+					} `json:"bool"`
+				} `json:"query"`
+			}
+			assert.NoError(t, json.Unmarshal(mockServer.LastRequest().Body, &body))
+			got := body.Query.Bool.Filter
+			if got == nil {
+				got = body.Query.Bool.Must
+			}
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// reindexBatchSize 进程内计算时每批读取与写入的文档数
+const reindexBatchSize = 1000
+
+// translateReindex 检查权限并翻译 INSERT ... SELECT，返回的查询语句已替换子查询并去掉 es. 前缀
+func (e *Engine) translateReindex(ctx context.Context, s *sqlparser.InsertStmt) (*translator.ReindexRequest, *sqlparser.SelectStmt, error) {
+	if !e.admin {
+		return nil, nil, fmt.Errorf("%w: write statements require admin permission", ErrPermissionDenied)
+	}
+	dest, err := writeIndex(s.Table)
+	if err != nil {
+		return nil, nil, err
+	}
+	sel, err := e.resolveSubqueries(ctx, s.Select)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sel.From != nil && sel.From.Select == nil && len(sel.Joins) == 0 {
+		if sel, err = esStatement(sel); err != nil {
+			return nil, nil, err
+		}
+	}
+	c := *s
+	c.Table, c.Select = dest, sel
+	schema, err := e.schema(ctx, sel)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := translator.TranslateReindex(&c, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	return req, sel, nil
+}
+
+// insertSelect 执行 INSERT ... SELECT：能生成 painless 脚本时使用 _reindex 任务，否则在本进程内分批读取源索引、
+// 计算字段后批量写入。两种方式都以异步任务执行
+func (e *Engine) insertSelect(ctx context.Context, s *sqlparser.InsertStmt, sql string) (*Result, error) {
+	req, sel, err := e.translateReindex(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if e.client == nil {
+		return nil, fmt.Errorf("elasticsearch client is not initialized")
+	}
+	if e.dryRun {
+		n, err := e.sourceCount(ctx, req, sel)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Affected: n, DryRun: true}, nil
+	}
+	if !req.Fallback {
+		body, err := req.Body()
+		if err != nil {
+			return nil, err
+		}
+		return e.startTask(ctx, "reindex", req.Dest, sql, func() (*elastic.StartTaskResult, error) {
+			return esclient.Call(ctx, e.client, e.client.Reindex().Body(body).Refresh("true").WaitForCompletion(false).DoAsync)
+		})
+	}
+	return e.startLocalTask(ctx, "reindex", req.Dest, sql, func(ctx context.Context, progress func(total, affected int64)) error {
+		return e.copyDocuments(ctx, req, sel, progress)
+	})
+}
+
+// sourceCount 源索引中将被写入的文档数
+func (e *Engine) sourceCount(ctx context.Context, req *translator.ReindexRequest, sel *sqlparser.SelectStmt) (int64, error) {
+	n, err := esclient.Call(ctx, e.client, e.client.Count(req.Source).Query(req.Query).Do)
+	if err != nil {
+		return 0, err
+	}
+	n -= sel.Offset
+	if n < 0 {
+		n = 0
+	}
+	if sel.HasLimit() && n > sel.Limit {
+		n = sel.Limit
+	}
+	return n, nil
+}
+
+// copyDocuments 分批读取源索引，在进程内计算字段后批量写入目标索引，保留源文档的 _id
+func (e *Engine) copyDocuments(ctx context.Context, req *translator.ReindexRequest, sel *sqlparser.SelectStmt,
+	progress func(total, affected int64)) error {
+	total, err := e.sourceCount(ctx, req, sel)
+	if err != nil {
+		return err
+	}
+	progress(total, 0)
+	if total == 0 {
+		return nil
+	}
+
+	all := *sel
+	all.Fields = []*sqlparser.SelectField{{Expr: &sqlparser.StarExpr{}, Raw: "*"}}
+	all.Limit, all.Offset = -1, 0
+	schema, err := e.schema(ctx, &all)
+	if err != nil {
+		return err
+	}
+	tr, err := translator.Translate(&all, schema)
+	if err != nil {
+		return err
+	}
+	skip := sel.Offset
+	var done int64
+	return e.scanAll(ctx, tr.Index, tr.Source, reindexBatchSize, func(hits []*elastic.SearchHit) (bool, error) {
+		bulk := e.client.Bulk().Index(req.Dest).Refresh("true")
+		for _, hit := range hits {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if done+int64(bulk.NumberOfActions()) >= total {
+				break
+			}
+			doc, id, err := reindexDocument(req, hit)
+			if err != nil {
+				return false, err
+			}
+			bulk.Add(elastic.NewBulkIndexRequest().Id(id).Doc(doc))
+		}
+		if bulk.NumberOfActions() == 0 {
+			return done < total, nil
+		}
+		n := int64(bulk.NumberOfActions())
+		br, err := e.doBulk(ctx, bulk)
+		if err != nil {
+			return false, err
+		}
+		if failed := br.Failed(); len(failed) > 0 {
+			reason := ""
+			if failed[0].Error != nil {
+				reason = failed[0].Error.Reason
+			}
+			return false, fmt.Errorf("%d of %d documents failed, first error: %s", len(failed), n, reason)
+		}
+		done += n
+		progress(total, done)
+		return done < total, nil
+	})
+}
+
+// sourceEnv 源文档的求值上下文
+type sourceEnv struct {
+	alias string
+	id    string
+	src   map[string]interface{}
+}
+
+func (env sourceEnv) lookup(e sqlparser.Expr) (interface{}, bool) {
+	c, ok := e.(*sqlparser.ColumnRef)
+	if !ok {
+		return nil, false
+	}
+	name := c.Name
+	if env.alias != "" {
+		name = strings.TrimPrefix(name, env.alias+".")
+	}
+	if name == "_id" {
+		return env.id, true
+	}
+	return lookup(env.src, name), true
+}
+
+// reindexDocument 按 SELECT 的字段构造目标文档与 _id
+func reindexDocument(req *translator.ReindexRequest, hit *elastic.SearchHit) (map[string]interface{}, string, error) {
+	src, err := decodeSource(hit.Source)
+	if err != nil {
+		return nil, "", err
+	}
+	env := sourceEnv{alias: req.Alias, id: hit.Id, src: src}
+	doc := make(map[string]interface{})
+	if req.Star {
+		for k, v := range src {
+			doc[k] = v
+		}
+	}
+	id := hit.Id
+	for i, c := range req.Columns {
+		v, err := eval(req.Exprs[i], env)
+		if err != nil {
+			return nil, "", err
+		}
+		if c == "_id" {
+			if v == nil {
+				return nil, "", fmt.Errorf("_id cannot be NULL for document %s", hit.Id)
+			}
+			id = toString(v)
+			continue
+		}
+		translator.SetPath(doc, c, v)
+	}
+	return doc, id, nil
+}
@@ -0,0 +1,431 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/translator"
+)
+
+// hitsResult 将非聚合查询的命中文档转为行
+func hitsResult(req *translator.Request, resp *elastic.SearchResult) (*Result, error) {
+	res := &Result{Took: resp.TookInMillis, Total: resp.TotalHits()}
+	var hits []*elastic.SearchHit
+	if resp.Hits != nil {
+		hits = resp.Hits.Hits
+	}
+
+	sources := make([]map[string]interface{}, len(hits))
+	for i, hit := range hits {
+		src, err := decodeSource(hit.Source)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = src
+	}
+
+	// SELECT * 按首次出现的顺序展开 _source 中的字段
+	var starKeys []string
+	for _, c := range req.Columns {
+		if c.Kind == translator.ColumnStar {
+			starKeys = sourceKeys(sources)
+			break
+		}
+	}
+	for _, c := range req.Columns {
+		if c.Kind == translator.ColumnStar {
+			res.Columns = append(res.Columns, starKeys...)
+		} else {
+			res.Columns = append(res.Columns, c.Name)
+		}
+	}
+
+	res.Rows = make([][]interface{}, 0, len(hits))
+	for i, hit := range hits {
+		row := make([]interface{}, 0, len(res.Columns))
+		for _, c := range req.Columns {
+			switch c.Kind {
+			case translator.ColumnStar:
+				for _, k := range starKeys {
+					row = append(row, sources[i][k])
+				}
+			case translator.ColumnMeta:
+				row = append(row, metaValue(hit, c.Field))
+			case translator.ColumnHighlight:
+				if fragments, ok := hit.Highlight[c.Field]; ok {
+					row = append(row, fragments)
+				} else {
+					row = append(row, nil)
+				}
+			case translator.ColumnScript:
+				row = append(row, scriptFieldValue(hit, c.Field))
+			case translator.ColumnComputed:
+				v, err := eval(c.Expr, sourceEnv{alias: req.Alias, id: hit.Id, src: sources[i]})
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, v)
+			default:
+				row = append(row, lookup(sources[i], c.Field))
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res, nil
+}
+
+// scriptFieldValue script_fields 的计算结果，ES 以数组返回，单个值时取出
+func scriptFieldValue(hit *elastic.SearchHit, name string) interface{} {
+	values, _ := hit.Fields[name].([]interface{})
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		if f, ok := values[0].(float64); ok {
+			return numberResult(f)
+		}
+		return values[0]
+	}
+	return values
+}
+
+func metaValue(hit *elastic.SearchHit, field string) interface{} {
+	switch field {
+	case "_id":
+		return hit.Id
+	case "_index":
+		return hit.Index
+	case translator.ScoreField:
+		if hit.Score == nil || math.IsNaN(*hit.Score) {
+			return nil
+		}
+		return *hit.Score
+	}
+	return nil
+}
+
+// decodeSource 解析 _source，数字统一转为 int64 或 float64
+func decodeSource(raw json.RawMessage) (map[string]interface{}, error) {
+	if len(raw) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var src map[string]interface{}
+	if err := dec.Decode(&src); err != nil {
+		return nil, err
+	}
+	return normalize(src).(map[string]interface{}), nil
+}
+
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = normalize(item)
+		}
+		return t
+	case []interface{}:
+		for i, item := range t {
+			t[i] = normalize(item)
+		}
+		return t
+	}
+	return v
+}
+
+// lookup 按点号路径读取字段，兼容扁平的 "a.b" 键与嵌套对象，数组中的对象字段会被收集为数组
+func lookup(src map[string]interface{}, path string) interface{} {
+	if v, ok := src[path]; ok {
+		return v
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		v, ok := src[path[:i]]
+		if !ok {
+			continue
+		}
+		rest := path[i+1:]
+		switch t := v.(type) {
+		case map[string]interface{}:
+			return lookup(t, rest)
+		case []interface{}:
+			var values []interface{}
+			for _, item := range t {
+				if m, ok := item.(map[string]interface{}); ok {
+					if x := lookup(m, rest); x != nil {
+						values = append(values, x)
+					}
+				}
+			}
+			if len(values) > 0 {
+				return values
+			}
+		}
+	}
+	return nil
+}
+
+func sourceKeys(sources []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, src := range sources {
+		var fresh []string
+		for k := range src {
+			if !seen[k] {
+				seen[k] = true
+				fresh = append(fresh, k)
+			}
+		}
+		sort.Strings(fresh)
+		keys = append(keys, fresh...)
+	}
+	return keys
+}
+
+// aggregateResult 将聚合结果展开为行，并在进程内执行 HAVING、ORDER BY 与分页
+func aggregateResult(req *translator.Request, resp *elastic.SearchResult) (*Result, error) {
+	groups := groupColumns(req)
+	rows := make([][]interface{}, 0)
+	var walk func(aggs elastic.Aggregations, level int, keys []interface{}, docCount int64) error
+	walk = func(aggs elastic.Aggregations, level int, keys []interface{}, docCount int64) error {
+		if level == len(groups) {
+			row := make([]interface{}, len(req.Columns))
+			for i, c := range req.Columns {
+				switch c.Kind {
+				case translator.ColumnGroup:
+					row[i] = keys[c.Level]
+				case translator.ColumnCount:
+					row[i] = docCount
+				case translator.ColumnMetric:
+					v, err := metricValue(aggs, c)
+					if err != nil {
+						return err
+					}
+					row[i] = v
+				}
+			}
+			// 引用分组键与聚合结果的表达式
+			for i, c := range req.Columns {
+				if c.Kind == translator.ColumnComputed {
+					v, err := eval(c.Expr, rowEnv{cols: req.Columns, row: row})
+					if err != nil {
+						return err
+					}
+					row[i] = v
+				}
+			}
+			rows = append(rows, row)
+			return nil
+		}
+		parent, name, ok := descend(aggs, groups[level].AggNames())
+		if !ok {
+			return nil
+		}
+		terms, ok := parent.Terms(name)
+		if !ok {
+			return nil
+		}
+		for _, b := range terms.Buckets {
+			if err := walk(b.Aggregations, level+1, append(keys, bucketKey(b)), b.DocCount); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	aggs := resp.Aggregations
+	if aggs == nil {
+		aggs = elastic.Aggregations{}
+	}
+	if err := walk(aggs, 0, nil, resp.TotalHits()); err != nil {
+		return nil, err
+	}
+
+	rows, err := filterRows(req.Columns, rows, req.Having)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortRows(req.Columns, rows, req.OrderBy); err != nil {
+		return nil, err
+	}
+	total := int64(len(rows))
+	rows = pageRows(rows, req.Offset, req.Limit)
+
+	res := &Result{Took: resp.TookInMillis, Total: total}
+	res.Columns, res.Rows = project(req.Columns, rows)
+	return res, nil
+}
+
+// groupColumns 按层级返回分组列
+func groupColumns(req *translator.Request) []*translator.Column {
+	var groups []*translator.Column
+	seen := make(map[string]bool)
+	for _, c := range req.Columns {
+		if c.Kind == translator.ColumnGroup && !seen[c.Agg] {
+			seen[c.Agg] = true
+			groups = append(groups, c)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Level < groups[j].Level })
+	return groups
+}
+
+func bucketKey(b *elastic.AggregationBucketKeyItem) interface{} {
+	if b.KeyAsString != nil {
+		return *b.KeyAsString
+	}
+	if f, ok := b.Key.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return b.Key
+}
+
+// descend 沿 nested / reverse_nested / filter 等单桶聚合下降，返回最内层聚合所在的容器与名称
+func descend(aggs elastic.Aggregations, path []string) (elastic.Aggregations, string, bool) {
+	for _, name := range path[:len(path)-1] {
+		single, ok := aggs.Filter(name)
+		if !ok {
+			return nil, "", false
+		}
+		aggs = single.Aggregations
+	}
+	return aggs, path[len(path)-1], true
+}
+
+// metricValue 读取指标聚合结果：单值指标返回数值，PERCENTILES / STATS 等多值指标返回对象
+func metricValue(aggs elastic.Aggregations, c *translator.Column) (interface{}, error) {
+	aggs, name, ok := descend(aggs, c.AggNames())
+	if !ok {
+		return nil, nil
+	}
+	raw, ok := aggs[name]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	switch c.Func {
+	case "PERCENTILE", "PERCENTILES":
+		return percentileValue(raw, c)
+	case "STATS", "EXTENDED_STATS":
+		return decodeSource(raw)
+	case "FIRST", "LAST":
+		return topHitValue(raw, c.Field)
+	}
+
+	var v struct {
+		Value         *float64 `json:"value"`
+		ValueAsString *string  `json:"value_as_string"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	if v.Value == nil {
+		return nil, nil
+	}
+	if strings.HasPrefix(c.Func, "COUNT") {
+		return int64(*v.Value), nil
+	}
+	// 日期字段的 MIN / MAX 返回格式化后的值
+	if v.ValueAsString != nil && (c.Func == "MIN" || c.Func == "MAX") {
+		return *v.ValueAsString, nil
+	}
+	return *v.Value, nil
+}
+
+// percentileValue PERCENTILE 返回单个值，PERCENTILES 返回以百分位为键的对象
+func percentileValue(raw json.RawMessage, c *translator.Column) (interface{}, error) {
+	var v struct {
+		Values map[string]*float64 `json:"values"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	// ES 返回的键为 "95.0" 形式，按数值匹配
+	byPercent := make(map[float64]*float64, len(v.Values))
+	for k, x := range v.Values {
+		if p, err := strconv.ParseFloat(k, 64); err == nil {
+			byPercent[p] = x
+		}
+	}
+	value := func(p float64) interface{} {
+		if x := byPercent[p]; x != nil && !math.IsNaN(*x) {
+			return *x
+		}
+		return nil
+	}
+	if c.Func == "PERCENTILE" {
+		return value(c.Percents[0]), nil
+	}
+	out := make(map[string]interface{}, len(c.Percents))
+	for _, p := range c.Percents {
+		out[strconv.FormatFloat(p, 'f', -1, 64)] = value(p)
+	}
+	return out, nil
+}
+
+// topHitValue FIRST / LAST 取 top_hits 第一条命中中的字段值
+func topHitValue(raw json.RawMessage, field string) (interface{}, error) {
+	var v struct {
+		Hits struct {
+			Hits []struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	if len(v.Hits.Hits) == 0 {
+		return nil, nil
+	}
+	src, err := decodeSource(v.Hits.Hits[0].Source)
+	if err != nil {
+		return nil, err
+	}
+	return lookup(src, field), nil
+}
+
+func pageRows(rows [][]interface{}, offset, limit int64) [][]interface{} {
+	if offset >= int64(len(rows)) {
+		return rows[:0]
+	}
+	rows = rows[offset:]
+	if limit >= 0 && limit < int64(len(rows)) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// project 去掉隐藏列
+func project(cols []*translator.Column, rows [][]interface{}) ([]string, [][]interface{}) {
+	var names []string
+	var idx []int
+	for i, c := range cols {
+		if !c.Hidden {
+			names = append(names, c.Name)
+			idx = append(idx, i)
+		}
+	}
+	out := make([][]interface{}, len(rows))
+	for r, row := range rows {
+		out[r] = make([]interface{}, len(idx))
+		for i, j := range idx {
+			out[r][i] = row[j]
+		}
+	}
+	return names, out
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/metrics"
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// schemaTTL 索引结构缓存时间
+const schemaTTL = time.Minute
+
+type schemaEntry struct {
+	schema  *translator.Schema
+	expires time.Time
+}
+
+var (
+	schemaMu    sync.Mutex
+	schemaCache = make(map[string]schemaEntry)
+)
+
+// schema 获取查询所需的索引结构。只有引用了带点号的字段时才读取 mapping；
+// 读取失败时报错，否则 nested 字段会被当作普通字段翻译，跨嵌套对象匹配得到错误的结果
+func (e *Engine) schema(ctx context.Context, stmt *sqlparser.SelectStmt) (*translator.Schema, error) {
+	if stmt.From == nil || !hasDottedField(stmt) {
+		return nil, nil
+	}
+	return e.indexSchema(ctx, stmt.From.Name)
+}
+
+// indexSchema 读取索引的 nested 路径，结果按集群与索引缓存
+func (e *Engine) indexSchema(ctx context.Context, index string) (*translator.Schema, error) {
+	if e.client == nil {
+		return nil, nil
+	}
+	key := e.cluster + "/" + index
+	schemaMu.Lock()
+	entry, ok := schemaCache[key]
+	schemaMu.Unlock()
+	hit := ok && time.Now().Before(entry.expires)
+	metrics.CacheLookup("schema", hit)
+	if hit {
+		return entry.schema, nil
+	}
+
+	mappings, err := esclient.Call(ctx, e.client, e.client.GetMapping().Index(index).Do)
+	if err != nil {
+		return nil, fmt.Errorf("read mapping of %s failed: %w", index, err)
+	}
+	seen := make(map[string]bool)
+	schema := &translator.Schema{}
+	for _, m := range mappings {
+		idx, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mapping, _ := idx["mappings"].(map[string]interface{})
+		collectNested(mapping, "", func(path string) {
+			if !seen[path] {
+				seen[path] = true
+				schema.NestedPaths = append(schema.NestedPaths, path)
+			}
+		})
+	}
+	sort.Strings(schema.NestedPaths)
+
+	schemaMu.Lock()
+	schemaCache[key] = schemaEntry{schema: schema, expires: time.Now().Add(schemaTTL)}
+	schemaMu.Unlock()
+	return schema, nil
+}
+
+// collectNested 遍历 mapping 的 properties，收集 type 为 nested 的字段路径
+func collectNested(mapping map[string]interface{}, prefix string, found func(string)) {
+	props, _ := mapping["properties"].(map[string]interface{})
+	for name, v := range props {
+		field, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := prefix + name
+		if field["type"] == "nested" {
+			found(path)
+		}
+		collectNested(field, path+".", found)
+	}
+}
+
+// hasDottedField 语句中是否引用了带点号的字段（表别名前缀除外）
+func hasDottedField(stmt *sqlparser.SelectStmt) bool {
+	alias := ""
+	if stmt.From != nil {
+		alias = stmt.From.Alias
+	}
+	exprs := []sqlparser.Expr{stmt.Where, stmt.Having}
+	for _, f := range stmt.Fields {
+		exprs = append(exprs, f.Expr)
+	}
+	exprs = append(exprs, stmt.GroupBy...)
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+	found := false
+	for _, e := range exprs {
+		sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+			if c, ok := n.(*sqlparser.ColumnRef); ok {
+				name := c.Name
+				if alias != "" && strings.HasPrefix(name, alias+".") {
+					name = name[len(alias)+1:]
+				}
+				found = found || strings.Contains(name, ".")
+			}
+			return !found
+		})
+	}
+	return found
+}
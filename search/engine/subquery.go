@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// resolveSubqueries 先执行 WHERE 中的 IN (SELECT ...) 子查询，将结果替换为 IN 列表
+func (e *Engine) resolveSubqueries(ctx context.Context, stmt *sqlparser.SelectStmt) (*sqlparser.SelectStmt, error) {
+	exprs := []sqlparser.Expr{stmt.Having}
+	for _, f := range stmt.Fields {
+		exprs = append(exprs, f.Expr)
+	}
+	for _, j := range stmt.Joins {
+		exprs = append(exprs, j.On)
+	}
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+	for _, x := range exprs {
+		if hasSubquery(x) {
+			return nil, fmt.Errorf("subqueries are only supported as IN (SELECT ...) in WHERE")
+		}
+	}
+	if !hasSubquery(stmt.Where) {
+		return stmt, nil
+	}
+	where, err := e.rewriteIn(ctx, stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	s := *stmt
+	s.Where = where
+	return &s, nil
+}
+
+func hasSubquery(e sqlparser.Expr) bool {
+	found := false
+	sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+		if in, ok := n.(*sqlparser.InExpr); ok && in.Select != nil {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// rewriteIn 替换 AND / OR / NOT 下的 IN 子查询，其他位置的子查询不支持
+func (e *Engine) rewriteIn(ctx context.Context, x sqlparser.Expr) (sqlparser.Expr, error) {
+	switch n := x.(type) {
+	case *sqlparser.BinaryExpr:
+		if n.Op != "AND" && n.Op != "OR" {
+			break
+		}
+		left, err := e.rewriteIn(ctx, n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.rewriteIn(ctx, n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlparser.BinaryExpr{Op: n.Op, Left: left, Right: right}, nil
+	case *sqlparser.UnaryExpr:
+		if n.Op != "NOT" {
+			break
+		}
+		inner, err := e.rewriteIn(ctx, n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlparser.UnaryExpr{Op: n.Op, Expr: inner}, nil
+	case *sqlparser.InExpr:
+		if n.Select == nil || hasSubquery(n.Expr) {
+			break
+		}
+		list, err := e.subqueryValues(ctx, n.Select)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlparser.InExpr{Expr: n.Expr, List: list, Not: n.Not}, nil
+	}
+	if hasSubquery(x) {
+		return nil, fmt.Errorf("unsupported subquery in %s", x.String())
+	}
+	return x, nil
+}
+
+// subqueryValues 执行子查询并返回去重后的取值，数组字段展开为多个取值
+func (e *Engine) subqueryValues(ctx context.Context, sub *sqlparser.SelectStmt) ([]sqlparser.Expr, error) {
+	res, err := e.materialize(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Columns) != 1 {
+		return nil, fmt.Errorf("subquery must return exactly one column: %s", sub.String())
+	}
+	var list []sqlparser.Expr
+	seen := make(map[string]bool)
+	add := func(v interface{}) {
+		key := "\x00null"
+		if v != nil {
+			key = fmt.Sprintf("%T:%s", v, toString(v))
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		if v == nil {
+			list = append(list, &sqlparser.NullLit{})
+		} else {
+			list = append(list, literal(v))
+		}
+	}
+	for _, row := range res.Rows {
+		if values, ok := row[0].([]interface{}); ok {
+			for _, v := range values {
+				add(v)
+			}
+			continue
+		}
+		add(row[0])
+	}
+	return list, nil
+}
+
+// materialize 执行中间查询并将结果保存在内存中，结果超过 MaxSubqueryRows 行时报错
+func (e *Engine) materialize(ctx context.Context, stmt *sqlparser.SelectStmt) (*Result, error) {
+	max := int64(e.limits.MaxSubqueryRows)
+	s := *stmt
+	if !s.HasLimit() || s.Limit > max {
+		s.Limit = max
+	}
+	res, err := e.query(ctx, &s)
+	if err != nil {
+		return nil, err
+	}
+	rows := res.Total - stmt.Offset
+	if stmt.HasLimit() && stmt.Limit < rows {
+		rows = stmt.Limit
+	}
+	if rows > max {
+		return nil, fmt.Errorf("subquery returns more than %d rows, add a more selective WHERE or raise query.max-subquery-rows: %s", max, stmt.String())
+	}
+	return res, nil
+}
+
+// derivedEnv 派生表的行上下文，字段可以带派生表别名
+type derivedEnv struct {
+	alias string
+	index map[string]int
+	row   []interface{}
+}
+
+func (env derivedEnv) lookup(e sqlparser.Expr) (interface{}, bool) {
+	c, ok := e.(*sqlparser.ColumnRef)
+	if !ok {
+		return nil, false
+	}
+	if i, ok := env.index[c.Name]; ok {
+		return env.row[i], true
+	}
+	if i, ok := env.index[strings.TrimPrefix(c.Name, env.alias+".")]; ok {
+		return env.row[i], true
+	}
+	return nil, false
+}
+
+// derived 执行派生表查询：先执行内层查询，再在进程内完成外层的过滤、排序、去重与分页
+func (e *Engine) derived(ctx context.Context, stmt *sqlparser.SelectStmt) (*Result, error) {
+	if len(stmt.Joins) > 0 {
+		return nil, fmt.Errorf("JOIN with derived tables is not supported")
+	}
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		return nil, fmt.Errorf("GROUP BY and HAVING over a derived table are not supported")
+	}
+	for _, f := range stmt.Fields {
+		found := false
+		sqlparser.Walk(f.Expr, func(n sqlparser.Expr) bool {
+			found = found || translator.IsAggregateFunc(n) || translator.IsWindowFunc(n)
+			return !found
+		})
+		if found {
+			return nil, fmt.Errorf("aggregate functions over a derived table are not supported: %s", f.Raw)
+		}
+	}
+	inner, err := e.materialize(ctx, stmt.From.Select)
+	if err != nil {
+		return nil, err
+	}
+	alias := stmt.From.Alias
+	rs := newRowSet(alias, inner.Columns, inner.Rows)
+	if err := rs.filter(stmt.Where); err != nil {
+		return nil, err
+	}
+
+	// ORDER BY 可以引用外层的字段别名
+	orderBy := make([]*sqlparser.OrderItem, len(stmt.OrderBy))
+	for i, o := range stmt.OrderBy {
+		orderBy[i] = &sqlparser.OrderItem{Expr: o.Expr, Desc: o.Desc}
+		if c, ok := o.Expr.(*sqlparser.ColumnRef); ok {
+			for _, f := range stmt.Fields {
+				if f.Alias != "" && f.Alias == c.Name {
+					orderBy[i].Expr = f.Expr
+				}
+			}
+		}
+	}
+	if err := rs.sort(orderBy); err != nil {
+		return nil, err
+	}
+
+	res := &Result{Took: inner.Took}
+	var exprs []sqlparser.Expr
+	for _, f := range stmt.Fields {
+		if star, ok := f.Expr.(*sqlparser.StarExpr); ok {
+			if star.Table != "" && star.Table != alias {
+				return nil, fmt.Errorf("unknown table '%s' in %s.*", star.Table, star.Table)
+			}
+			for _, c := range inner.Columns {
+				exprs = append(exprs, &sqlparser.ColumnRef{Name: c})
+				res.Columns = append(res.Columns, c)
+			}
+			continue
+		}
+		exprs = append(exprs, f.Expr)
+		res.Columns = append(res.Columns, f.Name())
+	}
+	out, err := rs.project(exprs, stmt.Distinct)
+	if err != nil {
+		return nil, err
+	}
+	res.Total = int64(len(out))
+	res.Rows = pageRows(out, stmt.Offset, stmt.Limit)
+	return res, nil
+}
@@ -0,0 +1,385 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"gorm.io/gorm"
+
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/metrics"
+)
+
+// 异步任务状态
+const (
+	TaskRunning   = "running"
+	TaskCompleted = "completed"
+	TaskFailed    = "failed"
+	TaskCancelled = "cancelled"
+)
+
+// ErrTaskNotFound 任务不存在
+var ErrTaskNotFound = errors.New("task not found")
+
+// localTaskPrefix 在本服务进程内执行的任务的 ID 前缀，这类任务不在 ES 的任务列表中，只能由执行它的实例取消
+const localTaskPrefix = "local:"
+
+var (
+	localMu    sync.Mutex
+	localTasks = make(map[string]context.CancelFunc)
+	localWG    sync.WaitGroup
+)
+
+// Task 异步执行的 update_by_query / delete_by_query / reindex 任务，保存在 MySQL 中。
+// 不能生成 painless 脚本的 INSERT ... SELECT 在本进程内执行，ID 以 local: 开头
+type Task struct {
+	ID         string     `gorm:"column:id;primaryKey;size:64" json:"id"` // ES 任务 ID，格式为 node:id
+	Owner      string     `gorm:"column:owner;size:128;index" json:"owner"`
+	Kind       string     `gorm:"column:kind;size:16" json:"kind"` // update / delete / reindex
+	Index      string     `gorm:"column:index_name;size:255" json:"index"`
+	Cluster    string     `gorm:"column:cluster;size:64" json:"cluster,omitempty"` // 任务所在的集群，为空时为默认集群
+	Statement  string     `gorm:"column:statement;type:text" json:"statement"`
+	Status     string     `gorm:"column:status;size:16;index" json:"status"`
+	Total      int64      `gorm:"column:total" json:"total"`       // 需要处理的文档数
+	Affected   int64      `gorm:"column:affected" json:"affected"` // 已处理的文档数
+	Error      string     `gorm:"column:error;type:text" json:"error,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at" json:"updated_at"`
+	FinishedAt *time.Time `gorm:"column:finished_at" json:"finished_at,omitempty"`
+}
+
+// TableName 任务表名
+func (Task) TableName() string {
+	return "es_search_tasks"
+}
+
+// TaskNotifier 任务结束（完成、失败或取消）时的通知，同一个任务只通知一次
+type TaskNotifier func(ctx context.Context, t *Task)
+
+// MigrateTasks 创建或更新任务表
+func MigrateTasks(db *gorm.DB) error {
+	return db.AutoMigrate(&Task{})
+}
+
+func (e *Engine) taskDB(ctx context.Context) (*gorm.DB, error) {
+	if e.mysql == nil {
+		return nil, fmt.Errorf("asynchronous tasks require a MySQL connection")
+	}
+	db, err := e.mysql()
+	if err != nil {
+		return nil, err
+	}
+	return db.WithContext(ctx), nil
+}
+
+// ownerDB 发起、查看与取消任务都按发起人区分，没有发起人（匿名或令牌中没有 sub）时不能使用任务
+func (e *Engine) ownerDB(ctx context.Context) (*gorm.DB, error) {
+	if e.owner == "" {
+		return nil, fmt.Errorf("%w: asynchronous tasks require an authenticated identity", ErrPermissionDenied)
+	}
+	return e.taskDB(ctx)
+}
+
+// startTask 以 wait_for_completion=false 启动任务并记录任务 ID 与发起人
+func (e *Engine) startTask(ctx context.Context, kind, index, statement string,
+	start func() (*elastic.StartTaskResult, error)) (*Result, error) {
+	db, err := e.ownerDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st, err := start()
+	if err != nil {
+		return nil, err
+	}
+	t := &Task{ID: st.TaskId, Owner: e.owner, Kind: kind, Index: index, Cluster: e.cluster, Statement: statement, Status: TaskRunning}
+	if err := db.Create(t).Error; err != nil {
+		return nil, fmt.Errorf("task %s started but could not be saved: %v", st.TaskId, err)
+	}
+	return &Result{Task: t}, nil
+}
+
+// startLocalTask 在后台执行 run，run 通过 progress 上报需要处理与已处理的文档数
+func (e *Engine) startLocalTask(ctx context.Context, kind, index, statement string,
+	run func(ctx context.Context, progress func(total, affected int64)) error) (*Result, error) {
+	db, err := e.ownerDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	t := &Task{ID: localTaskPrefix + hex.EncodeToString(b), Owner: e.owner, Kind: kind, Index: index,
+		Cluster: e.cluster, Statement: statement, Status: TaskRunning}
+	if err := db.Create(t).Error; err != nil {
+		return nil, err
+	}
+	started := *t
+
+	// 任务的生命周期与请求无关
+	runCtx, cancel := context.WithCancel(context.Background())
+	db = db.WithContext(context.Background())
+	localMu.Lock()
+	localTasks[t.ID] = cancel
+	localWG.Add(1)
+	localMu.Unlock()
+	go func() {
+		defer localWG.Done()
+		defer func() {
+			localMu.Lock()
+			delete(localTasks, t.ID)
+			localMu.Unlock()
+			cancel()
+		}()
+		err := run(runCtx, func(total, affected int64) {
+			t.Total, t.Affected = total, affected
+			db.Model(&Task{}).Where("id = ? AND status = ?", t.ID, TaskRunning).
+				Updates(map[string]interface{}{"total": total, "affected": affected})
+		})
+		status, reason := TaskCompleted, ""
+		switch {
+		case runCtx.Err() != nil:
+			status = TaskCancelled
+		case err != nil:
+			status, reason = TaskFailed, err.Error()
+		}
+		_ = e.finishTask(context.Background(), db, t, status, reason)
+	}()
+	return &Result{Task: &started}, nil
+}
+
+// StopLocalTasks 取消本进程内运行的全部任务，等待它们记录为 cancelled 后返回，ctx 到期时不再等待。服务退出前调用
+func StopLocalTasks(ctx context.Context) error {
+	localMu.Lock()
+	for _, cancel := range localTasks {
+		cancel()
+	}
+	localMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		localWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Task 查询任务，运行中的任务从 ES 获取最新进度。只有发起人与管理员可以查看
+func (e *Engine) Task(ctx context.Context, id string) (*Task, error) {
+	db, err := e.ownerDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := e.loadTask(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status == TaskRunning {
+		if err := e.refreshTask(ctx, db, t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Tasks 当前用户发起的任务，按创建时间倒序，status 为空时返回全部状态
+func (e *Engine) Tasks(ctx context.Context, status string) ([]*Task, error) {
+	db, err := e.ownerDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := db.Where("owner = ?", e.owner)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var tasks []*Task
+	if err := q.Order("created_at DESC").Limit(100).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// CancelTask 取消运行中的任务。ES 中的取消是异步的，返回时任务可能仍在运行
+func (e *Engine) CancelTask(ctx context.Context, id string) (*Task, error) {
+	db, err := e.ownerDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := e.loadTask(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status != TaskRunning {
+		return nil, fmt.Errorf("task %s is already %s", id, t.Status)
+	}
+	if strings.HasPrefix(id, localTaskPrefix) {
+		localMu.Lock()
+		cancel, ok := localTasks[id]
+		localMu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("task %s is not running on this instance", id)
+		}
+		cancel()
+		return t, nil
+	}
+	te, err := e.withCluster(t.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := esclient.Call(ctx, te.client, te.client.TasksCancel().TaskId(id).Do); err != nil && !elastic.IsNotFound(err) {
+		return nil, err
+	}
+	if err := e.refreshTask(ctx, db, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WatchTasks 定期刷新运行中的任务，使没有被轮询的任务也能在结束时通知，ctx 取消时退出
+func (e *Engine) WatchTasks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		metrics.JobRun("watch-tasks", e.refreshTasks(ctx))
+	}
+}
+
+// refreshTasks 刷新一批运行中的任务，返回遇到的第一个错误
+func (e *Engine) refreshTasks(ctx context.Context) error {
+	db, err := e.taskDB(ctx)
+	if err != nil {
+		return err
+	}
+	var tasks []*Task
+	if err := db.Where("status = ?", TaskRunning).Order("created_at").Limit(100).Find(&tasks).Error; err != nil {
+		return err
+	}
+	var first error
+	for _, t := range tasks {
+		if err := e.refreshTask(ctx, db, t); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (e *Engine) loadTask(db *gorm.DB, id string) (*Task, error) {
+	t := &Task{}
+	if err := db.Where("id = ?", id).Take(t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+		}
+		return nil, err
+	}
+	if t.Owner != e.owner && !e.admin {
+		return nil, fmt.Errorf("%w: task %s belongs to another user", ErrPermissionDenied, id)
+	}
+	return t, nil
+}
+
+// esTask GET _tasks/<id> 的响应
+type esTask struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status struct {
+			Total    int64  `json:"total"`
+			Created  int64  `json:"created"`
+			Updated  int64  `json:"updated"`
+			Deleted  int64  `json:"deleted"`
+			Canceled string `json:"canceled"`
+		} `json:"status"`
+		Cancelled bool `json:"cancelled"`
+	} `json:"task"`
+	Error    *elastic.ErrorDetails `json:"error"`
+	Response *struct {
+		Canceled string            `json:"canceled"`
+		Failures []json.RawMessage `json:"failures"`
+	} `json:"response"`
+}
+
+// refreshTask 从任务所在集群获取任务进度并保存，任务结束时记录结果并通知。本进程内的任务由执行它的协程更新
+func (e *Engine) refreshTask(ctx context.Context, db *gorm.DB, t *Task) error {
+	if strings.HasPrefix(t.ID, localTaskPrefix) {
+		return nil
+	}
+	e, err := e.withCluster(t.Cluster)
+	if err != nil {
+		return err
+	}
+	if e.client == nil {
+		return fmt.Errorf("elasticsearch client is not initialized")
+	}
+	resp, err := esclient.Call(ctx, e.client, func(ctx context.Context) (*elastic.Response, error) {
+		return e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: "GET",
+			Path:   "/_tasks/" + url.PathEscape(t.ID),
+		})
+	})
+	if elastic.IsNotFound(err) {
+		return e.finishTask(ctx, db, t, TaskFailed, "task no longer exists in Elasticsearch")
+	}
+	if err != nil {
+		return err
+	}
+	var st esTask
+	if err := json.Unmarshal(resp.Body, &st); err != nil {
+		return err
+	}
+	s := st.Task.Status
+	t.Total, t.Affected = s.Total, s.Created+s.Updated+s.Deleted
+	if !st.Completed {
+		return db.Model(&Task{}).Where("id = ? AND status = ?", t.ID, TaskRunning).
+			Updates(map[string]interface{}{"total": t.Total, "affected": t.Affected}).Error
+	}
+
+	switch {
+	case st.Error != nil:
+		return e.finishTask(ctx, db, t, TaskFailed, st.Error.Reason)
+	case st.Response != nil && len(st.Response.Failures) > 0:
+		return e.finishTask(ctx, db, t, TaskFailed, string(st.Response.Failures[0]))
+	case st.Task.Cancelled || s.Canceled != "" || (st.Response != nil && st.Response.Canceled != ""):
+		return e.finishTask(ctx, db, t, TaskCancelled, "")
+	}
+	return e.finishTask(ctx, db, t, TaskCompleted, "")
+}
+
+// finishTask 只有从 running 转为结束状态的那一次更新会触发通知
+func (e *Engine) finishTask(ctx context.Context, db *gorm.DB, t *Task, status, reason string) error {
+	now := time.Now()
+	res := db.Model(&Task{}).Where("id = ? AND status = ?", t.ID, TaskRunning).Updates(map[string]interface{}{
+		"status":      status,
+		"total":       t.Total,
+		"affected":    t.Affected,
+		"error":       reason,
+		"finished_at": now,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	t.Status, t.Error, t.FinishedAt = status, reason, &now
+	if res.RowsAffected == 1 {
+		metrics.TaskFinished(t.Kind, status)
+		if e.notify != nil {
+			e.notify(ctx, t)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/metrics"
+)
+
+// ErrQueryTimeout 查询超过了超时时间
+var ErrQueryTimeout = errors.New("query timed out")
+
+// shardStats 一次查询中各个 ES 请求的分片状态
+type shardStats struct {
+	mu       sync.Mutex
+	timedOut bool // 有分片在 ES 端超时
+	failed   bool // 有分片执行失败
+}
+
+type shardStatsKey struct{}
+
+// withShardStats 在 ctx 中记录分片状态，由 doSearch 填充
+func withShardStats(ctx context.Context) (context.Context, *shardStats) {
+	st := &shardStats{}
+	return context.WithValue(ctx, shardStatsKey{}, st), st
+}
+
+// searchTimeout ES 端的 timeout 取剩余时间的 90%，使 ES 能在客户端放弃前返回已完成分片的结果
+func searchTimeout(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	d := time.Until(deadline) * 9 / 10
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return d, true
+}
+
+// doSearch 执行一次 ES 查询：ctx 有截止时间时同时设置 ES 端的 timeout，分片超时或失败时记录到 ctx 的分片状态中
+func (e *Engine) doSearch(ctx context.Context, index string, src *elastic.SearchSource) (*elastic.SearchResult, error) {
+	if d, ok := searchTimeout(ctx); ok {
+		src.Timeout(fmt.Sprintf("%dms", d.Milliseconds()))
+	}
+	b, err := e.backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := b.Search(ctx, index, src)
+	metrics.ObserveSearch(e.cluster, queryType(src), time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	if st, ok := ctx.Value(shardStatsKey{}).(*shardStats); ok {
+		st.mu.Lock()
+		st.timedOut = st.timedOut || resp.TimedOut
+		st.failed = st.failed || (resp.Shards != nil && resp.Shards.Failed > 0)
+		st.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// queryType 查询的类型，用于按类型统计耗时
+func queryType(src *elastic.SearchSource) string {
+	body, err := src.Source()
+	if m, ok := body.(map[string]interface{}); ok && err == nil {
+		if _, ok := m["aggregations"]; ok {
+			return "aggregation"
+		}
+	}
+	return "search"
+}
+
+// read 执行查询语句：设置了超时时间时到期后取消全部 ES 与 MySQL 请求，分片超时或失败时在结果中标记为部分结果
+func (e *Engine) read(ctx context.Context, run func(ctx context.Context) (*Result, error)) (*Result, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	ctx, st := withShardStats(ctx)
+	res, err := run(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s", ErrQueryTimeout, e.timeout)
+		}
+		return nil, err
+	}
+	res.TimedOut = st.timedOut
+	res.Partial = st.timedOut || st.failed
+	return res, nil
+}
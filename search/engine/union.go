@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// union 执行 UNION / UNION ALL：各个 SELECT 的结果保存在内存中，按位置对齐字段并统一类型后合并，
+// 再执行合并结果的 ORDER BY 与 LIMIT。列名取第一个 SELECT 的列名
+func (e *Engine) union(ctx context.Context, u *sqlparser.UnionStmt) (*Result, error) {
+	results := make([]*Result, len(u.Selects))
+	for i, s := range u.Selects {
+		res, err := e.materialize(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && len(res.Columns) != len(results[0].Columns) {
+			return nil, fmt.Errorf("the used SELECT statements have a different number of columns: %d and %d",
+				len(results[0].Columns), len(res.Columns))
+		}
+		results[i] = res
+	}
+
+	res := &Result{Columns: results[0].Columns}
+	var rows [][]interface{}
+	for _, r := range results {
+		res.Took += r.Took
+		rows = append(rows, r.Rows...)
+	}
+	coerceColumns(rows, len(res.Columns))
+
+	// 混合使用时，UNION（去重）会覆盖其左侧所有的 UNION ALL
+	distinct := 0
+	for i, all := range u.All {
+		if !all {
+			distinct = i + 2
+		}
+	}
+	if distinct > 0 {
+		n := 0
+		for _, r := range results[:distinct] {
+			n += len(r.Rows)
+		}
+		rows = append(dedupRows(rows[:n]), rows[n:]...)
+	}
+
+	if len(u.OrderBy) > 0 {
+		orderBy, err := unionOrder(u.OrderBy, res.Columns)
+		if err != nil {
+			return nil, err
+		}
+		index := make(map[string]int, len(res.Columns))
+		for i, c := range res.Columns {
+			if _, ok := index[c]; !ok {
+				index[c] = i
+			}
+		}
+		idx, err := sortIndex(len(rows), orderBy, func(i int) evalEnv {
+			return derivedEnv{index: index, row: rows[i]}
+		})
+		if err != nil {
+			return nil, err
+		}
+		sorted := make([][]interface{}, len(rows))
+		for i, j := range idx {
+			sorted[i] = rows[j]
+		}
+		rows = sorted
+	}
+
+	res.Total = int64(len(rows))
+	res.Rows = pageRows(rows, u.Offset, u.Limit)
+	return res, nil
+}
+
+// unionOrder ORDER BY 中的位置序号（ORDER BY 1）替换为对应的列
+func unionOrder(items []*sqlparser.OrderItem, columns []string) ([]*sqlparser.OrderItem, error) {
+	out := make([]*sqlparser.OrderItem, len(items))
+	for i, o := range items {
+		out[i] = o
+		n, ok := o.Expr.(*sqlparser.NumberLit)
+		if !ok {
+			continue
+		}
+		pos := int(n.Float())
+		if !n.IsInt() || pos < 1 || pos > len(columns) {
+			return nil, fmt.Errorf("unknown column '%s' in ORDER BY", n.Raw)
+		}
+		out[i] = &sqlparser.OrderItem{Expr: &sqlparser.ColumnRef{Name: columns[pos-1]}, Desc: o.Desc}
+	}
+	return out, nil
+}
+
+func dedupRows(rows [][]interface{}) [][]interface{} {
+	seen := make(map[string]bool, len(rows))
+	out := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		key := fmt.Sprintf("%#v", row)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// coerceColumns 统一各列的类型，规则与 MySQL 一致：
+//
+//	数值与字符串混合时转为字符串；整数与浮点数混合时转为浮点数；
+//	布尔值与数值混合时按 1 / 0 处理；数组、对象等其他类型保持不变
+func coerceColumns(rows [][]interface{}, n int) {
+	for col := 0; col < n; col++ {
+		var hasInt, hasFloat, hasString, hasBool, hasOther bool
+		for _, row := range rows {
+			switch row[col].(type) {
+			case nil:
+			case int64:
+				hasInt = true
+			case float64:
+				hasFloat = true
+			case string:
+				hasString = true
+			case bool:
+				hasBool = true
+			default:
+				hasOther = true
+			}
+		}
+		numeric := hasInt || hasFloat || hasBool
+		var conv func(v interface{}) interface{}
+		switch {
+		case hasOther:
+		case hasString && numeric:
+			conv = func(v interface{}) interface{} { return toString(boolNumber(v)) }
+		case hasFloat && (hasInt || hasBool):
+			conv = func(v interface{}) interface{} { f, _ := toFloat(boolNumber(v)); return f }
+		case hasInt && hasBool:
+			conv = boolNumber
+		}
+		if conv == nil {
+			continue
+		}
+		for _, row := range rows {
+			if row[col] != nil {
+				row[col] = conv(row[col])
+			}
+		}
+	}
+}
+
+func boolNumber(v interface{}) interface{} {
+	if b, ok := v.(bool); ok {
+		if b {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	return v
+}
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/metrics"
+	"lium-product/es-search/search/sqlparser"
+	"lium-product/es-search/search/translator"
+)
+
+// ErrPermissionDenied 没有执行该语句的权限
+var ErrPermissionDenied = errors.New("permission denied")
+
+// writeIndex 写语句的目标索引，只支持 ES 索引
+func writeIndex(name string) (string, error) {
+	src, index := splitSource(name)
+	if src != SourceES {
+		return "", fmt.Errorf("%s: write statements only support Elasticsearch indices", name)
+	}
+	return index, nil
+}
+
+// translateWrite 检查权限与 WHERE 条件并翻译写语句
+func (e *Engine) translateWrite(ctx context.Context, stmt sqlparser.Statement) (*translator.WriteRequest, error) {
+	if !e.admin {
+		return nil, fmt.Errorf("%w: write statements require admin permission", ErrPermissionDenied)
+	}
+	switch s := stmt.(type) {
+	case *sqlparser.InsertStmt:
+		index, err := writeIndex(s.Table)
+		if err != nil {
+			return nil, err
+		}
+		c := *s
+		c.Table = index
+		return translator.TranslateInsert(&c)
+	case *sqlparser.UpdateStmt:
+		if s.Where == nil {
+			return nil, fmt.Errorf("UPDATE requires a WHERE clause")
+		}
+		index, err := writeIndex(s.Table.Name)
+		if err != nil {
+			return nil, err
+		}
+		c := *s
+		c.Table = &sqlparser.TableRef{Name: index, Alias: s.Table.Alias}
+		schema, err := e.indexSchema(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+		return translator.TranslateUpdate(&c, schema)
+	case *sqlparser.DeleteStmt:
+		if s.Where == nil {
+			return nil, fmt.Errorf("DELETE requires a WHERE clause")
+		}
+		if s.Table.Select != nil {
+			return nil, fmt.Errorf("DELETE from a derived table is not supported")
+		}
+		index, err := writeIndex(s.Table.Name)
+		if err != nil {
+			return nil, err
+		}
+		c := *s
+		c.Table = &sqlparser.TableRef{Name: index, Alias: s.Table.Alias}
+		schema, err := e.indexSchema(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+		return translator.TranslateDelete(&c, schema)
+	}
+	return nil, fmt.Errorf("unsupported statement")
+}
+
+// write 执行 INSERT / UPDATE / DELETE，dry-run 模式只返回将受影响的行数，
+// 异步模式下 UPDATE / DELETE 立即返回任务
+func (e *Engine) write(ctx context.Context, stmt sqlparser.Statement, sql string) (*Result, error) {
+	if s, ok := stmt.(*sqlparser.InsertStmt); ok && s.Select != nil {
+		return e.insertSelect(ctx, s, sql)
+	}
+	req, err := e.translateWrite(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if e.client == nil {
+		return nil, fmt.Errorf("elasticsearch client is not initialized")
+	}
+	if e.dryRun {
+		n := int64(len(req.Docs))
+		if req.Query != nil {
+			if n, err = esclient.Call(ctx, e.client, e.client.Count(req.Index).Query(req.Query).Do); err != nil {
+				return nil, err
+			}
+		}
+		return &Result{Affected: n, DryRun: true}, nil
+	}
+
+	switch stmt.(type) {
+	case *sqlparser.InsertStmt:
+		return e.insert(ctx, req)
+	case *sqlparser.UpdateStmt:
+		svc := e.client.UpdateByQuery(req.Index).Query(req.Query).Script(req.Script).Refresh("true")
+		if e.async {
+			return e.startTask(ctx, "update", req.Index, sql, func() (*elastic.StartTaskResult, error) {
+				return esclient.Call(ctx, e.client, svc.WaitForCompletion(false).DoAsync)
+			})
+		}
+		resp, err := esclient.Call(ctx, e.client, svc.Do)
+		if err != nil {
+			return nil, err
+		}
+		return byQueryResult(resp, resp.Updated)
+	default:
+		svc := e.client.DeleteByQuery(req.Index).Query(req.Query).Refresh("true")
+		if e.async {
+			return e.startTask(ctx, "delete", req.Index, sql, func() (*elastic.StartTaskResult, error) {
+				return esclient.Call(ctx, e.client, svc.WaitForCompletion(false).DoAsync)
+			})
+		}
+		resp, err := esclient.Call(ctx, e.client, svc.Do)
+		if err != nil {
+			return nil, err
+		}
+		return byQueryResult(resp, resp.Deleted)
+	}
+}
+
+// insert 单行使用 index 请求，多行使用 bulk 请求
+func (e *Engine) insert(ctx context.Context, req *translator.WriteRequest) (*Result, error) {
+	if len(req.Docs) == 1 {
+		svc := e.client.Index().Index(req.Index).BodyJson(req.Docs[0]).Refresh("true")
+		if req.IDs[0] != "" {
+			svc.Id(req.IDs[0])
+		}
+		if _, err := esclient.Call(ctx, e.client, svc.Do); err != nil {
+			return nil, err
+		}
+		return &Result{Affected: 1}, nil
+	}
+	bulk := e.client.Bulk().Refresh("true")
+	for i, doc := range req.Docs {
+		r := elastic.NewBulkIndexRequest().Index(req.Index).Doc(doc)
+		if req.IDs[i] != "" {
+			r.Id(req.IDs[i])
+		}
+		bulk.Add(r)
+	}
+	resp, err := e.doBulk(ctx, bulk)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Took: int64(resp.Took), Affected: int64(len(resp.Succeeded()))}
+	if failed := resp.Failed(); len(failed) > 0 {
+		reason := ""
+		if failed[0].Error != nil {
+			reason = failed[0].Error.Reason
+		}
+		return nil, fmt.Errorf("bulk insert: %d of %d rows failed, first error: %s", len(failed), len(req.Docs), reason)
+	}
+	return res, nil
+}
+
+// doBulk 执行 bulk 请求并记录写入的成功与失败文档数
+func (e *Engine) doBulk(ctx context.Context, bulk *elastic.BulkService) (*elastic.BulkResponse, error) {
+	n, start := bulk.NumberOfActions(), time.Now()
+	resp, err := esclient.Call(ctx, e.client, bulk.Do)
+	if err != nil {
+		metrics.ObserveBulk(e.cluster, 0, n, time.Since(start))
+		return nil, err
+	}
+	metrics.ObserveBulk(e.cluster, len(resp.Succeeded()), len(resp.Failed()), time.Since(start))
+	return resp, nil
+}
+
+// byQueryResult update_by_query / delete_by_query 的结果，有失败时报错并给出已处理的行数
+func byQueryResult(resp *elastic.BulkIndexByScrollResponse, affected int64) (*Result, error) {
+	if len(resp.Failures) > 0 {
+		return nil, fmt.Errorf("%d rows affected before failure: %v", affected, resp.Failures[0])
+	}
+	return &Result{Took: resp.Took, Affected: affected}, nil
+}
@@ -0,0 +1,51 @@
+package esclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/breaker"
+)
+
+var breakers sync.Map // *elastic.Client -> *breaker.Breaker
+
+// Call 经过客户端的熔断器执行一次 ES 请求，例如 Call(ctx, client, client.Search(index).Do)。
+// 熔断器在 elastic.Client 之外获取，被拒绝的请求不会发到 ES，也不会让节点被标记为不可用；
+// 客户端没有熔断器时直接执行
+func Call[T any](ctx context.Context, client *elastic.Client, do func(context.Context) (T, error)) (T, error) {
+	b, ok := breakers.Load(client)
+	if !ok {
+		return do(ctx)
+	}
+	done, err := b.(*breaker.Breaker).Acquire(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	res, err := do(ctx)
+	done(failed(ctx, err))
+	return res, err
+}
+
+// failed 请求是否计为依赖失败：连接失败、传输层超时、没有可用节点以及 429 / 502 / 503 / 504。
+// 调用方的 ctx 取消或到期（如查询超时）、scroll 读完以及 ES 返回的其他错误（如索引不存在、语法错误）不计为失败，
+// 避免个别设置了较短超时的慢查询使所有请求熔断
+func failed(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) || err == io.EOF {
+		return false
+	}
+	var e *elastic.Error
+	if errors.As(err, &e) {
+		switch e.Status {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return true
+}
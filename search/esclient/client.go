@@ -0,0 +1,215 @@
+package esclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/breaker"
+)
+
+// 未配置时的重试参数
+const (
+	defaultMaxRetries       = 3
+	defaultRetryMinInterval = 100 * time.Millisecond
+	defaultRetryMaxInterval = 5 * time.Second
+)
+
+// detectTimeout 连接时识别服务端版本的超时时间
+const detectTimeout = 10 * time.Second
+
+var (
+	mu       sync.Mutex
+	client   *elastic.Client
+	clusters = make(map[string]*elastic.Client)
+)
+
+// GetClient 获取默认集群的 ES 客户端，首次调用时按配置创建，创建失败时下次调用会重试
+func GetClient() (*elastic.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+	c, err := New(cfg.LoadElastic(), breaker.New("elastic", breaker.FromRule(cfg.LoadBreaker().Elastic)))
+	if err != nil {
+		return nil, err
+	}
+	client = c
+	return client, nil
+}
+
+// SetClient 设置默认集群的客户端，测试用
+func SetClient(c *elastic.Client) {
+	mu.Lock()
+	defer mu.Unlock()
+	client = c
+}
+
+// ClusterNames 配置中的命名集群，按名称排序
+func ClusterNames() []string {
+	var names []string
+	for name := range cfg.LoadElastic().Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCluster 获取命名集群的 ES 客户端，首次调用时按配置创建，创建失败时下次调用会重试
+func GetCluster(name string) (*elastic.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if c, ok := clusters[name]; ok {
+		return c, nil
+	}
+	conf, ok := cfg.LoadElastic().Clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("cluster %s is not configured", name)
+	}
+	c, err := New(conf, breaker.New("elastic/"+name, breaker.FromRule(cfg.LoadBreaker().Elastic)))
+	if err != nil {
+		return nil, err
+	}
+	clusters[name] = c
+	return c, nil
+}
+
+// SetCluster 设置命名集群的客户端，测试用
+func SetCluster(name string, c *elastic.Client) {
+	mu.Lock()
+	defer mu.Unlock()
+	clusters[name] = c
+}
+
+// Stop 停止全部客户端的后台健康检查与 sniff
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+	if client != nil {
+		client.Stop()
+	}
+	for _, c := range clusters {
+		c.Stop()
+	}
+}
+
+// New 按配置创建 ES 客户端：多个节点、basic auth、CA 与客户端证书、指数退避重试、健康检查与 gzip，
+// 创建后识别服务端的发行版与版本。b 不为 nil 时通过 Call 执行的请求经过该熔断器
+func New(conf cfg.ElasticSearch, b *breaker.Breaker) (*elastic.Client, error) {
+	secure := conf.TLS.CAFile != "" || conf.TLS.CertFile != "" || conf.TLS.InsecureSkipVerify
+	urls := conf.Hosts
+	if len(urls) == 0 {
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		urls = []string{fmt.Sprintf("%s://%s:%d", scheme, conf.Address, conf.Port)}
+	}
+	opts := []elastic.ClientOptionFunc{
+		elastic.SetURL(urls...),
+		elastic.SetSniff(conf.Sniff),
+		elastic.SetGzip(conf.Gzip),
+		elastic.SetRetrier(newRetrier(conf)),
+		elastic.SetRetryStatusCodes(http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout),
+		elastic.SetHealthcheck(conf.HealthcheckInterval > 0),
+	}
+	if conf.HealthcheckInterval > 0 {
+		opts = append(opts, elastic.SetHealthcheckInterval(time.Duration(conf.HealthcheckInterval)*time.Second))
+	}
+	if conf.UserName != "" {
+		opts = append(opts, elastic.SetBasicAuth(conf.UserName, conf.Password))
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if secure {
+		tc, err := tlsConfig(conf.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tc
+	}
+	compat := &compatTransport{base: transport}
+	opts = append(opts, elastic.SetHttpClient(&http.Client{Transport: &requestIDTransport{base: compat}}))
+	client, err := elastic.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil {
+		breakers.Store(client, b)
+	}
+
+	// 连接时识别服务端，Elasticsearch 8 以 7.x 兼容模式访问
+	ctx, cancel := context.WithTimeout(context.Background(), detectTimeout)
+	defer cancel()
+	server, err := ServerOf(ctx, client)
+	if err != nil {
+		client.Stop()
+		breakers.Delete(client)
+		return nil, err
+	}
+	if server.Distribution == Elasticsearch && server.Major >= 8 {
+		compat.enable()
+	}
+	return client, nil
+}
+
+// tlsConfig 读取 CA 证书与客户端证书
+func tlsConfig(conf cfg.TLS) (*tls.Config, error) {
+	tc := &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file failed: %v", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", conf.CAFile)
+		}
+	}
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %v", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// retrier 连接失败或节点返回 502 / 503 / 504 时按指数退避重试，最多重试 max 次，ctx 取消后不再重试
+type retrier struct {
+	backoff elastic.Backoff
+	max     int
+}
+
+func newRetrier(conf cfg.ElasticSearch) *retrier {
+	max, min, maxInterval := conf.MaxRetries, time.Duration(conf.RetryMinInterval)*time.Millisecond,
+		time.Duration(conf.RetryMaxInterval)*time.Millisecond
+	if max == 0 {
+		max = defaultMaxRetries
+	}
+	if min <= 0 {
+		min = defaultRetryMinInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = defaultRetryMaxInterval
+	}
+	return &retrier{backoff: elastic.NewExponentialBackoff(min, maxInterval), max: max}
+}
+
+func (r *retrier) Retry(ctx context.Context, retry int, req *http.Request, resp *http.Response, err error) (time.Duration, bool, error) {
+	if retry > r.max || ctx.Err() != nil {
+		return 0, false, nil
+	}
+	d, ok := r.backoff.Next(retry)
+	return d, ok, nil
+}
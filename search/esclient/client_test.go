@@ -0,0 +1,213 @@
+package esclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/breaker"
+	"lium-product/es-search/search/logs"
+)
+
+// newServer 模拟 ES 节点，GET / 返回 info 中的版本信息，其他请求交给 search
+func newServer(info string, search http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(info))
+			return
+		}
+		search(w, r)
+	}))
+}
+
+const es7 = `{"version":{"number":"7.17.9"}}`
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := newServer(es7, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"took":1,"hits":{"total":{"value":0},"hits":[]}}`))
+	})
+	defer srv.Close()
+
+	conf := cfg.ElasticSearch{Hosts: []string{srv.URL}, RetryMinInterval: 1, RetryMaxInterval: 10}
+	client, err := New(conf, nil)
+	assert.NoError(t, err)
+	_, err = client.Search("logs").Do(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// 不重试时第一次 503 即返回错误
+	atomic.StoreInt32(&calls, 0)
+	conf.MaxRetries = -1
+	client, err = New(conf, nil)
+	assert.NoError(t, err)
+	_, err = client.Search("logs").Do(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestTLSConfig(t *testing.T) {
+	_, err := New(cfg.ElasticSearch{Address: "localhost", Port: 9200, TLS: cfg.TLS{CAFile: "missing.pem"}}, nil)
+	assert.ErrorContains(t, err, "read ca file failed")
+
+	tc, err := tlsConfig(cfg.TLS{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	assert.True(t, tc.InsecureSkipVerify)
+	assert.Nil(t, tc.RootCAs)
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   string
+		server *Server
+		accept string
+		err    string
+	}{
+		{name: "elasticsearch 7", info: es7, server: &Server{Distribution: Elasticsearch, Version: "7.17.9", Major: 7, Minor: 17}},
+		{name: "elasticsearch 8", info: `{"version":{"number":"8.11.1","build_flavor":"default"}}`,
+			server: &Server{Distribution: Elasticsearch, Version: "8.11.1", Major: 8, Minor: 11}, accept: compatJSON},
+		{name: "opensearch", info: `{"version":{"distribution":"opensearch","number":"2.11.0"}}`,
+			server: &Server{Distribution: OpenSearch, Version: "2.11.0", Major: 2, Minor: 11}},
+		{name: "elasticsearch 6", info: `{"version":{"number":"6.8.23"}}`, err: "elasticsearch 6.8.23 is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			srv := newServer(tt.info, func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept")
+				_, _ = w.Write([]byte(`{"took":1,"hits":{"total":{"value":0},"hits":[]}}`))
+			})
+			defer srv.Close()
+
+			client, err := New(cfg.ElasticSearch{Hosts: []string{srv.URL}}, nil)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			s, err := ServerOf(context.Background(), client)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.server, s)
+			_, err = client.Search("logs").Do(context.Background())
+			assert.NoError(t, err)
+			if tt.accept != "" {
+				assert.Equal(t, tt.accept, accept)
+			} else {
+				assert.NotContains(t, accept, "compatible-with")
+			}
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var calls int32
+	srv := newServer(es7, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"took":1,"hits":{"total":{"value":0},"hits":[]}}`))
+	})
+	defer srv.Close()
+
+	b := breaker.New("elastic-test", breaker.Config{Failures: 2, OpenTimeout: time.Minute})
+	client, err := New(cfg.ElasticSearch{Hosts: []string{srv.URL}, MaxRetries: -1}, b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err = Call(ctx, client, client.Search("logs").Do)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, breaker.StateOpen, b.Status().State)
+
+	// 熔断后不再请求 ES
+	_, err = Call(ctx, client, client.Search("logs").Do)
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, 0, b.Status().InFlight)
+
+	// 拒绝发生在客户端之外，节点没有被标记为不可用
+	_, err = client.Search("logs").Do(ctx)
+	assert.NoError(t, err)
+}
+
+func TestFailed(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, failed(ctx, nil))
+	assert.False(t, failed(ctx, context.Canceled))
+	assert.False(t, failed(ctx, io.EOF))
+	assert.False(t, failed(ctx, &elastic.Error{Status: http.StatusNotFound}))
+	assert.True(t, failed(ctx, &elastic.Error{Status: http.StatusTooManyRequests}))
+	assert.True(t, failed(ctx, elastic.ErrNoClient))
+	// 调用方的 ctx 仍有效时的超时来自传输层
+	assert.True(t, failed(ctx, context.DeadlineExceeded))
+
+	expired, cancel := context.WithTimeout(ctx, 0)
+	defer cancel()
+	assert.False(t, failed(expired, context.DeadlineExceeded))
+}
+
+func TestBreakerCallerTimeout(t *testing.T) {
+	srv := newServer(es7, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+	defer srv.Close()
+
+	b := breaker.New("elastic-timeout-test", breaker.Config{Failures: 1, OpenTimeout: time.Minute})
+	client, err := New(cfg.ElasticSearch{Hosts: []string{srv.URL}, MaxRetries: -1}, b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// 查询超时是调用方的 ctx 到期，不使 ES 熔断
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = Call(ctx, client, client.Search("logs").Do)
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	assert.Equal(t, breaker.StateClosed, b.Status().State)
+	assert.Equal(t, 0, b.Status().Failures)
+}
+
+func TestRequestID(t *testing.T) {
+	var header http.Header
+	srv := newServer(es7, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"took":1,"hits":{"total":{"value":0},"hits":[]}}`))
+	})
+	defer srv.Close()
+
+	client, err := New(cfg.ElasticSearch{Hosts: []string{srv.URL}}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Search("logs").Do(logs.WithRequestID(context.Background(), "req-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "req-1", header.Get("X-Request-ID"))
+	assert.Equal(t, "req-1", header.Get("X-Opaque-Id"))
+
+	_, err = client.Search("logs").Do(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, header.Get("X-Opaque-Id"))
+}
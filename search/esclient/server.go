@@ -0,0 +1,114 @@
+package esclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// 服务端发行版
+const (
+	Elasticsearch = "elasticsearch"
+	OpenSearch    = "opensearch"
+)
+
+// Server 服务端的发行版与版本，连接时通过 GET / 获取
+type Server struct {
+	Distribution string `json:"distribution"` // elasticsearch / opensearch
+	Version      string `json:"version"`
+	Major        int    `json:"-"`
+	Minor        int    `json:"-"`
+}
+
+// AtLeast 版本是否不低于 major.minor
+func (s *Server) AtLeast(major, minor int) bool {
+	return s.Major > major || s.Major == major && s.Minor >= minor
+}
+
+func (s *Server) String() string {
+	return s.Distribution + " " + s.Version
+}
+
+var servers sync.Map // *elastic.Client -> *Server
+
+// ServerOf 客户端所连服务端的发行版与版本，首次调用时请求 GET / 并缓存，失败时下次调用会重试
+func ServerOf(ctx context.Context, client *elastic.Client) (*Server, error) {
+	if s, ok := servers.Load(client); ok {
+		return s.(*Server), nil
+	}
+	s, err := detect(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	servers.Store(client, s)
+	return s, nil
+}
+
+// detect 从 GET / 的 version 中读取发行版与版本。查询不带 mapping type，不支持 type 尚未移除的 Elasticsearch 6.x 及以下版本
+func detect(ctx context.Context, client *elastic.Client) (*Server, error) {
+	resp, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{Method: http.MethodGet, Path: "/"})
+	if err != nil {
+		return nil, fmt.Errorf("detect server version failed: %w", err)
+	}
+	var info struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(resp.Body, &info); err != nil {
+		return nil, fmt.Errorf("detect server version failed: %v", err)
+	}
+	s := &Server{Distribution: info.Version.Distribution, Version: info.Version.Number}
+	if s.Distribution == "" {
+		s.Distribution = Elasticsearch
+	}
+	parts := strings.SplitN(s.Version, ".", 3)
+	if s.Major, err = strconv.Atoi(parts[0]); err != nil {
+		return nil, fmt.Errorf("detect server version failed: unknown version %q", s.Version)
+	}
+	if len(parts) > 1 {
+		s.Minor, _ = strconv.Atoi(parts[1])
+	}
+	if s.Distribution == Elasticsearch && s.Major < 7 {
+		return nil, fmt.Errorf("%s is not supported, mapping types were removed in elasticsearch 7.0", s)
+	}
+	return s, nil
+}
+
+// 兼容 7.x 请求与响应格式的媒体类型
+const (
+	compatJSON   = "application/vnd.elasticsearch+json; compatible-with=7"
+	compatNDJSON = "application/vnd.elasticsearch+x-ndjson; compatible-with=7"
+)
+
+// compatTransport 连接 Elasticsearch 8 时为请求带上 compatible-with=7 的媒体类型，使 ES 按 7.x 的格式处理请求与响应
+type compatTransport struct {
+	base http.RoundTripper
+	on   int32
+}
+
+func (t *compatTransport) enable() {
+	atomic.StoreInt32(&t.on, 1)
+}
+
+func (t *compatTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&t.on) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept", compatJSON)
+	if ct := req.Header.Get("Content-Type"); strings.Contains(ct, "ndjson") {
+		req.Header.Set("Content-Type", compatNDJSON)
+	} else if ct != "" {
+		req.Header.Set("Content-Type", compatJSON)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,23 @@
+package esclient
+
+import (
+	"net/http"
+
+	"lium-product/es-search/search/logs"
+)
+
+// requestIDTransport 将 ctx 中的请求 ID 写入 X-Request-ID 与 X-Opaque-Id，ES 会在慢日志与任务列表中带上 X-Opaque-Id
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := logs.RequestID(req.Context())
+	if id == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Request-ID", id)
+	req.Header.Set("X-Opaque-Id", id)
+	return t.base.RoundTrip(req)
+}
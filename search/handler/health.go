@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/db"
+	"lium-product/es-search/search/esclient"
+)
+
+// defaultReadyTimeout 就绪检查中每个依赖的默认超时时间
+const defaultReadyTimeout = 2 * time.Second
+
+// 依赖状态
+const (
+	dependencyUp      = "up"
+	dependencyDown    = "down"
+	dependencySkipped = "skipped" // 未配置该依赖
+)
+
+// Dependency 依赖的检查结果
+type Dependency struct {
+	Status  string `json:"status"`
+	Latency int64  `json:"latency_ms"`
+	Detail  string `json:"detail,omitempty"` // ES 为集群健康状态
+	Error   string `json:"error,omitempty"`
+}
+
+// errClusterRed ES 集群状态为 red，有主分片不可用
+var errClusterRed = errors.New("cluster status is red")
+
+// readyCheck 检查一个依赖，返回附加信息，依赖不可用时报错
+type readyCheck func(ctx context.Context) (string, error)
+
+// Healthz 存活检查，进程能处理请求即返回 200
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// Readyz 就绪检查：并发检查默认集群与各个命名集群的健康状态、MySQL 与 Redis，
+// 任一依赖不可用或 ES 集群为 red 时返回 503。命名集群的结果为 elastic/<name>
+func Readyz(c *gin.Context) {
+	checks := map[string]readyCheck{"elastic": checkElastic(esclient.GetClient)}
+	for _, name := range esclient.ClusterNames() {
+		name := name
+		checks["elastic/"+name] = checkElastic(func() (*elastic.Client, error) { return esclient.GetCluster(name) })
+	}
+	if cfg.LoadMysql().Address != "" {
+		checks["mysql"] = checkMysql
+	}
+	if cfg.LoadRedis().Address != "" {
+		checks["redis"] = checkRedis
+	}
+	timeout := time.Duration(cfg.LoadCommon().ReadyTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	deps := map[string]*Dependency{"mysql": {Status: dependencySkipped}, "redis": {Status: dependencySkipped}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check readyCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+			defer cancel()
+			start := time.Now()
+			detail, err := runCheck(ctx, check)
+			d := &Dependency{Status: dependencyUp, Latency: time.Since(start).Milliseconds(), Detail: detail}
+			if err != nil {
+				d.Status, d.Error = dependencyDown, err.Error()
+			}
+			mu.Lock()
+			deps[name] = d
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	for _, d := range deps {
+		if d.Status == dependencyDown {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "not ready", "data": deps})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "data": deps})
+}
+
+// runCheck 执行检查，超时后不再等待。首次建立连接时客户端可能不响应 ctx，检查在单独的 goroutine 中执行
+func runCheck(ctx context.Context, check readyCheck) (string, error) {
+	type result struct {
+		detail string
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		detail, err := check(ctx)
+		ch <- result{detail, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.detail, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// checkElastic 集群的健康状态，red 视为不可用
+func checkElastic(get func() (*elastic.Client, error)) readyCheck {
+	return func(ctx context.Context) (string, error) {
+		client, err := get()
+		if err != nil {
+			return "", err
+		}
+		health, err := esclient.Call(ctx, client, client.ClusterHealth().Do)
+		if err != nil {
+			return "", err
+		}
+		if health.Status == "red" {
+			return health.Status, errClusterRed
+		}
+		return health.Status, nil
+	}
+}
+
+// checkMysql ping MySQL
+func checkMysql(ctx context.Context) (string, error) {
+	gdb, err := db.GetMysql()
+	if err != nil {
+		return "", err
+	}
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		return "", err
+	}
+	return "", sqlDB.PingContext(ctx)
+}
+
+// checkRedis ping Redis
+func checkRedis(ctx context.Context) (string, error) {
+	client, err := db.GetRedis()
+	if err != nil {
+		return "", err
+	}
+	return "", client.Ping(ctx).Err()
+}
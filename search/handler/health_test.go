@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/esclient"
+	testcommon "lium-product/es-search/tests/common_test"
+)
+
+// readyz 请求 /readyz，返回状态码与各依赖的检查结果
+func readyz(t *testing.T) (int, map[string]Dependency) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/readyz", Readyz)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body struct {
+		Data map[string]Dependency `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body.Data
+}
+
+func TestReadyz(t *testing.T) {
+	health := func(status string) json.RawMessage {
+		return json.RawMessage(`{"status":"` + status + `"}`)
+	}
+	main, other := testcommon.NewMockServer(), testcommon.NewMockServer()
+	defer main.Close()
+	defer other.Close()
+	main.Register("/_cluster/health", health("green"))
+	other.Register("/_cluster/health", health("yellow"))
+
+	// MySQL 与 Redis 未配置地址时不检查
+	cfg.SetInstance(&cfg.Cfg{
+		Common:        cfg.Common{ReadyTimeout: 50},
+		ElasticSearch: cfg.ElasticSearch{Clusters: map[string]cfg.ElasticSearch{"logs": {}}},
+	})
+	defer cfg.SetInstance(nil)
+	esclient.SetClient(main.NewElasticClient())
+	esclient.SetCluster("logs", other.NewElasticClient())
+	defer esclient.SetClient(nil)
+
+	code, deps := readyz(t)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, dependencyUp, deps["elastic"].Status)
+	assert.Equal(t, "green", deps["elastic"].Detail)
+	assert.Equal(t, "yellow", deps["elastic/logs"].Detail)
+	assert.Equal(t, dependencySkipped, deps["mysql"].Status)
+	assert.Equal(t, dependencySkipped, deps["redis"].Status)
+
+	// 命名集群为 red
+	other.Register("/_cluster/health", health("red"))
+	code, deps = readyz(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, dependencyDown, deps["elastic/logs"].Status)
+	assert.Equal(t, errClusterRed.Error(), deps["elastic/logs"].Error)
+	other.Register("/_cluster/health", health("green"))
+
+	// 依赖超过 ready-timeout 没有响应
+	main.RegisterHandler("/_cluster/health", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	code, deps = readyz(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, dependencyDown, deps["elastic"].Status)
+	assert.Contains(t, deps["elastic"].Error, "deadline exceeded")
+	assert.Equal(t, dependencyUp, deps["elastic/logs"].Status)
+}
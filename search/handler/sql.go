@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/breaker"
+	"lium-product/es-search/search/db"
+	"lium-product/es-search/search/engine"
+	"lium-product/es-search/search/esclient"
+	"lium-product/es-search/search/logs"
+	"lium-product/es-search/search/middleware"
+)
+
+// SqlRequest SQL 查询请求
+type SqlRequest struct {
+	Sql    string `json:"sql" binding:"required"`
+	DryRun bool   `json:"dry_run"` // 写语句只返回将受影响的行数
+	Async  bool   `json:"async"`   // UPDATE / DELETE 以异步任务执行，立即返回任务 ID
+
+	Confirm bool `json:"confirm"` // 确认执行代价超过确认阈值的查询
+	Timeout int  `json:"timeout"` // 查询的超时时间(Second)，为 0 时使用默认值，不能超过角色允许的最大值
+
+	Cluster string `json:"cluster"` // 语句中没有集群前缀时访问的命名集群，为空时使用默认集群
+}
+
+// defaultTimeout 未配置 query.timeout 时的查询超时时间
+const defaultTimeout = 30 * time.Second
+
+// statusClientClosed 客户端在查询完成前断开连接
+const statusClientClosed = 499
+
+// Query 执行 SQL 查询，EXPLAIN 语句只返回翻译后的 DSL
+func Query(c *gin.Context) {
+	var req SqlRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	middleware.SetQuery(c, req.Sql)
+	timeout, err := queryTimeout(cfg.LoadQuery(), req.Timeout, middleware.GetIdentity(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	e, err := newEngine(append(requestOptions(c),
+		engine.WithDryRun(req.DryRun),
+		engine.WithAsync(req.Async),
+		engine.WithConfirm(req.Confirm),
+		engine.WithTimeout(timeout),
+		engine.WithCluster(req.Cluster),
+	)...)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
+	}
+	res, err := e.Execute(c.Request.Context(), req.Sql)
+	if errors.Is(err, context.Canceled) {
+		logs.WithContext(c.Request.Context()).Infof("sql query cancelled by client, sql: %s", req.Sql)
+		c.AbortWithStatus(statusClientClosed)
+		return
+	}
+	if err != nil {
+		logs.WithContext(c.Request.Context()).Warnf("sql query failed, sql: %s, err: %v", req.Sql, err)
+		c.JSON(errorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "data": res})
+}
+
+// queryTimeout 请求的超时时间，未指定时使用配置的默认值，超过请求者角色允许的最大值时报错
+func queryTimeout(q cfg.Query, seconds int, id *middleware.Identity) (time.Duration, error) {
+	timeout := time.Duration(q.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	max := time.Duration(q.MaxTimeout) * time.Second
+	if max <= 0 {
+		max = timeout
+	}
+	if id != nil {
+		for _, r := range id.Roles {
+			if d := time.Duration(q.RoleMaxTimeout[r]) * time.Second; d > max {
+				max = d
+			}
+		}
+	}
+	if seconds <= 0 {
+		if timeout > max {
+			return max, nil
+		}
+		return timeout, nil
+	}
+	if d := time.Duration(seconds) * time.Second; d <= max {
+		return d, nil
+	}
+	return 0, fmt.Errorf("timeout %ds exceeds the maximum of %s", seconds, max)
+}
+
+// newEngine 按配置创建执行引擎，opts 为请求级别的选项，ES 客户端不可用时报错
+func newEngine(opts ...engine.Option) (*engine.Engine, error) {
+	client, err := esclient.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	q := cfg.LoadQuery()
+	return engine.New(client, append([]engine.Option{
+		engine.WithMysql(db.GetMysql),
+		engine.WithClusters(esclient.ClusterNames(), esclient.GetCluster),
+		engine.WithTaskNotifier(notifyTask),
+		engine.WithJoinTables(q.JoinTables),
+		engine.WithLimits(engine.Limits{
+			MaxJoinRows:   q.MaxJoinRows,
+			JoinBatchSize: q.JoinBatchSize,
+			MaxJoinFanOut: q.MaxJoinFanOut,
+			MaxJoinKeys:   q.MaxJoinKeys,
+
+			MaxSubqueryRows: q.MaxSubqueryRows,
+		}),
+	}, opts...)...), nil
+}
+
+// requestOptions 请求者相关的引擎选项
+func requestOptions(c *gin.Context) []engine.Option {
+	id := middleware.GetIdentity(c)
+	owner := ""
+	if id != nil {
+		owner = id.Subject
+	}
+	var roles []string
+	if id != nil {
+		roles = id.Roles
+	}
+	return []engine.Option{
+		engine.WithAdmin(id.IsAdmin()),
+		engine.WithOwner(owner),
+		engine.WithCostLimits(costLimits(cfg.LoadCost(), roles)),
+	}
+}
+
+// costLimits 请求者角色的代价阈值，有多个已配置的角色时每一项取最宽松的阈值
+func costLimits(c cfg.Cost, roles []string) engine.CostLimits {
+	var matched []cfg.CostLimits
+	for _, r := range roles {
+		if l, ok := c.Roles[r]; ok {
+			matched = append(matched, l)
+		}
+	}
+	if len(matched) == 0 {
+		matched = []cfg.CostLimits{c.Default}
+	}
+	out := engine.CostLimits{Confirm: thresholds(matched[0].Confirm), Reject: thresholds(matched[0].Reject)}
+	for _, l := range matched[1:] {
+		out.Confirm = looser(out.Confirm, thresholds(l.Confirm))
+		out.Reject = looser(out.Reject, thresholds(l.Reject))
+	}
+	return out
+}
+
+func thresholds(t cfg.CostThresholds) engine.CostThresholds {
+	return engine.CostThresholds{
+		MaxIndices:   t.MaxIndices,
+		MaxTimeRange: t.MaxTimeRange,
+		MaxTermsSize: t.MaxTermsSize,
+		MaxAggDepth:  t.MaxAggDepth,
+		MaxScripts:   t.MaxScripts,
+	}
+}
+
+// looser 逐项取较宽松的阈值，0 表示不限制
+func looser(a, b engine.CostThresholds) engine.CostThresholds {
+	maxInt := func(x, y int) int {
+		if x == 0 || y == 0 {
+			return 0
+		}
+		if x > y {
+			return x
+		}
+		return y
+	}
+	a.MaxIndices = maxInt(a.MaxIndices, b.MaxIndices)
+	a.MaxTermsSize = maxInt(a.MaxTermsSize, b.MaxTermsSize)
+	a.MaxAggDepth = maxInt(a.MaxAggDepth, b.MaxAggDepth)
+	a.MaxScripts = maxInt(a.MaxScripts, b.MaxScripts)
+	if a.MaxTimeRange != 0 && (b.MaxTimeRange == 0 || b.MaxTimeRange > a.MaxTimeRange) {
+		a.MaxTimeRange = b.MaxTimeRange
+	}
+	return a
+}
+
+// errorStatus 依赖熔断、并发已满或 ES 没有可用节点使用 503，ES 返回的错误使用 502，没有权限或代价超过拒绝阈值使用 403，
+// 需要确认使用 428，任务或集群不存在使用 404，查询超时使用 504，其余视为请求错误
+func errorStatus(err error) int {
+	if breaker.IsRejected(err) || errors.Is(err, elastic.ErrNoClient) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, engine.ErrQueryTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, engine.ErrPermissionDenied) || errors.Is(err, engine.ErrCostExceeded) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, engine.ErrConfirmRequired) {
+		return http.StatusPreconditionRequired
+	}
+	if errors.Is(err, engine.ErrTaskNotFound) || errors.Is(err, engine.ErrUnknownCluster) {
+		return http.StatusNotFound
+	}
+	var esErr *elastic.Error
+	if errors.As(err, &esErr) {
+		return http.StatusBadGateway
+	}
+	return http.StatusBadRequest
+}
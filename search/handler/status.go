@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"lium-product/es-search/search/breaker"
+)
+
+// Status 各依赖熔断器的状态与并发数
+func Status(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "data": gin.H{"breakers": breaker.Statuses()}})
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/db"
+	"lium-product/es-search/search/engine"
+	"lium-product/es-search/search/logs"
+)
+
+// GetTask 查询异步任务的进度
+func GetTask(c *gin.Context) {
+	e, err := newEngine(requestOptions(c)...)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
+	}
+	t, err := e.Task(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "data": t})
+}
+
+// ListTasks 当前用户发起的异步任务，可以按 status 过滤
+func ListTasks(c *gin.Context) {
+	e, err := newEngine(requestOptions(c)...)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
+	}
+	tasks, err := e.Tasks(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "data": tasks})
+}
+
+// CancelTask 取消运行中的异步任务
+func CancelTask(c *gin.Context) {
+	e, err := newEngine(requestOptions(c)...)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
+	}
+	t, err := e.CancelTask(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "data": t})
+}
+
+// WatchTasks 创建任务表并在后台刷新运行中的任务，ctx 取消时退出。
+// MySQL 或 ES 暂时不可用时按指数退避重试，最长间隔为刷新间隔
+func WatchTasks(ctx context.Context) {
+	interval := time.Duration(cfg.LoadTask().PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	wait := time.Second
+	for {
+		e, err := taskWatcher()
+		if err == nil {
+			e.WatchTasks(ctx, interval)
+			return
+		}
+		logs.GetLogger().Warnf("start task watcher failed, retry in %s: %v", wait, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > interval {
+			wait = interval
+		}
+	}
+}
+
+// taskWatcher 创建任务表，返回刷新任务使用的执行引擎
+func taskWatcher() (*engine.Engine, error) {
+	gdb, err := db.GetMysql()
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.MigrateTasks(gdb); err != nil {
+		return nil, fmt.Errorf("migrate task table failed: %w", err)
+	}
+	return newEngine(engine.WithAdmin(true))
+}
+
+var notifyClient = &http.Client{Timeout: 5 * time.Second}
+
+// notifyTask 任务结束时将任务以 POST JSON 发送到配置的地址。通知在后台发送，
+// 不阻塞查询任务的请求与后台刷新，发送失败只记录日志
+func notifyTask(ctx context.Context, t *engine.Task) {
+	addr := cfg.LoadTask().NotifyURL
+	if addr == "" {
+		return
+	}
+	body, _ := json.Marshal(t)
+	id, ctx := t.ID, context.WithoutCancel(ctx)
+	go func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewReader(body))
+		if err != nil {
+			logs.WithContext(ctx).Warnf("notify task %s failed: %v", id, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := notifyClient.Do(req)
+		if err != nil {
+			logs.WithContext(ctx).Warnf("notify task %s failed: %v", id, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logs.WithContext(ctx).Warnf("notify task %s failed: %s", id, resp.Status)
+		}
+	}()
+}
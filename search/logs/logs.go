@@ -1,6 +1,7 @@
 package logs
 
 import (
+	"context"
 	"sync"
 
 	"lium-product/es-search/pkg/cfg"
@@ -40,3 +41,33 @@ func GetCrontabLogger() *common_logs.Logger {
 
 	return LogCrontab
 }
+
+// Sync 将已初始化的日志的缓冲写入输出，退出前调用
+func Sync() {
+	for _, l := range []*common_logs.Logger{Log, LogSync, LogCrontab} {
+		if l != nil {
+			_ = l.Sync()
+		}
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID 在 ctx 中记录请求 ID，之后的日志与 ES 请求都会带上该 ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID ctx 中的请求 ID，没有时返回空字符串
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithContext 带有 ctx 中请求 ID 的日志
+func WithContext(ctx context.Context) *common_logs.Logger {
+	if id := RequestID(ctx); id != "" {
+		return GetLogger().With("request_id", id)
+	}
+	return GetLogger()
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "es_search"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	esQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "es_query_duration_seconds",
+		Help:      "Elasticsearch search latency by cluster and query type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"cluster", "type", "result"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups by cache and result (hit / miss).",
+	}, []string{"cache", "result"})
+
+	bulkDocuments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bulk_documents_total",
+		Help:      "Documents written by bulk requests by cluster and result (succeeded / failed).",
+	}, []string{"cluster", "result"})
+
+	bulkDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bulk_duration_seconds",
+		Help:      "Bulk request latency by cluster.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"cluster"})
+
+	jobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Background job runs by job and result (ok / error).",
+	}, []string{"job", "result"})
+
+	tasksFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_finished_total",
+		Help:      "Asynchronous tasks finished by kind and status.",
+	}, []string{"kind", "status"})
+)
+
+// Handler /metrics 接口
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest 记录一次 HTTP 请求，route 为路由模板
+func ObserveRequest(route, method string, status int, d time.Duration) {
+	s := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, s).Inc()
+	httpDuration.WithLabelValues(route, method, s).Observe(d.Seconds())
+}
+
+// ObserveSearch 记录一次 ES 查询，typ 为 search / aggregation / scan。
+// 索引名来自用户的 SQL（可能带通配符或逗号分隔多个索引），不作为标签，只按已配置的集群区分
+func ObserveSearch(cluster, typ string, d time.Duration, err error) {
+	esQueryDuration.WithLabelValues(clusterLabel(cluster), typ, result(err)).Observe(d.Seconds())
+}
+
+// CacheLookup 记录一次缓存查找
+func CacheLookup(cache string, hit bool) {
+	r := "miss"
+	if hit {
+		r = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, r).Inc()
+}
+
+// ObserveBulk 记录一次 bulk 写入的成功与失败文档数
+func ObserveBulk(cluster string, succeeded, failed int, d time.Duration) {
+	c := clusterLabel(cluster)
+	bulkDocuments.WithLabelValues(c, "succeeded").Add(float64(succeeded))
+	bulkDocuments.WithLabelValues(c, "failed").Add(float64(failed))
+	bulkDuration.WithLabelValues(c).Observe(d.Seconds())
+}
+
+// JobRun 记录一次后台任务的执行结果
+func JobRun(job string, err error) {
+	jobRuns.WithLabelValues(job, result(err)).Inc()
+}
+
+// TaskFinished 记录一个异步任务结束
+func TaskFinished(kind, status string) {
+	tasksFinished.WithLabelValues(kind, status).Inc()
+}
+
+// clusterLabel 默认集群记为 default
+func clusterLabel(cluster string) string {
+	if cluster == "" {
+		return "default"
+	}
+	return cluster
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
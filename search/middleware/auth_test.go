@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := func(anonymous bool) *gin.Engine {
+		r := gin.New()
+		r.Use(Auth("secret", anonymous))
+		r.GET("/", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"admin": GetIdentity(c).IsAdmin()})
+		})
+		return r
+	}
+
+	admin, err := NewToken(&Identity{Subject: "ops", Roles: []string{RoleAdmin}}, "secret")
+	assert.NoError(t, err)
+	expired, _ := NewToken(&Identity{Subject: "ops", Roles: []string{RoleAdmin}, Expire: time.Now().Add(-time.Minute).Unix()}, "secret")
+	forged, _ := NewToken(&Identity{Subject: "ops", Roles: []string{RoleAdmin}}, "other")
+
+	tests := []struct {
+		name      string
+		header    string
+		anonymous bool
+		code      int
+		body      string
+	}{
+		{name: "anonymous rejected", code: http.StatusUnauthorized, body: `{"message":"missing authorization token"}`},
+		{name: "anonymous allowed", anonymous: true, code: http.StatusOK, body: `{"admin":false}`},
+		{name: "admin with anonymous allowed", header: "Bearer " + admin, anonymous: true, code: http.StatusOK, body: `{"admin":true}`},
+		{name: "forged with anonymous allowed", header: "Bearer " + forged, anonymous: true, code: http.StatusUnauthorized, body: `{"message":"invalid token signature"}`},
+		{name: "admin", header: "Bearer " + admin, code: http.StatusOK, body: `{"admin":true}`},
+		{name: "expired", header: "Bearer " + expired, code: http.StatusUnauthorized, body: `{"message":"token expired"}`},
+		{name: "forged", header: "Bearer " + forged, code: http.StatusUnauthorized, body: `{"message":"invalid token signature"}`},
+		{name: "malformed", header: "Bearer abc", code: http.StatusUnauthorized, body: `{"message":"malformed token"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router(tt.anonymous).ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.JSONEq(t, tt.body, w.Body.String())
+		})
+	}
+}
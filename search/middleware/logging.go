@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lium-product/es-search/pkg/common_logs"
+	"lium-product/es-search/search/logs"
+)
+
+// HeaderRequestID 请求 ID 的请求头与响应头
+const HeaderRequestID = "X-Request-ID"
+
+const queryHashKey = "query_hash"
+
+// RequestID 使用请求头中的 X-Request-ID，没有时生成一个，写入响应头与请求的 ctx，
+// 之后通过 logs.WithContext 输出的日志与发往 ES 的请求都会带上该 ID
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Header(HeaderRequestID, id)
+		c.Request = c.Request.WithContext(logs.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// SetQuery 记录请求执行的 SQL，访问日志中输出其 hash，便于按语句聚合而不在日志中保存完整 SQL
+func SetQuery(c *gin.Context, sql string) {
+	sum := sha256.Sum256([]byte(sql))
+	c.Set(queryHashKey, hex.EncodeToString(sum[:8]))
+}
+
+// AccessLog 请求结束后输出结构化的访问日志
+func AccessLog(l *common_logs.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		user := ""
+		if id := GetIdentity(c); id != nil {
+			user = id.Subject
+		}
+		kv := []any{
+			"request_id", logs.RequestID(c.Request.Context()),
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"user", user,
+		}
+		if hash := c.GetString(queryHashKey); hash != "" {
+			kv = append(kv, "query_hash", hash)
+		}
+		if len(c.Errors) > 0 {
+			kv = append(kv, "errors", c.Errors.String())
+		}
+		l.Infow("access", kv...)
+	}
+}
+
+// Recovery 捕获 handler 中的 panic，输出堆栈后返回 500
+func Recovery(l *common_logs.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				l.Errorw("panic recovered",
+					"request_id", logs.RequestID(c.Request.Context()),
+					"method", c.Request.Method,
+					"path", c.Request.URL.Path,
+					"panic", r,
+					"stack", string(debug.Stack()))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "internal server error"})
+			}
+		}()
+		c.Next()
+	}
+}
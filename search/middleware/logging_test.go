@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"lium-product/es-search/pkg/common_logs"
+	"lium-product/es-search/search/logs"
+)
+
+func TestAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, recorded := observer.New(zapcore.InfoLevel)
+	l := &common_logs.Logger{Logger: zap.New(core)}
+
+	r := gin.New()
+	r.Use(RequestID(), AccessLog(l), Recovery(l), Auth("secret", true))
+	r.POST("/sql", func(c *gin.Context) {
+		SetQuery(c, "SELECT 1")
+		c.JSON(http.StatusOK, gin.H{"request_id": logs.RequestID(c.Request.Context())})
+	})
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	token, _ := NewToken(&Identity{Subject: "ops"}, "secret")
+	req := httptest.NewRequest(http.MethodPost, "/sql", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(HeaderRequestID, "req-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "req-1", w.Header().Get(HeaderRequestID))
+	assert.JSONEq(t, `{"request_id":"req-1"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	generated := w.Header().Get(HeaderRequestID)
+	assert.Len(t, generated, 32)
+
+	entries := recorded.All()
+	if !assert.Len(t, entries, 3) {
+		return
+	}
+	access := entries[0].ContextMap()
+	assert.Equal(t, "access", entries[0].Message)
+	assert.Equal(t, "req-1", access["request_id"])
+	assert.Equal(t, int64(http.StatusOK), access["status"])
+	assert.Equal(t, "ops", access["user"])
+	assert.Equal(t, "/sql", access["path"])
+	assert.Len(t, access["query_hash"], 16)
+
+	assert.Equal(t, "panic recovered", entries[1].Message)
+	assert.Equal(t, generated, entries[1].ContextMap()["request_id"])
+	assert.Contains(t, entries[1].ContextMap()["stack"], "TestAccessLog")
+	assert.Equal(t, int64(http.StatusInternalServerError), entries[2].ContextMap()["status"])
+}
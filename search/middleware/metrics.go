@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lium-product/es-search/search/metrics"
+)
+
+// Metrics 按路由模板、方法与状态码记录请求数与耗时，未匹配路由的请求记为 unmatched，避免路径作为标签值导致基数过大
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(route, c.Request.Method, c.Writer.Status(), time.Since(start))
+	}
+}
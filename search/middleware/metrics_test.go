@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"lium-product/es-search/pkg/common_logs"
+	"lium-product/es-search/search/metrics"
+)
+
+// scrape 读取 /metrics 中各个序列的当前值，序列不存在时为 0
+func scrape(r http.Handler, series ...string) []float64 {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	values := make(map[string]float64)
+	s := bufio.NewScanner(w.Body)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.LastIndexByte(line, ' '); i > 0 && !strings.HasPrefix(line, "#") {
+			values[line[:i]], _ = strconv.ParseFloat(line[i+1:], 64)
+		}
+	}
+	out := make([]float64, len(series))
+	for i, name := range series {
+		out[i] = values[name]
+	}
+	return out
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics(), Recovery(&common_logs.Logger{Logger: zap.NewNop()}))
+	r.GET("/tasks/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// 指标注册在全局 registry 中，只断言本次请求带来的增量
+	series := []string{
+		`es_search_http_requests_total{method="GET",route="/tasks/:id",status="404"}`,
+		`es_search_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`es_search_http_request_duration_seconds_count{method="GET",route="/tasks/:id",status="404"}`,
+		`es_search_http_requests_total{method="GET",route="/panic",status="500"}`,
+	}
+	before := scrape(r, series...)
+	for _, path := range []string{"/tasks/1", "/tasks/2", "/missing", "/panic"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	after := scrape(r, series...)
+	for i, want := range []float64{2, 1, 2, 1} {
+		assert.Equal(t, want, after[i]-before[i], series[i])
+	}
+}
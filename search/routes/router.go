@@ -6,6 +6,12 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+
+	"lium-product/es-search/pkg/cfg"
+	"lium-product/es-search/search/handler"
+	"lium-product/es-search/search/logs"
+	"lium-product/es-search/search/metrics"
+	"lium-product/es-search/search/middleware"
 )
 
 func Init(mode string) *gin.Engine {
@@ -13,16 +19,25 @@ func Init(mode string) *gin.Engine {
 		gin.SetMode(gin.ReleaseMode) // gin设置成发布模式
 	}
 	r := gin.New()
-	r.Use(Cors())
+	// Recovery 在 AccessLog 与 Metrics 之后注册，panic 恢复为 500 后仍会被记录
+	r.Use(middleware.RequestID(), middleware.AccessLog(logs.GetLogger()), middleware.Metrics(),
+		middleware.Recovery(logs.GetLogger()), Cors())
 	group := r.Group("")
 	group.GET("/", func(context *gin.Context) {
 		context.JSON(http.StatusOK, gin.H{
 			"message": "ok",
 		})
 	})
+	group.GET("/healthz", handler.Healthz)
+	group.GET("/readyz", handler.Readyz)
+	group.GET("/status", handler.Status)
+	group.GET("/metrics", gin.WrapH(metrics.Handler()))
 	// 做鉴权的
-	g := group.Group("/api/v1")
-	fmt.Println(g)
+	g := group.Group("/api/v1", middleware.Auth(cfg.LoadJwt().Key, cfg.LoadCommon().AllowAnonymous()))
+	g.POST("/sql", handler.Query)
+	g.GET("/tasks", handler.ListTasks)
+	g.GET("/tasks/:id", handler.GetTask)
+	g.POST("/tasks/:id/cancel", handler.CancelTask)
 	r.NoRoute(func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "404",
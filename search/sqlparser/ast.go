@@ -0,0 +1,566 @@
+package sqlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Statement SQL 语句
+type Statement interface {
+	statementNode()
+}
+
+// Expr 表达式
+type Expr interface {
+	exprNode()
+	String() string
+}
+
+// SelectStmt 查询语句
+type SelectStmt struct {
+	Distinct bool
+	Fields   []*SelectField
+	From     *TableRef
+	Joins    []*Join
+	Where    Expr
+	GroupBy  []Expr
+	Having   Expr
+	OrderBy  []*OrderItem
+	Limit    int64 // -1 表示未指定
+	Offset   int64
+}
+
+func (*SelectStmt) statementNode() {}
+
+// HasLimit 是否指定了 LIMIT
+func (s *SelectStmt) HasLimit() bool {
+	return s.Limit >= 0
+}
+
+func (s *SelectStmt) String() string {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if s.Distinct {
+		b.WriteString("DISTINCT ")
+	}
+	fields := make([]string, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		item := f.Expr.String()
+		if f.Alias != "" {
+			item += " AS " + f.Alias
+		}
+		fields = append(fields, item)
+	}
+	b.WriteString(strings.Join(fields, ", "))
+	if s.From != nil {
+		b.WriteString(" FROM " + s.From.String())
+	}
+	for _, j := range s.Joins {
+		if j.Left {
+			b.WriteString(" LEFT")
+		}
+		b.WriteString(" JOIN " + j.Table.String() + " ON " + j.On.String())
+	}
+	if s.Where != nil {
+		b.WriteString(" WHERE " + s.Where.String())
+	}
+	if len(s.GroupBy) > 0 {
+		items := make([]string, 0, len(s.GroupBy))
+		for _, e := range s.GroupBy {
+			items = append(items, e.String())
+		}
+		b.WriteString(" GROUP BY " + strings.Join(items, ", "))
+	}
+	if s.Having != nil {
+		b.WriteString(" HAVING " + s.Having.String())
+	}
+	if len(s.OrderBy) > 0 {
+		b.WriteString(" ORDER BY " + orderString(s.OrderBy))
+	}
+	if s.HasLimit() {
+		fmt.Fprintf(&b, " LIMIT %d", s.Limit)
+		if s.Offset > 0 {
+			fmt.Fprintf(&b, " OFFSET %d", s.Offset)
+		}
+	}
+	return b.String()
+}
+
+// UnionStmt UNION / UNION ALL，按位置对齐各个 SELECT 的字段；OrderBy 与 Limit 作用于合并后的结果
+type UnionStmt struct {
+	Selects []*SelectStmt
+	All     []bool // All[i] 表示 Selects[i] 与 Selects[i+1] 之间是否为 UNION ALL
+	OrderBy []*OrderItem
+	Limit   int64 // -1 表示未指定
+	Offset  int64
+}
+
+func (*UnionStmt) statementNode() {}
+
+// HasLimit 是否指定了 LIMIT
+func (u *UnionStmt) HasLimit() bool {
+	return u.Limit >= 0
+}
+
+// InsertStmt INSERT INTO t (a, b) VALUES (...), (...) 或 INSERT INTO t [(a, b)] SELECT ...
+type InsertStmt struct {
+	Table   string
+	Columns []string
+	Rows    [][]Expr
+	Select  *SelectStmt // INSERT ... SELECT 的查询，与 Rows 互斥
+}
+
+func (*InsertStmt) statementNode() {}
+
+// Assignment UPDATE 中的 SET col = expr
+type Assignment struct {
+	Column string
+	Value  Expr
+}
+
+// UpdateStmt UPDATE t SET ... WHERE ...
+type UpdateStmt struct {
+	Table *TableRef
+	Set   []*Assignment
+	Where Expr
+}
+
+func (*UpdateStmt) statementNode() {}
+
+// DeleteStmt DELETE FROM t WHERE ...
+type DeleteStmt struct {
+	Table *TableRef
+	Where Expr
+}
+
+func (*DeleteStmt) statementNode() {}
+
+// ColumnDef 建表语句中的字段定义，例如 amount DECIMAL(10, 2)
+type ColumnDef struct {
+	Name   string
+	Type   string // 大写的类型名
+	Params []int  // 类型参数，例如 VARCHAR(255) 中的 255
+}
+
+// CreateTableStmt CREATE TABLE [IF NOT EXISTS] t (col TYPE, ...) [WITH (key = value, ...)]
+type CreateTableStmt struct {
+	Table       string
+	IfNotExists bool
+	Columns     []*ColumnDef
+	Options     map[string]string // WITH 中的索引设置，键为小写
+}
+
+func (*CreateTableStmt) statementNode() {}
+
+// AlterTableStmt ALTER TABLE t ADD [COLUMN] col TYPE, ...，只支持新增字段
+type AlterTableStmt struct {
+	Table string
+	Add   []*ColumnDef
+}
+
+func (*AlterTableStmt) statementNode() {}
+
+// ExplainStmt EXPLAIN 语句，只翻译不执行
+type ExplainStmt struct {
+	Stmt Statement
+}
+
+func (*ExplainStmt) statementNode() {}
+
+// SelectField 查询字段
+type SelectField struct {
+	Expr  Expr
+	Alias string
+	Raw   string // 原始 SQL 片段，未指定别名时作为列名
+}
+
+// Name 返回查询结果中的列名
+func (f *SelectField) Name() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	if c, ok := f.Expr.(*ColumnRef); ok {
+		return c.Name
+	}
+	if f.Raw != "" {
+		return f.Raw
+	}
+	return f.Expr.String()
+}
+
+// TableRef 数据源（索引），Select 不为空时为派生表 (SELECT ...) alias
+type TableRef struct {
+	Name   string
+	Alias  string
+	Select *SelectStmt
+}
+
+func (t *TableRef) String() string {
+	s := t.Name
+	if t.Select != nil {
+		s = "(" + t.Select.String() + ")"
+	}
+	if t.Alias != "" {
+		s += " " + t.Alias
+	}
+	return s
+}
+
+// Join JOIN 子句
+type Join struct {
+	Left  bool // LEFT JOIN，否则为 INNER JOIN
+	Table *TableRef
+	On    Expr
+}
+
+// OrderItem 排序项
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+// ColumnRef 字段引用，对象字段使用点号路径，例如 user.name
+type ColumnRef struct {
+	Name string
+}
+
+func (*ColumnRef) exprNode() {}
+
+func (c *ColumnRef) String() string {
+	return c.Name
+}
+
+// StarExpr 通配字段 * 或 t.*
+type StarExpr struct {
+	Table string
+}
+
+func (*StarExpr) exprNode() {}
+
+func (s *StarExpr) String() string {
+	if s.Table != "" {
+		return s.Table + ".*"
+	}
+	return "*"
+}
+
+// StringLit 字符串字面量
+type StringLit struct {
+	Val string
+}
+
+func (*StringLit) exprNode() {}
+
+func (s *StringLit) String() string {
+	return "'" + strings.ReplaceAll(s.Val, "'", "''") + "'"
+}
+
+// NumberLit 数字字面量
+type NumberLit struct {
+	Raw string
+}
+
+func (*NumberLit) exprNode() {}
+
+func (n *NumberLit) String() string {
+	return n.Raw
+}
+
+// IsInt 是否为整数
+func (n *NumberLit) IsInt() bool {
+	_, err := strconv.ParseInt(n.Raw, 10, 64)
+	return err == nil
+}
+
+// Value 返回 int64 或 float64
+func (n *NumberLit) Value() interface{} {
+	if i, err := strconv.ParseInt(n.Raw, 10, 64); err == nil {
+		return i
+	}
+	f, _ := strconv.ParseFloat(n.Raw, 64)
+	return f
+}
+
+// Float 返回浮点值
+func (n *NumberLit) Float() float64 {
+	f, _ := strconv.ParseFloat(n.Raw, 64)
+	return f
+}
+
+// BoolLit 布尔字面量
+type BoolLit struct {
+	Val bool
+}
+
+func (*BoolLit) exprNode() {}
+
+func (b *BoolLit) String() string {
+	if b.Val {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// NullLit NULL
+type NullLit struct{}
+
+func (*NullLit) exprNode() {}
+
+func (*NullLit) String() string {
+	return "NULL"
+}
+
+// BinaryExpr 二元表达式，Op 为大写形式，例如 AND、OR、=、<>、+
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+func (*BinaryExpr) exprNode() {}
+
+func (b *BinaryExpr) String() string {
+	return fmt.Sprintf("%s %s %s", wrap(b.Left), b.Op, wrap(b.Right))
+}
+
+// UnaryExpr 一元表达式，Op 为 NOT 或 -
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+func (*UnaryExpr) exprNode() {}
+
+func (u *UnaryExpr) String() string {
+	if u.Op == "NOT" {
+		return "NOT " + wrap(u.Expr)
+	}
+	return u.Op + wrap(u.Expr)
+}
+
+// FuncCall 函数调用，Name 为大写形式
+type FuncCall struct {
+	Name     string
+	Args     []Expr
+	Distinct bool
+	Star     bool         // COUNT(*)
+	OrderBy  []*OrderItem // FIRST(field ORDER BY ts) 等函数内的排序
+	Over     *WindowSpec  // 窗口函数的 OVER 子句
+}
+
+// WindowSpec 窗口定义
+type WindowSpec struct {
+	PartitionBy []Expr
+	OrderBy     []*OrderItem
+}
+
+func (w *WindowSpec) String() string {
+	var parts []string
+	if len(w.PartitionBy) > 0 {
+		items := make([]string, 0, len(w.PartitionBy))
+		for _, e := range w.PartitionBy {
+			items = append(items, e.String())
+		}
+		parts = append(parts, "PARTITION BY "+strings.Join(items, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		parts = append(parts, "ORDER BY "+orderString(w.OrderBy))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func orderString(items []*OrderItem) string {
+	out := make([]string, 0, len(items))
+	for _, o := range items {
+		item := o.Expr.String()
+		if o.Desc {
+			item += " DESC"
+		}
+		out = append(out, item)
+	}
+	return strings.Join(out, ", ")
+}
+
+func (*FuncCall) exprNode() {}
+
+func (f *FuncCall) String() string {
+	if f.Star {
+		return f.Name + "(*)"
+	}
+	args := make([]string, 0, len(f.Args))
+	for _, a := range f.Args {
+		args = append(args, a.String())
+	}
+	prefix := ""
+	if f.Distinct {
+		prefix = "DISTINCT "
+	}
+	suffix := ""
+	if len(f.OrderBy) > 0 {
+		suffix = " ORDER BY " + orderString(f.OrderBy)
+	}
+	s := fmt.Sprintf("%s(%s%s%s)", f.Name, prefix, strings.Join(args, ", "), suffix)
+	if f.Over != nil {
+		s += " OVER " + f.Over.String()
+	}
+	return s
+}
+
+// CaseExpr CASE [operand] WHEN ... THEN ... [ELSE ...] END，Operand 为空时是搜索式 CASE
+type CaseExpr struct {
+	Operand Expr
+	Whens   []*WhenClause
+	Else    Expr
+}
+
+// WhenClause CASE 中的一个 WHEN 分支
+type WhenClause struct {
+	Cond   Expr
+	Result Expr
+}
+
+func (*CaseExpr) exprNode() {}
+
+func (c *CaseExpr) String() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	if c.Operand != nil {
+		b.WriteString(" " + c.Operand.String())
+	}
+	for _, w := range c.Whens {
+		b.WriteString(" WHEN " + w.Cond.String() + " THEN " + w.Result.String())
+	}
+	if c.Else != nil {
+		b.WriteString(" ELSE " + c.Else.String())
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// InExpr IN 表达式
+type InExpr struct {
+	Expr   Expr
+	List   []Expr
+	Select *SelectStmt // IN (SELECT ...) 子查询，由执行引擎先行执行并替换为 List
+	Not    bool
+}
+
+func (*InExpr) exprNode() {}
+
+func (in *InExpr) String() string {
+	if in.Select != nil {
+		return fmt.Sprintf("%s %sIN (%s)", wrap(in.Expr), not(in.Not), in.Select.String())
+	}
+	items := make([]string, 0, len(in.List))
+	for _, e := range in.List {
+		items = append(items, e.String())
+	}
+	return fmt.Sprintf("%s %sIN (%s)", wrap(in.Expr), not(in.Not), strings.Join(items, ", "))
+}
+
+// BetweenExpr BETWEEN 表达式
+type BetweenExpr struct {
+	Expr  Expr
+	Lower Expr
+	Upper Expr
+	Not   bool
+}
+
+func (*BetweenExpr) exprNode() {}
+
+func (b *BetweenExpr) String() string {
+	return fmt.Sprintf("%s %sBETWEEN %s AND %s", wrap(b.Expr), not(b.Not), wrap(b.Lower), wrap(b.Upper))
+}
+
+// IsNullExpr IS [NOT] NULL 表达式
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+func (*IsNullExpr) exprNode() {}
+
+func (i *IsNullExpr) String() string {
+	return fmt.Sprintf("%s IS %sNULL", wrap(i.Expr), not(i.Not))
+}
+
+// LikeExpr LIKE 表达式，ILIKE 为忽略大小写的 LIKE
+type LikeExpr struct {
+	Expr            Expr
+	Pattern         Expr
+	Escape          string
+	Not             bool
+	CaseInsensitive bool
+}
+
+func (*LikeExpr) exprNode() {}
+
+func (l *LikeExpr) String() string {
+	op := "LIKE"
+	if l.CaseInsensitive {
+		op = "ILIKE"
+	}
+	s := fmt.Sprintf("%s %s%s %s", wrap(l.Expr), not(l.Not), op, wrap(l.Pattern))
+	if l.Escape != "" {
+		s += " ESCAPE " + (&StringLit{Val: l.Escape}).String()
+	}
+	return s
+}
+
+func wrap(e Expr) string {
+	switch e.(type) {
+	case *BinaryExpr, *InExpr, *BetweenExpr, *IsNullExpr, *LikeExpr:
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func not(b bool) string {
+	if b {
+		return "NOT "
+	}
+	return ""
+}
+
+// Walk 深度优先遍历表达式，fn 返回 false 时不再深入子节点
+func Walk(e Expr, fn func(Expr) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	switch n := e.(type) {
+	case *BinaryExpr:
+		Walk(n.Left, fn)
+		Walk(n.Right, fn)
+	case *UnaryExpr:
+		Walk(n.Expr, fn)
+	case *FuncCall:
+		for _, a := range n.Args {
+			Walk(a, fn)
+		}
+		for _, o := range n.OrderBy {
+			Walk(o.Expr, fn)
+		}
+	case *CaseExpr:
+		Walk(n.Operand, fn)
+		for _, w := range n.Whens {
+			Walk(w.Cond, fn)
+			Walk(w.Result, fn)
+		}
+		Walk(n.Else, fn)
+	case *InExpr:
+		Walk(n.Expr, fn)
+		for _, a := range n.List {
+			Walk(a, fn)
+		}
+	case *BetweenExpr:
+		Walk(n.Expr, fn)
+		Walk(n.Lower, fn)
+		Walk(n.Upper, fn)
+	case *IsNullExpr:
+		Walk(n.Expr, fn)
+	case *LikeExpr:
+		Walk(n.Expr, fn)
+		Walk(n.Pattern, fn)
+	}
+}
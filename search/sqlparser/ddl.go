@@ -0,0 +1,156 @@
+package sqlparser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseCreateTable 解析 CREATE TABLE [IF NOT EXISTS] t (col TYPE, ...) [WITH (key = value, ...)]
+func (p *parser) parseCreateTable() (*CreateTableStmt, error) {
+	if err := p.expectKeyword("CREATE"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &CreateTableStmt{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeyword("NOT"); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = true
+	}
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = table
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	for {
+		col, err := p.parseColumnDef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, col)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("WITH") {
+		return stmt, nil
+	}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	stmt.Options = make(map[string]string)
+	for {
+		key := p.next()
+		if key.Kind != TokIdent {
+			p.pos--
+			return nil, p.errorf("expected option name")
+		}
+		if err := p.expectOp("="); err != nil {
+			return nil, err
+		}
+		v := p.next()
+		if v.Kind != TokIdent && v.Kind != TokNumber && v.Kind != TokString {
+			p.pos--
+			return nil, p.errorf("expected option value")
+		}
+		stmt.Options[strings.ToLower(key.Text)] = v.Text
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseAlterTable 解析 ALTER TABLE t ADD [COLUMN] col TYPE, ...。
+// ES 的 mapping 不能删除字段或修改字段类型，其他修改直接报错
+func (p *parser) parseAlterTable() (*AlterTableStmt, error) {
+	if err := p.expectKeyword("ALTER"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &AlterTableStmt{Table: table}
+	for {
+		if !p.acceptKeyword("ADD") {
+			for _, kw := range []string{"DROP", "MODIFY", "CHANGE", "RENAME", "ALTER"} {
+				if p.isKeyword(kw) {
+					return nil, p.errorf("unsupported alteration: Elasticsearch mappings cannot drop, rename or change existing fields")
+				}
+			}
+			return nil, p.errorf("expected ADD")
+		}
+		p.acceptKeyword("COLUMN")
+		col, err := p.parseColumnDef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Add = append(stmt.Add, col)
+		if !p.acceptOp(",") {
+			return stmt, nil
+		}
+	}
+}
+
+// parseColumnDef 解析 name TYPE[(n[, m])]，字段名可以带点号表示对象字段
+func (p *parser) parseColumnDef() (*ColumnDef, error) {
+	t := p.next()
+	if t.Kind != TokIdent {
+		p.pos--
+		return nil, p.errorf("expected column name")
+	}
+	col := &ColumnDef{Name: t.Text}
+	for p.peek().Kind == TokOp && p.peek().Text == "." {
+		p.pos++
+		part := p.next()
+		if part.Kind != TokIdent {
+			p.pos--
+			return nil, p.errorf("expected field name after '.'")
+		}
+		col.Name += "." + part.Text
+	}
+	typ := p.next()
+	if typ.Kind != TokIdent || typ.Quoted {
+		p.pos--
+		return nil, p.errorf("expected column type")
+	}
+	col.Type = strings.ToUpper(typ.Text)
+	if !p.acceptOp("(") {
+		return col, nil
+	}
+	for {
+		n := p.next()
+		v, err := strconv.Atoi(n.Text)
+		if n.Kind != TokNumber || err != nil {
+			p.pos--
+			return nil, p.errorf("expected integer")
+		}
+		col.Params = append(col.Params, v)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
@@ -0,0 +1,213 @@
+package sqlparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind 词法单元类型
+type TokenKind int
+
+const (
+	TokEOF    TokenKind = iota // 结束
+	TokIdent                   // 标识符或关键字
+	TokString                  // 字符串字面量
+	TokNumber                  // 数字字面量
+	TokOp                      // 运算符及标点
+)
+
+// Token 词法单元
+type Token struct {
+	Kind   TokenKind
+	Text   string
+	Pos    int  // 起始位置
+	End    int  // 结束位置（不含）
+	Quoted bool // 是否为反引号包裹的标识符
+}
+
+// lexer SQL 词法分析器
+type lexer struct {
+	src string
+	pos int
+}
+
+// tokenize 将 SQL 拆分为词法单元
+func tokenize(src string) ([]Token, error) {
+	l := &lexer{src: src}
+	tokens := make([]Token, 0, 32)
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == TokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (Token, error) {
+	l.skipSpace()
+	if l.pos >= len(l.src) {
+		return Token{Kind: TokEOF, Pos: l.pos, End: l.pos}, nil
+	}
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case isIdentStart(c):
+		for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+			l.pos++
+		}
+		return Token{Kind: TokIdent, Text: l.src[start:l.pos], Pos: start, End: l.pos}, nil
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+		return l.number(), nil
+	case c == '\'' || c == '"':
+		return l.string(c)
+	case c == '`':
+		l.pos++
+		var sb strings.Builder
+		for {
+			if l.pos >= len(l.src) {
+				return Token{}, fmt.Errorf("unterminated quoted identifier at position %d", start)
+			}
+			if l.src[l.pos] == '`' {
+				if l.pos+1 < len(l.src) && l.src[l.pos+1] == '`' {
+					sb.WriteByte('`')
+					l.pos += 2
+					continue
+				}
+				l.pos++
+				break
+			}
+			sb.WriteByte(l.src[l.pos])
+			l.pos++
+		}
+		return Token{Kind: TokIdent, Text: sb.String(), Pos: start, End: l.pos, Quoted: true}, nil
+	}
+
+	// 双字符运算符
+	if l.pos+1 < len(l.src) {
+		switch two := l.src[l.pos : l.pos+2]; two {
+		case "<=", ">=", "<>", "!=", "||", "&&":
+			l.pos += 2
+			return Token{Kind: TokOp, Text: two, Pos: start, End: l.pos}, nil
+		}
+	}
+	switch c {
+	case '=', '<', '>', '+', '-', '*', '/', '%', '(', ')', ',', '.', ';', '!':
+		l.pos++
+		return Token{Kind: TokOp, Text: string(c), Pos: start, End: l.pos}, nil
+	}
+	return Token{}, fmt.Errorf("unexpected character %q at position %d", c, start)
+}
+
+// skipSpace 跳过空白与注释
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case c == '-' && strings.HasPrefix(l.src[l.pos:], "-- "), c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				l.pos = len(l.src)
+				return
+			}
+			l.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) number() Token {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		save := l.pos
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+				l.pos++
+			}
+		} else {
+			l.pos = save
+		}
+	}
+	return Token{Kind: TokNumber, Text: l.src[start:l.pos], Pos: start, End: l.pos}
+}
+
+// string 解析字符串，支持连续两个引号转义与反斜杠转义
+func (l *lexer) string(quote byte) (Token, error) {
+	start := l.pos
+	l.pos++
+	var sb strings.Builder
+	for {
+		if l.pos >= len(l.src) {
+			return Token{}, fmt.Errorf("unterminated string at position %d", start)
+		}
+		c := l.src[l.pos]
+		if c == quote {
+			if l.pos+1 < len(l.src) && l.src[l.pos+1] == quote {
+				sb.WriteByte(quote)
+				l.pos += 2
+				continue
+			}
+			l.pos++
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			l.pos++
+			switch n := l.src[l.pos]; n {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case '0':
+				sb.WriteByte(0)
+			case '%', '_':
+				// 与 MySQL 一致，保留 LIKE 通配符的转义
+				sb.WriteByte('\\')
+				sb.WriteByte(n)
+			default:
+				sb.WriteByte(n)
+			}
+			l.pos++
+			continue
+		}
+		sb.WriteByte(c)
+		l.pos++
+	}
+	return Token{Kind: TokString, Text: sb.String(), Pos: start, End: l.pos}, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,892 @@
+package sqlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reserved 保留字，不能直接作为字段名或隐式别名
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "HAVING": true,
+	"ORDER": true, "LIMIT": true, "OFFSET": true, "AS": true, "AND": true, "OR": true,
+	"NOT": true, "IN": true, "IS": true, "NULL": true, "LIKE": true, "ILIKE": true, "BETWEEN": true,
+	"ASC": true, "DESC": true, "DISTINCT": true, "TRUE": true, "FALSE": true, "ESCAPE": true,
+	"ON": true, "JOIN": true, "INNER": true, "LEFT": true, "UNION": true, "ALL": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true, "OVER": true,
+}
+
+// SyntaxError SQL 语法错误
+type SyntaxError struct {
+	Pos  int
+	Near string
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Near == "" {
+		return fmt.Sprintf("sql syntax error at end of input: %s", e.Msg)
+	}
+	return fmt.Sprintf("sql syntax error near '%s' at position %d: %s", e.Near, e.Pos, e.Msg)
+}
+
+type parser struct {
+	src  string
+	toks []Token
+	pos  int
+}
+
+// Parse 解析一条 SQL 语句
+func Parse(sql string) (Statement, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptOp(";")
+	if p.peek().Kind != TokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return stmt, nil
+}
+
+// ParseSelect 解析查询语句
+func ParseSelect(sql string) (*SelectStmt, error) {
+	stmt, err := Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(*SelectStmt)
+	if !ok {
+		return nil, fmt.Errorf("not a SELECT statement")
+	}
+	return sel, nil
+}
+
+// ParseExpr 解析单个表达式
+func ParseExpr(s string) (Expr, error) {
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Kind != TokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return e, nil
+}
+
+func newParser(sql string) (*parser, error) {
+	toks, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{src: sql, toks: toks}, nil
+}
+
+func (p *parser) parseStatement() (Statement, error) {
+	if p.acceptKeyword("EXPLAIN") {
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		return &ExplainStmt{Stmt: stmt}, nil
+	}
+	switch {
+	case p.isKeyword("SELECT") || (p.peek().Kind == TokOp && p.peek().Text == "("):
+		return p.parseQuery()
+	case p.isKeyword("INSERT"):
+		return p.parseInsert()
+	case p.isKeyword("UPDATE"):
+		return p.parseUpdate()
+	case p.isKeyword("DELETE"):
+		return p.parseDelete()
+	case p.isKeyword("CREATE"):
+		return p.parseCreateTable()
+	case p.isKeyword("ALTER"):
+		return p.parseAlterTable()
+	}
+	return nil, p.errorf("unsupported statement")
+}
+
+// parseQuery 解析 SELECT 或 UNION。未加括号时最后一个 SELECT 之后的 ORDER BY / LIMIT 作用于合并后的结果
+func (p *parser) parseQuery() (Statement, error) {
+	first, err := p.parseUnionOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isKeyword("UNION") {
+		if err := p.parseSelectTail(first); err != nil {
+			return nil, err
+		}
+		if p.isKeyword("UNION") {
+			return nil, p.errorf("ORDER BY / LIMIT before UNION must be inside parentheses")
+		}
+		return first, nil
+	}
+	u := &UnionStmt{Selects: []*SelectStmt{first}}
+	for p.acceptKeyword("UNION") {
+		all := p.acceptKeyword("ALL")
+		if !all {
+			p.acceptKeyword("DISTINCT")
+		}
+		s, err := p.parseUnionOperand()
+		if err != nil {
+			return nil, err
+		}
+		u.Selects = append(u.Selects, s)
+		u.All = append(u.All, all)
+	}
+	tail := &SelectStmt{Limit: -1}
+	if err := p.parseSelectTail(tail); err != nil {
+		return nil, err
+	}
+	u.OrderBy, u.Limit, u.Offset = tail.OrderBy, tail.Limit, tail.Offset
+	return u, nil
+}
+
+// parseUnionOperand 解析 UNION 的操作数：不带 ORDER BY / LIMIT 的 SELECT，或带括号的完整 SELECT
+func (p *parser) parseUnionOperand() (*SelectStmt, error) {
+	if p.acceptOp("(") {
+		s, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		return s, p.expectOp(")")
+	}
+	return p.parseSelectCore()
+}
+
+func (p *parser) parseSelect() (*SelectStmt, error) {
+	stmt, err := p.parseSelectCore()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, p.parseSelectTail(stmt)
+}
+
+// parseSelectCore 解析 SELECT ... HAVING，不包括 ORDER BY 与 LIMIT
+func (p *parser) parseSelectCore() (*SelectStmt, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &SelectStmt{Limit: -1}
+	if p.acceptKeyword("DISTINCT") {
+		stmt.Distinct = true
+	} else {
+		p.acceptKeyword("ALL")
+	}
+
+	for {
+		f, err := p.parseSelectField()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Fields = append(stmt.Fields, f)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("FROM") {
+		t, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.From = t
+		for {
+			j, ok, err := p.parseJoin()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			stmt.Joins = append(stmt.Joins, j)
+		}
+	}
+
+	var err error
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("GROUP") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.GroupBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseSelectTail 解析 [ORDER BY ...] [LIMIT ...]
+func (p *parser) parseSelectTail(stmt *SelectStmt) error {
+	var err error
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return err
+		}
+		if stmt.OrderBy, err = p.parseOrderBy(); err != nil {
+			return err
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		if err = p.parseLimit(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseSelectField() (*SelectField, error) {
+	if p.acceptOp("*") {
+		return &SelectField{Expr: &StarExpr{}}, nil
+	}
+	// t.*
+	if t := p.peek(); t.Kind == TokIdent && p.peekN(1).Text == "." && p.peekN(2).Text == "*" {
+		p.pos += 3
+		return &SelectField{Expr: &StarExpr{Table: t.Text}}, nil
+	}
+
+	start := p.peek().Pos
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	f := &SelectField{Expr: e, Raw: strings.TrimSpace(p.src[start:p.toks[p.pos-1].End])}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return nil, err
+	}
+	f.Alias = alias
+	return f, nil
+}
+
+// parseAlias 解析 [AS] alias
+func (p *parser) parseAlias() (string, error) {
+	if p.acceptKeyword("AS") {
+		t := p.next()
+		if t.Kind != TokIdent && t.Kind != TokString {
+			p.pos--
+			return "", p.errorf("expected alias after AS")
+		}
+		return t.Text, nil
+	}
+	if t := p.peek(); t.Kind == TokIdent && (t.Quoted || !reserved[strings.ToUpper(t.Text)]) {
+		p.pos++
+		return t.Text, nil
+	}
+	return "", nil
+}
+
+func (p *parser) parseTableRef() (*TableRef, error) {
+	// 派生表 (SELECT ...) alias
+	if p.acceptOp("(") {
+		sub, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		alias, err := p.parseAlias()
+		if err != nil {
+			return nil, err
+		}
+		if alias == "" {
+			return nil, p.errorf("derived table must have an alias")
+		}
+		return &TableRef{Select: sub, Alias: alias}, nil
+	}
+	name, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return nil, err
+	}
+	return &TableRef{Name: name, Alias: alias}, nil
+}
+
+// parseJoin 解析 [INNER] JOIN t ON ... 与 LEFT [OUTER] JOIN t ON ...
+func (p *parser) parseJoin() (*Join, bool, error) {
+	j := &Join{}
+	switch {
+	case p.acceptKeyword("JOIN"):
+	case p.isKeyword("INNER") && p.peekN(1).Kind == TokIdent && strings.EqualFold(p.peekN(1).Text, "JOIN"):
+		p.pos += 2
+	case p.isKeyword("LEFT") && p.peekN(1).Text != "(":
+		p.pos++
+		p.acceptKeyword("OUTER")
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return nil, false, err
+		}
+		j.Left = true
+	default:
+		return nil, false, nil
+	}
+	t, err := p.parseTableRef()
+	if err != nil {
+		return nil, false, err
+	}
+	j.Table = t
+	if err = p.expectKeyword("ON"); err != nil {
+		return nil, false, err
+	}
+	if j.On, err = p.parseExpr(); err != nil {
+		return nil, false, err
+	}
+	return j, true, nil
+}
+
+// parseTableName 解析索引名，索引名中允许出现 - * . 等字符，例如 logs-2024.01.*
+func (p *parser) parseTableName() (string, error) {
+	first := p.peek()
+	if first.Kind == TokIdent && first.Quoted {
+		p.pos++
+		return first.Text, nil
+	}
+	if first.Kind != TokIdent && first.Kind != TokNumber && first.Text != "*" {
+		return "", p.errorf("expected table name")
+	}
+	if first.Kind == TokIdent && reserved[strings.ToUpper(first.Text)] {
+		return "", p.errorf("expected table name")
+	}
+	p.pos++
+	end := first.End
+	for {
+		t := p.peek()
+		if t.Pos != end || t.Kind == TokEOF || t.Kind == TokString {
+			break
+		}
+		if t.Kind == TokOp && t.Text != "-" && t.Text != "*" && t.Text != "." {
+			break
+		}
+		if t.Kind == TokIdent && t.Quoted {
+			break
+		}
+		p.pos++
+		end = t.End
+	}
+	return p.src[first.Pos:end], nil
+}
+
+func (p *parser) parseOrderBy() ([]*OrderItem, error) {
+	var items []*OrderItem
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := &OrderItem{Expr: e}
+		if p.acceptKeyword("DESC") {
+			item.Desc = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+		items = append(items, item)
+		if !p.acceptOp(",") {
+			return items, nil
+		}
+	}
+}
+
+// parseLimit 支持 LIMIT n、LIMIT n OFFSET m 与 LIMIT m, n
+func (p *parser) parseLimit(stmt *SelectStmt) error {
+	n, err := p.parseInt()
+	if err != nil {
+		return err
+	}
+	stmt.Limit = n
+	if p.acceptOp(",") {
+		if stmt.Limit, err = p.parseInt(); err != nil {
+			return err
+		}
+		stmt.Offset = n
+	} else if p.acceptKeyword("OFFSET") {
+		if stmt.Offset, err = p.parseInt(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseInt() (int64, error) {
+	t := p.next()
+	if t.Kind != TokNumber {
+		p.pos--
+		return 0, p.errorf("expected integer")
+	}
+	n, err := strconv.ParseInt(t.Text, 10, 64)
+	if err != nil || n < 0 {
+		p.pos--
+		return 0, p.errorf("expected non-negative integer")
+	}
+	return n, nil
+}
+
+func (p *parser) parseExprList() ([]Expr, error) {
+	var list []Expr
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.acceptOp(",") {
+			return list, nil
+		}
+	}
+}
+
+// parseExpr 表达式入口，优先级从低到高：OR < AND < NOT < 比较 < 加减 < 乘除 < 一元
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") || p.acceptOp("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") || p.acceptOp("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Expr: e}, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.Kind == TokOp {
+		switch t.Text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.pos++
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := t.Text
+			if op == "<>" {
+				op = "!="
+			}
+			return &BinaryExpr{Op: op, Left: left, Right: right}, nil
+		}
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Expr: left, Not: not}, nil
+	}
+
+	not := false
+	if p.isKeyword("NOT") && p.peekN(1).Kind == TokIdent {
+		switch strings.ToUpper(p.peekN(1).Text) {
+		case "IN", "BETWEEN", "LIKE", "ILIKE":
+			p.pos++
+			not = true
+		}
+	}
+
+	switch {
+	case p.acceptKeyword("IN"):
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		if p.isKeyword("SELECT") {
+			sub, err := p.parseSelect()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return &InExpr{Expr: left, Select: sub, Not: not}, nil
+		}
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return &InExpr{Expr: left, List: list, Not: not}, nil
+	case p.acceptKeyword("BETWEEN"):
+		lower, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		upper, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Expr: left, Lower: lower, Upper: upper, Not: not}, nil
+	case p.isKeyword("LIKE") || p.isKeyword("ILIKE"):
+		insensitive := strings.EqualFold(p.next().Text, "ILIKE")
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		like := &LikeExpr{Expr: left, Pattern: pattern, Not: not, CaseInsensitive: insensitive}
+		if p.acceptKeyword("ESCAPE") {
+			t := p.next()
+			if t.Kind != TokString || len([]rune(t.Text)) != 1 {
+				p.pos--
+				return nil, p.errorf("ESCAPE expects a single character string")
+			}
+			like.Escape = t.Text
+		}
+		return like, nil
+	}
+	if not {
+		return nil, p.errorf("unexpected NOT")
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.Kind != TokOp || (t.Text != "+" && t.Text != "-") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: t.Text, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		op := ""
+		switch {
+		case t.Kind == TokOp && (t.Text == "*" || t.Text == "/" || t.Text == "%"):
+			op = t.Text
+		case p.isKeyword("DIV"):
+			op = "DIV"
+		case p.isKeyword("MOD"):
+			op = "%"
+		default:
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.acceptOp("-") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := e.(*NumberLit); ok {
+			return &NumberLit{Raw: "-" + n.Raw}, nil
+		}
+		return &UnaryExpr{Op: "-", Expr: e}, nil
+	}
+	if p.acceptOp("+") {
+		return p.parseUnary()
+	}
+	if p.acceptOp("!") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Expr: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	switch t.Kind {
+	case TokNumber:
+		p.pos++
+		return &NumberLit{Raw: t.Text}, nil
+	case TokString:
+		p.pos++
+		return &StringLit{Val: t.Text}, nil
+	case TokOp:
+		if t.Text == "(" {
+			p.pos++
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+		return nil, p.errorf("unexpected operator")
+	case TokIdent:
+		if !t.Quoted {
+			switch strings.ToUpper(t.Text) {
+			case "NULL":
+				p.pos++
+				return &NullLit{}, nil
+			case "TRUE":
+				p.pos++
+				return &BoolLit{Val: true}, nil
+			case "FALSE":
+				p.pos++
+				return &BoolLit{Val: false}, nil
+			case "CASE":
+				return p.parseCase()
+			}
+			if p.peekN(1).Text == "(" && p.peekN(1).Kind == TokOp {
+				return p.parseFuncCall()
+			}
+			if reserved[strings.ToUpper(t.Text)] {
+				return nil, p.errorf("unexpected keyword")
+			}
+		}
+		return p.parseColumnRef()
+	}
+	return nil, p.errorf("unexpected end of input")
+}
+
+// parseColumnRef 解析字段引用 a.b.c
+func (p *parser) parseColumnRef() (Expr, error) {
+	parts := []string{p.next().Text}
+	for p.peek().Text == "." && p.peek().Kind == TokOp {
+		p.pos++
+		t := p.next()
+		if t.Kind != TokIdent {
+			p.pos--
+			return nil, p.errorf("expected field name after '.'")
+		}
+		parts = append(parts, t.Text)
+	}
+	return &ColumnRef{Name: strings.Join(parts, ".")}, nil
+}
+
+func (p *parser) parseFuncCall() (Expr, error) {
+	name := strings.ToUpper(p.next().Text)
+	p.pos++ // (
+	fn := &FuncCall{Name: name}
+	if p.acceptOp(")") {
+		return fn, nil
+	}
+	if p.acceptOp("*") {
+		fn.Star = true
+		return fn, p.expectOp(")")
+	}
+	if p.acceptKeyword("DISTINCT") {
+		fn.Distinct = true
+	}
+	args, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	fn.Args = args
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if fn.OrderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("OVER") {
+		if fn.Over, err = p.parseWindow(); err != nil {
+			return nil, err
+		}
+	}
+	return fn, nil
+}
+
+// parseCase 解析 CASE [operand] WHEN cond THEN result ... [ELSE result] END
+func (p *parser) parseCase() (Expr, error) {
+	p.pos++ // CASE
+	c := &CaseExpr{}
+	var err error
+	if !p.isKeyword("WHEN") {
+		if c.Operand, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	for p.acceptKeyword("WHEN") {
+		w := &WhenClause{}
+		if w.Cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if w.Result, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, w)
+	}
+	if len(c.Whens) == 0 {
+		return nil, p.errorf("expected WHEN")
+	}
+	if p.acceptKeyword("ELSE") {
+		if c.Else, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return c, p.expectKeyword("END")
+}
+
+// parseWindow 解析窗口定义 OVER ([PARTITION BY ...] [ORDER BY ...])
+func (p *parser) parseWindow() (*WindowSpec, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	w := &WindowSpec{}
+	var err error
+	if p.acceptKeyword("PARTITION") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if w.PartitionBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if w.OrderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+	return w, p.expectOp(")")
+}
+
+func (p *parser) peek() Token {
+	return p.peekN(0)
+}
+
+func (p *parser) peekN(n int) Token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) next() Token {
+	t := p.peek()
+	if p.pos < len(p.toks)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.Kind == TokIdent && !t.Quoted && strings.EqualFold(t.Text, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf("expected " + kw)
+	}
+	return nil
+}
+
+func (p *parser) acceptOp(op string) bool {
+	t := p.peek()
+	if t.Kind == TokOp && t.Text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.errorf(fmt.Sprintf("expected '%s'", op))
+	}
+	return nil
+}
+
+func (p *parser) errorf(msg string) error {
+	t := p.peek()
+	return &SyntaxError{Pos: t.Pos, Near: p.src[t.Pos:t.End], Msg: msg}
+}
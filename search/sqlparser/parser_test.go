@@ -0,0 +1,279 @@
+package sqlparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelect(t *testing.T) {
+	tests := []struct {
+		name  string
+		sql   string
+		check func(t *testing.T, s *SelectStmt)
+	}{
+		{
+			name: "fields and alias",
+			sql:  "SELECT a, b AS bb, c cc, COUNT(*) FROM logs",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Len(t, s.Fields, 4)
+				assert.Equal(t, "bb", s.Fields[1].Name())
+				assert.Equal(t, "cc", s.Fields[2].Name())
+				assert.Equal(t, "COUNT(*)", s.Fields[3].Name())
+				assert.Equal(t, "logs", s.From.Name)
+			},
+		},
+		{
+			name: "case when",
+			sql:  "SELECT CASE WHEN a > 1 THEN 'big' WHEN a IS NULL THEN NULL ELSE 'small' END AS size, CASE b WHEN 1 THEN 'x' END FROM logs",
+			check: func(t *testing.T, s *SelectStmt) {
+				c := s.Fields[0].Expr.(*CaseExpr)
+				assert.Nil(t, c.Operand)
+				assert.Len(t, c.Whens, 2)
+				assert.Equal(t, "size", s.Fields[0].Name())
+				assert.Equal(t, "CASE b WHEN 1 THEN 'x' END", s.Fields[1].Expr.String())
+			},
+		},
+		{
+			name: "order by inside function",
+			sql:  "SELECT LAST(page ORDER BY ts DESC, id) FROM logs",
+			check: func(t *testing.T, s *SelectStmt) {
+				fn := s.Fields[0].Expr.(*FuncCall)
+				assert.Len(t, fn.OrderBy, 2)
+				assert.True(t, fn.OrderBy[0].Desc)
+				assert.Equal(t, "LAST(page ORDER BY ts DESC, id)", fn.String())
+			},
+		},
+		{
+			name: "window function",
+			sql:  "SELECT CUMULATIVE_SUM(SUM(pv)) OVER (PARTITION BY site ORDER BY day) AS total FROM logs",
+			check: func(t *testing.T, s *SelectStmt) {
+				fn := s.Fields[0].Expr.(*FuncCall)
+				if assert.NotNil(t, fn.Over) {
+					assert.Len(t, fn.Over.PartitionBy, 1)
+					assert.Len(t, fn.Over.OrderBy, 1)
+				}
+				assert.Equal(t, "total", s.Fields[0].Name())
+				assert.Equal(t, "CUMULATIVE_SUM(SUM(pv)) OVER (PARTITION BY site ORDER BY day)", fn.String())
+			},
+		},
+		{
+			name: "join",
+			sql:  "SELECT e.url, p.title FROM es.events e JOIN mysql.pages p ON e.page_id = p.id LEFT OUTER JOIN mysql.users u ON e.uid = u.id WHERE e.type = 'pv'",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "es.events", s.From.Name)
+				if assert.Len(t, s.Joins, 2) {
+					assert.False(t, s.Joins[0].Left)
+					assert.Equal(t, "mysql.pages", s.Joins[0].Table.Name)
+					assert.Equal(t, "p", s.Joins[0].Table.Alias)
+					assert.Equal(t, "e.page_id = p.id", s.Joins[0].On.String())
+					assert.True(t, s.Joins[1].Left)
+					assert.Equal(t, "u", s.Joins[1].Table.Alias)
+				}
+				assert.Equal(t, "e.type = 'pv'", s.Where.String())
+			},
+		},
+		{
+			name: "in subquery",
+			sql:  "SELECT * FROM users WHERE user_id NOT IN (SELECT user_id FROM orders WHERE amount > 100)",
+			check: func(t *testing.T, s *SelectStmt) {
+				in := s.Where.(*InExpr)
+				assert.True(t, in.Not)
+				assert.Equal(t, "orders", in.Select.From.Name)
+				assert.Equal(t, "user_id NOT IN (SELECT user_id FROM orders WHERE amount > 100)", in.String())
+			},
+		},
+		{
+			name: "derived table",
+			sql:  "SELECT * FROM (SELECT city, COUNT(*) AS cnt FROM orders GROUP BY city) AS t WHERE t.cnt > 10",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "t", s.From.Alias)
+				assert.Equal(t, "SELECT city, COUNT(*) AS cnt FROM orders GROUP BY city", s.From.Select.String())
+				assert.Equal(t, "t.cnt > 10", s.Where.String())
+			},
+		},
+		{
+			name: "index pattern",
+			sql:  "SELECT * FROM logs-2024.01.* l WHERE l.status = 200",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "logs-2024.01.*", s.From.Name)
+				assert.Equal(t, "l", s.From.Alias)
+				assert.Equal(t, "l.status = 200", s.Where.String())
+			},
+		},
+		{
+			name: "quoted index",
+			sql:  "SELECT `user name` FROM `logs,events`",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "logs,events", s.From.Name)
+				assert.Equal(t, "user name", s.Fields[0].Name())
+			},
+		},
+		{
+			name: "predicates",
+			sql: "SELECT a FROM t WHERE a IN (1, 2) AND b NOT BETWEEN 1 AND 5 OR c IS NOT NULL " +
+				"AND d NOT LIKE 'x%' AND NOT e = 'y'",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "((a IN (1, 2)) AND (b NOT BETWEEN 1 AND 5)) OR "+
+					"(((c IS NOT NULL) AND (d NOT LIKE 'x%')) AND NOT (e = 'y'))", s.Where.String())
+			},
+		},
+		{
+			name: "group order limit",
+			sql:  "SELECT city, SUM(amount) total FROM orders GROUP BY city HAVING total > 10 ORDER BY total DESC, city LIMIT 5, 10",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Len(t, s.GroupBy, 1)
+				assert.Equal(t, "total > 10", s.Having.String())
+				assert.True(t, s.OrderBy[0].Desc)
+				assert.False(t, s.OrderBy[1].Desc)
+				assert.Equal(t, int64(10), s.Limit)
+				assert.Equal(t, int64(5), s.Offset)
+			},
+		},
+		{
+			name: "full text functions",
+			sql:  "SELECT _score, HIGHLIGHT(title) FROM docs WHERE MATCH(title, 'foo bar', 'operator=and')",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "HIGHLIGHT(title)", s.Fields[1].Name())
+				assert.Equal(t, "MATCH(title, 'foo bar', 'operator=and')", s.Where.String())
+			},
+		},
+		{
+			name: "arithmetic precedence",
+			sql:  "SELECT a FROM t WHERE a + b * 2 > -3",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "(a + (b * 2)) > -3", s.Where.String())
+			},
+		},
+		{
+			name: "qualified star and ordinal",
+			sql:  "SELECT x.*, a FROM t ORDER BY 2 DESC",
+			check: func(t *testing.T, s *SelectStmt) {
+				assert.Equal(t, "x", s.Fields[0].Expr.(*StarExpr).Table)
+				assert.Equal(t, "2", s.OrderBy[0].Expr.(*NumberLit).Raw)
+				assert.True(t, s.OrderBy[0].Desc)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSelect(tt.sql)
+			if !assert.NoError(t, err) {
+				return
+			}
+			tt.check(t, s)
+		})
+	}
+}
+
+func TestParseUnion(t *testing.T) {
+	stmt, err := Parse("SELECT a, b FROM x UNION ALL (SELECT c, d FROM y ORDER BY c LIMIT 5) UNION SELECT e, f FROM z ORDER BY 1 DESC LIMIT 10")
+	if !assert.NoError(t, err) {
+		return
+	}
+	u, ok := stmt.(*UnionStmt)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Len(t, u.Selects, 3)
+	assert.Equal(t, []bool{true, false}, u.All)
+	assert.Equal(t, "SELECT c, d FROM y ORDER BY c LIMIT 5", u.Selects[1].String())
+	assert.Equal(t, "SELECT e, f FROM z", u.Selects[2].String())
+	assert.Equal(t, "1 DESC", orderString(u.OrderBy))
+	assert.Equal(t, int64(10), u.Limit)
+
+	stmt, err = Parse("EXPLAIN SELECT a FROM x UNION SELECT b FROM y")
+	if assert.NoError(t, err) {
+		assert.IsType(t, &UnionStmt{}, stmt.(*ExplainStmt).Stmt)
+	}
+}
+
+func TestParseWrite(t *testing.T) {
+	stmt, err := Parse("INSERT INTO logs (_id, level, user.name) VALUES ('1', 'info', 'tom'), ('2', NULL, -3)")
+	if assert.NoError(t, err) {
+		ins := stmt.(*InsertStmt)
+		assert.Equal(t, "logs", ins.Table)
+		assert.Equal(t, []string{"_id", "level", "user.name"}, ins.Columns)
+		assert.Len(t, ins.Rows, 2)
+		assert.Equal(t, "-3", ins.Rows[1][2].String())
+	}
+
+	stmt, err = Parse("INSERT INTO logs_v2 (url, agent) SELECT url, UPPER(agent) FROM logs WHERE code > 1 LIMIT 5")
+	if assert.NoError(t, err) {
+		ins := stmt.(*InsertStmt)
+		assert.Equal(t, []string{"url", "agent"}, ins.Columns)
+		assert.Nil(t, ins.Rows)
+		assert.Equal(t, "SELECT url, UPPER(agent) FROM logs WHERE code > 1 LIMIT 5", ins.Select.String())
+	}
+
+	stmt, err = Parse("UPDATE logs l SET l.level = UPPER(level), hits = hits + 1 WHERE l.user.name = 'tom'")
+	if assert.NoError(t, err) {
+		up := stmt.(*UpdateStmt)
+		assert.Equal(t, "l", up.Table.Alias)
+		assert.Len(t, up.Set, 2)
+		assert.Equal(t, "l.level", up.Set[0].Column)
+		assert.Equal(t, "hits + 1", up.Set[1].Value.String())
+		assert.Equal(t, "l.user.name = 'tom'", up.Where.String())
+	}
+
+	stmt, err = Parse("UPDATE logs SET level = 'warn'")
+	if assert.NoError(t, err) {
+		assert.Nil(t, stmt.(*UpdateStmt).Where)
+		assert.Equal(t, "", stmt.(*UpdateStmt).Table.Alias)
+	}
+
+	stmt, err = Parse("EXPLAIN DELETE FROM logs WHERE level = 'debug'")
+	if assert.NoError(t, err) {
+		del := stmt.(*ExplainStmt).Stmt.(*DeleteStmt)
+		assert.Equal(t, "logs", del.Table.Name)
+		assert.NotNil(t, del.Where)
+	}
+}
+
+func TestParseDDL(t *testing.T) {
+	stmt, err := Parse("CREATE TABLE IF NOT EXISTS es.logs (ts DATETIME, price decimal(10, 2), user.name KEYWORD) WITH (shards=3, refresh_interval='5s')")
+	if assert.NoError(t, err) {
+		c := stmt.(*CreateTableStmt)
+		assert.Equal(t, "es.logs", c.Table)
+		assert.True(t, c.IfNotExists)
+		assert.Equal(t, []*ColumnDef{
+			{Name: "ts", Type: "DATETIME"},
+			{Name: "price", Type: "DECIMAL", Params: []int{10, 2}},
+			{Name: "user.name", Type: "KEYWORD"},
+		}, c.Columns)
+		assert.Equal(t, map[string]string{"shards": "3", "refresh_interval": "5s"}, c.Options)
+	}
+
+	stmt, err = Parse("ALTER TABLE logs ADD COLUMN url KEYWORD, ADD body TEXT")
+	if assert.NoError(t, err) {
+		a := stmt.(*AlterTableStmt)
+		assert.Equal(t, "logs", a.Table)
+		assert.Equal(t, []*ColumnDef{{Name: "url", Type: "KEYWORD"}, {Name: "body", Type: "TEXT"}}, a.Add)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		msg  string
+	}{
+		{name: "missing field", sql: "SELECT FROM t", msg: "near 'FROM'"},
+		{name: "unterminated string", sql: "SELECT a FROM t WHERE a = 'x", msg: "unterminated string"},
+		{name: "trailing token", sql: "SELECT a FROM t WHERE a = 1 1", msg: "unexpected token"},
+		{name: "bad limit", sql: "SELECT a FROM t LIMIT x", msg: "expected integer"},
+		{name: "order before union", sql: "SELECT a FROM x ORDER BY a UNION SELECT b FROM y", msg: "must be inside parentheses"},
+		{name: "derived table alias", sql: "SELECT * FROM (SELECT a FROM t)", msg: "derived table must have an alias"},
+		{name: "drop column", sql: "ALTER TABLE t DROP COLUMN a", msg: "unsupported alteration"},
+		{name: "column type", sql: "CREATE TABLE t (a)", msg: "expected column type"},
+		{name: "insert without values", sql: "INSERT INTO t (a)", msg: "expected VALUES"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.sql)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package sqlparser
+
+// parseInsert 解析 INSERT INTO t (a, b) VALUES (1, 2), (3, 4) 与 INSERT INTO t [(a, b)] SELECT ...
+func (p *parser) parseInsert() (*InsertStmt, error) {
+	if err := p.expectKeyword("INSERT"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &InsertStmt{Table: table}
+	if p.acceptOp("(") {
+		for {
+			t := p.next()
+			if t.Kind != TokIdent {
+				p.pos--
+				return nil, p.errorf("expected column name")
+			}
+			name := t.Text
+			for p.peek().Kind == TokOp && p.peek().Text == "." {
+				p.pos++
+				part := p.next()
+				if part.Kind != TokIdent {
+					p.pos--
+					return nil, p.errorf("expected field name after '.'")
+				}
+				name += "." + part.Text
+			}
+			stmt.Columns = append(stmt.Columns, name)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.isKeyword("SELECT") {
+		if stmt.Select, err = p.parseSelect(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		row, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		stmt.Rows = append(stmt.Rows, row)
+		if !p.acceptOp(",") {
+			return stmt, nil
+		}
+	}
+}
+
+// parseUpdate 解析 UPDATE t [alias] SET a = expr, ... [WHERE ...]
+func (p *parser) parseUpdate() (*UpdateStmt, error) {
+	if err := p.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &UpdateStmt{Table: &TableRef{Name: name}}
+	if !p.isKeyword("SET") {
+		if stmt.Table.Alias, err = p.parseAlias(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		col, err := p.parseColumnRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp("="); err != nil {
+			return nil, err
+		}
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Set = append(stmt.Set, &Assignment{Column: col.(*ColumnRef).Name, Value: v})
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseDelete 解析 DELETE FROM t [alias] [WHERE ...]
+func (p *parser) parseDelete() (*DeleteStmt, error) {
+	if err := p.expectKeyword("DELETE"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	t, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &DeleteStmt{Table: t}
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
@@ -0,0 +1,169 @@
+package translator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// DDLRequest 建表与新增字段对应的 ES 请求
+type DDLRequest struct {
+	Index string
+	Body  map[string]interface{} // 创建索引或 put mapping 的请求体
+}
+
+// dateFormat DATE / DATETIME 接受的日期格式，同时兼容 ISO 8601 与毫秒时间戳
+const (
+	dateFormat     = "yyyy-MM-dd||strict_date_optional_time||epoch_millis"
+	datetimeFormat = "yyyy-MM-dd HH:mm:ss||strict_date_optional_time||epoch_millis"
+)
+
+// columnTypes SQL 类型与 ES 字段类型的对应关系
+var columnTypes = map[string]string{
+	"TINYINT":    "byte",
+	"SMALLINT":   "short",
+	"MEDIUMINT":  "integer",
+	"INT":        "integer",
+	"INTEGER":    "integer",
+	"BIGINT":     "long",
+	"FLOAT":      "float",
+	"DOUBLE":     "double",
+	"REAL":       "double",
+	"DECIMAL":    "scaled_float",
+	"NUMERIC":    "scaled_float",
+	"BOOL":       "boolean",
+	"BOOLEAN":    "boolean",
+	"DATE":       "date",
+	"DATETIME":   "date",
+	"TIMESTAMP":  "date",
+	"CHAR":       "keyword",
+	"VARCHAR":    "keyword",
+	"KEYWORD":    "keyword",
+	"TEXT":       "text",
+	"MEDIUMTEXT": "text",
+	"LONGTEXT":   "text",
+	"BLOB":       "binary",
+	"BINARY":     "binary",
+	"IP":         "ip",
+	"GEO_POINT":  "geo_point",
+	"OBJECT":     "object",
+	"JSON":       "object",
+	"NESTED":     "nested",
+}
+
+// indexOptions WITH 中支持的索引设置
+var indexOptions = map[string]string{
+	"shards":           "number_of_shards",
+	"replicas":         "number_of_replicas",
+	"refresh_interval": "refresh_interval",
+}
+
+// fieldMapping 字段定义转为 ES 字段 mapping
+func fieldMapping(c *sqlparser.ColumnDef) (map[string]interface{}, error) {
+	typ, ok := columnTypes[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported column type %s for %s", c.Type, c.Name)
+	}
+	maxParams := 0
+	switch c.Type {
+	case "CHAR", "VARCHAR":
+		maxParams = 1
+	case "DECIMAL", "NUMERIC":
+		maxParams = 2
+	}
+	if len(c.Params) > maxParams {
+		return nil, fmt.Errorf("invalid type parameters for %s %s", c.Name, c.Type)
+	}
+	if metaFields[c.Name] || strings.HasPrefix(c.Name, "_") {
+		return nil, fmt.Errorf("column name %s is reserved", c.Name)
+	}
+
+	m := map[string]interface{}{"type": typ}
+	switch c.Type {
+	case "DATE":
+		m["format"] = dateFormat
+	case "DATETIME", "TIMESTAMP":
+		m["format"] = datetimeFormat
+	case "CHAR", "VARCHAR":
+		if len(c.Params) == 1 {
+			m["ignore_above"] = c.Params[0]
+		}
+	case "DECIMAL", "NUMERIC":
+		scale := 0
+		if len(c.Params) == 2 {
+			scale = c.Params[1]
+		}
+		m["scaling_factor"] = math.Pow10(scale)
+	case "OBJECT", "JSON", "NESTED":
+		m["properties"] = map[string]interface{}{}
+	}
+	return m, nil
+}
+
+// properties 字段定义转为 mapping 的 properties，带点号的字段写为 object 字段的子字段
+func properties(cols []*sqlparser.ColumnDef) (map[string]interface{}, error) {
+	props := make(map[string]interface{})
+	for _, c := range cols {
+		m, err := fieldMapping(c)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(c.Name, ".")
+		parent := props
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := parent[p].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+				parent[p] = child
+			}
+			sub, ok := child["properties"].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("column %s: %s is not an object field", c.Name, p)
+			}
+			parent = sub
+		}
+		name := parts[len(parts)-1]
+		if _, ok := parent[name]; ok {
+			return nil, fmt.Errorf("duplicate column name %s", c.Name)
+		}
+		parent[name] = m
+	}
+	return props, nil
+}
+
+// TranslateCreateTable CREATE TABLE 翻译为创建索引请求
+func TranslateCreateTable(stmt *sqlparser.CreateTableStmt) (*DDLRequest, error) {
+	props, err := properties(stmt.Columns)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{"mappings": map[string]interface{}{"properties": props}}
+	if len(stmt.Options) > 0 {
+		settings := make(map[string]interface{})
+		for k, v := range stmt.Options {
+			name, ok := indexOptions[k]
+			if !ok {
+				return nil, fmt.Errorf("unsupported table option %s", k)
+			}
+			if n, err := strconv.Atoi(v); err == nil {
+				settings[name] = n
+			} else {
+				settings[name] = v
+			}
+		}
+		body["settings"] = settings
+	}
+	return &DDLRequest{Index: stmt.Table, Body: body}, nil
+}
+
+// TranslateAlterTable ALTER TABLE ADD COLUMN 翻译为 put mapping 请求
+func TranslateAlterTable(stmt *sqlparser.AlterTableStmt) (*DDLRequest, error) {
+	props, err := properties(stmt.Add)
+	if err != nil {
+		return nil, err
+	}
+	return &DDLRequest{Index: stmt.Table, Body: map[string]interface{}{"properties": props}}, nil
+}
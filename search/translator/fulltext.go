@@ -0,0 +1,352 @@
+package translator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// fullTextFuncs 全文检索函数及其最少参数个数
+//
+//	MATCH(title, 'foo bar', 'operator=and')
+//	MATCH_PHRASE(title, 'foo bar', 'slop=2')
+//	MULTI_MATCH('title^2,body', 'foo bar', 'type=best_fields')
+//	QUERY_STRING('title:foo AND body:bar', 'default_operator=and')
+//
+// 末尾的字符串参数为可选项，格式为 key=value，多个选项可写在多个参数中，也可用 ; 分隔
+var fullTextFuncs = map[string]int{
+	"MATCH":        2,
+	"MATCH_PHRASE": 2,
+	"MULTI_MATCH":  2,
+	"QUERY_STRING": 1,
+}
+
+func (b *builder) fullText(fn *sqlparser.FuncCall) (elastic.Query, error) {
+	if len(fn.Args) < fullTextFuncs[fn.Name] {
+		return nil, fmt.Errorf("%s expects at least %d arguments", fn.Name, fullTextFuncs[fn.Name])
+	}
+	switch fn.Name {
+	case "MATCH", "MATCH_PHRASE":
+		field, err := b.field(fn.Args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name, err)
+		}
+		text, err := stringArg(fn, 1)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := parseOptions(fn, 2)
+		if err != nil {
+			return nil, err
+		}
+		if fn.Name == "MATCH" {
+			return matchQuery(field, text, opts)
+		}
+		return matchPhraseQuery(field, text, opts)
+	case "MULTI_MATCH":
+		fields, err := stringArg(fn, 0)
+		if err != nil {
+			return nil, err
+		}
+		text, err := stringArg(fn, 1)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := parseOptions(fn, 2)
+		if err != nil {
+			return nil, err
+		}
+		return multiMatchQuery(splitFields(fields), text, opts)
+	default:
+		text, err := stringArg(fn, 0)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := parseOptions(fn, 1)
+		if err != nil {
+			return nil, err
+		}
+		return queryStringQuery(text, opts)
+	}
+}
+
+func matchQuery(field, text string, opts options) (elastic.Query, error) {
+	q := elastic.NewMatchQuery(field, text)
+	for k, v := range opts {
+		switch k {
+		case "operator":
+			q.Operator(v)
+		case "analyzer":
+			q.Analyzer(v)
+		case "fuzziness":
+			q.Fuzziness(v)
+		case "minimum_should_match":
+			q.MinimumShouldMatch(v)
+		case "zero_terms_query":
+			q.ZeroTermsQuery(v)
+		case "boost":
+			f, err := opts.float(k)
+			if err != nil {
+				return nil, err
+			}
+			q.Boost(f)
+		case "prefix_length":
+			i, err := opts.int(k)
+			if err != nil {
+				return nil, err
+			}
+			q.PrefixLength(i)
+		case "max_expansions":
+			i, err := opts.int(k)
+			if err != nil {
+				return nil, err
+			}
+			q.MaxExpansions(i)
+		case "lenient":
+			bv, err := opts.bool(k)
+			if err != nil {
+				return nil, err
+			}
+			q.Lenient(bv)
+		default:
+			return nil, fmt.Errorf("MATCH: unknown option '%s'", k)
+		}
+	}
+	return q, nil
+}
+
+func matchPhraseQuery(field, text string, opts options) (elastic.Query, error) {
+	q := elastic.NewMatchPhraseQuery(field, text)
+	for k, v := range opts {
+		switch k {
+		case "analyzer":
+			q.Analyzer(v)
+		case "zero_terms_query":
+			q.ZeroTermsQuery(v)
+		case "slop":
+			i, err := opts.int(k)
+			if err != nil {
+				return nil, err
+			}
+			q.Slop(i)
+		case "boost":
+			f, err := opts.float(k)
+			if err != nil {
+				return nil, err
+			}
+			q.Boost(f)
+		default:
+			return nil, fmt.Errorf("MATCH_PHRASE: unknown option '%s'", k)
+		}
+	}
+	return q, nil
+}
+
+func multiMatchQuery(fields []string, text string, opts options) (elastic.Query, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("MULTI_MATCH: fields must not be empty")
+	}
+	q := elastic.NewMultiMatchQuery(text)
+	for _, f := range fields {
+		name, boost, err := fieldWithBoost(f)
+		if err != nil {
+			return nil, err
+		}
+		if boost != nil {
+			q.FieldWithBoost(name, *boost)
+		} else {
+			q.Field(name)
+		}
+	}
+	for k, v := range opts {
+		switch k {
+		case "type":
+			q.Type(v)
+		case "operator":
+			q.Operator(v)
+		case "analyzer":
+			q.Analyzer(v)
+		case "fuzziness":
+			q.Fuzziness(v)
+		case "minimum_should_match":
+			q.MinimumShouldMatch(v)
+		case "zero_terms_query":
+			q.ZeroTermsQuery(v)
+		case "slop":
+			i, err := opts.int(k)
+			if err != nil {
+				return nil, err
+			}
+			q.Slop(i)
+		case "tie_breaker", "boost":
+			f, err := opts.float(k)
+			if err != nil {
+				return nil, err
+			}
+			if k == "boost" {
+				q.Boost(f)
+			} else {
+				q.TieBreaker(f)
+			}
+		case "lenient":
+			bv, err := opts.bool(k)
+			if err != nil {
+				return nil, err
+			}
+			q.Lenient(bv)
+		default:
+			return nil, fmt.Errorf("MULTI_MATCH: unknown option '%s'", k)
+		}
+	}
+	return q, nil
+}
+
+func queryStringQuery(text string, opts options) (elastic.Query, error) {
+	q := elastic.NewQueryStringQuery(text)
+	for k, v := range opts {
+		switch k {
+		case "default_field":
+			q.DefaultField(v)
+		case "fields":
+			for _, f := range splitFields(v) {
+				name, boost, err := fieldWithBoost(f)
+				if err != nil {
+					return nil, err
+				}
+				if boost != nil {
+					q.FieldWithBoost(name, *boost)
+				} else {
+					q.Field(name)
+				}
+			}
+		case "default_operator":
+			q.DefaultOperator(v)
+		case "analyzer":
+			q.Analyzer(v)
+		case "fuzziness":
+			q.Fuzziness(v)
+		case "minimum_should_match":
+			q.MinimumShouldMatch(v)
+		case "type":
+			q.Type(v)
+		case "time_zone":
+			q.TimeZone(v)
+		case "phrase_slop":
+			i, err := opts.int(k)
+			if err != nil {
+				return nil, err
+			}
+			q.PhraseSlop(i)
+		case "boost":
+			f, err := opts.float(k)
+			if err != nil {
+				return nil, err
+			}
+			q.Boost(f)
+		case "allow_leading_wildcard", "analyze_wildcard", "lenient":
+			bv, err := opts.bool(k)
+			if err != nil {
+				return nil, err
+			}
+			switch k {
+			case "allow_leading_wildcard":
+				q.AllowLeadingWildcard(bv)
+			case "analyze_wildcard":
+				q.AnalyzeWildcard(bv)
+			default:
+				q.Lenient(bv)
+			}
+		default:
+			return nil, fmt.Errorf("QUERY_STRING: unknown option '%s'", k)
+		}
+	}
+	return q, nil
+}
+
+// options 全文检索函数的可选项
+type options map[string]string
+
+func (o options) int(k string) (int, error) {
+	i, err := strconv.Atoi(o[k])
+	if err != nil {
+		return 0, fmt.Errorf("option '%s' expects an integer, got '%s'", k, o[k])
+	}
+	return i, nil
+}
+
+func (o options) float(k string) (float64, error) {
+	f, err := strconv.ParseFloat(o[k], 64)
+	if err != nil {
+		return 0, fmt.Errorf("option '%s' expects a number, got '%s'", k, o[k])
+	}
+	return f, nil
+}
+
+func (o options) bool(k string) (bool, error) {
+	b, err := strconv.ParseBool(o[k])
+	if err != nil {
+		return false, fmt.Errorf("option '%s' expects a boolean, got '%s'", k, o[k])
+	}
+	return b, nil
+}
+
+// parseOptions 解析从第 from 个参数开始的 key=value 选项
+func parseOptions(fn *sqlparser.FuncCall, from int) (options, error) {
+	opts := options{}
+	for i := from; i < len(fn.Args); i++ {
+		s, err := stringArg(fn, i)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range strings.Split(s, ";") {
+			kv = strings.TrimSpace(kv)
+			if kv == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s: option '%s' must be in key=value form", fn.Name, kv)
+			}
+			opts[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	return opts, nil
+}
+
+func stringArg(fn *sqlparser.FuncCall, i int) (string, error) {
+	if i >= len(fn.Args) {
+		return "", fmt.Errorf("%s: missing argument %d", fn.Name, i+1)
+	}
+	s, ok := fn.Args[i].(*sqlparser.StringLit)
+	if !ok {
+		return "", fmt.Errorf("%s: argument %d must be a string", fn.Name, i+1)
+	}
+	return s.Val, nil
+}
+
+func splitFields(s string) []string {
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// fieldWithBoost 解析 title^2 形式的字段权重
+func fieldWithBoost(f string) (string, *float64, error) {
+	name, boost, ok := strings.Cut(f, "^")
+	if !ok {
+		return f, nil, nil
+	}
+	v, err := strconv.ParseFloat(boost, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid field boost '%s'", f)
+	}
+	return name, &v, nil
+}
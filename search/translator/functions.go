@@ -0,0 +1,418 @@
+package translator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// scalarFunc 标量函数的参数个数，max 为 -1 表示不限
+type scalarFunc struct {
+	min, max int
+	str      bool // 返回字符串，决定脚本排序的类型
+}
+
+// scalarFuncs 支持的标量函数。能翻译为 painless 的在 ES 中计算，其余由执行引擎在进程内计算
+var scalarFuncs = map[string]scalarFunc{
+	"CONCAT":      {1, -1, true},
+	"SUBSTRING":   {2, 3, true},
+	"SUBSTR":      {2, 3, true},
+	"LOWER":       {1, 1, true},
+	"UPPER":       {1, 1, true},
+	"TRIM":        {1, 1, true},
+	"LENGTH":      {1, 1, false}, // 字节数，只在进程内计算
+	"CHAR_LENGTH": {1, 1, false},
+	"ROUND":       {1, 2, false},
+	"FLOOR":       {1, 1, false},
+	"CEIL":        {1, 1, false},
+	"CEILING":     {1, 1, false},
+	"ABS":         {1, 1, false},
+	"DATE_FORMAT": {2, 2, true},
+	"COALESCE":    {1, -1, false},
+	"IFNULL":      {2, 2, false},
+	"NULLIF":      {2, 2, false},
+}
+
+// IsScalarFunc 是否为标量函数
+func IsScalarFunc(e sqlparser.Expr) bool {
+	f, ok := e.(*sqlparser.FuncCall)
+	return ok && scalarFuncs[f.Name].min > 0
+}
+
+// checkScalar 检查表达式中的函数：标量函数检查参数个数，允许聚合函数时跳过聚合与窗口函数
+func checkScalar(e sqlparser.Expr, allowAgg bool) error {
+	var err error
+	sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+		fn, ok := n.(*sqlparser.FuncCall)
+		if !ok || err != nil {
+			return err == nil
+		}
+		if allowAgg && (IsAggregateFunc(fn) || IsWindowFunc(fn)) {
+			return false
+		}
+		if !IsScalarFunc(fn) {
+			err = fmt.Errorf("unsupported function %s in expression %s", fn.Name, e.String())
+			return false
+		}
+		err = CheckScalarCall(fn)
+		return err == nil
+	})
+	return err
+}
+
+// CheckScalarCall 检查标量函数调用的形式与参数个数
+func CheckScalarCall(fn *sqlparser.FuncCall) error {
+	f := scalarFuncs[fn.Name]
+	switch {
+	case fn.Star || fn.Distinct || len(fn.OrderBy) > 0 || fn.Over != nil:
+		return fmt.Errorf("invalid use of %s: %s", fn.Name, fn.String())
+	case len(fn.Args) < f.min || (f.max >= 0 && len(fn.Args) > f.max):
+		return fmt.Errorf("incorrect parameter count in the call to %s", fn.Name)
+	}
+	return nil
+}
+
+// isSimple 字段引用或字面量，可以直接翻译为 ES 查询
+func isSimple(e sqlparser.Expr) bool {
+	switch e.(type) {
+	case *sqlparser.ColumnRef, *sqlparser.StringLit, *sqlparser.NumberLit, *sqlparser.BoolLit, *sqlparser.NullLit:
+		return true
+	}
+	return false
+}
+
+// needsScript 叶子条件的操作数是表达式，或比较两个字段时，只能使用 script 查询
+func needsScript(e sqlparser.Expr) bool {
+	switch n := e.(type) {
+	case *sqlparser.BinaryExpr:
+		switch n.Op {
+		case "=", "!=", "<", "<=", ">", ">=":
+			_, l := n.Left.(*sqlparser.ColumnRef)
+			_, r := n.Right.(*sqlparser.ColumnRef)
+			return !isSimple(n.Left) || !isSimple(n.Right) || (l && r)
+		}
+	case *sqlparser.InExpr:
+		return !isSimple(n.Expr)
+	case *sqlparser.BetweenExpr:
+		return !isSimple(n.Expr)
+	case *sqlparser.IsNullExpr:
+		return !isSimple(n.Expr)
+	}
+	return false
+}
+
+// scriptType 脚本排序的类型，字段引用按数值处理
+func scriptType(e sqlparser.Expr) string {
+	switch n := e.(type) {
+	case *sqlparser.StringLit:
+		return "string"
+	case *sqlparser.FuncCall:
+		switch n.Name {
+		case "COALESCE", "IFNULL", "NULLIF":
+			return scriptType(n.Args[0])
+		}
+		if scalarFuncs[n.Name].str {
+			return "string"
+		}
+	case *sqlparser.CaseExpr:
+		return scriptType(n.Whens[0].Result)
+	}
+	return "number"
+}
+
+// referencedFields 表达式引用的源字段，用于进程内计算时从 _source 中读取
+func referencedFields(e sqlparser.Expr, alias string) []string {
+	var fields []string
+	sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+		if c, ok := n.(*sqlparser.ColumnRef); ok {
+			if f := stripAlias(c.Name, alias); !metaFields[f] {
+				fields = append(fields, f)
+			}
+		}
+		return true
+	})
+	return fields
+}
+
+// painlessHelpers 生成的 painless 中用到的辅助函数，声明在脚本开头
+var painlessHelpers = map[string]string{
+	"sqlConcat": "String sqlConcat(List a) { StringBuilder b = new StringBuilder(); " +
+		"for (def x : a) { if (x == null) { return null; } b.append(x); } return b.toString(); }",
+	"sqlSubstring": "String sqlSubstring(def s, def p, def l) { if (s == null || p == null || l == null) { return null; } " +
+		"String t = s.toString(); int n = t.length(); int b = p > 0 ? (int) p - 1 : n + (int) p; " +
+		"if (p == 0 || b < 0 || b >= n || l <= 0) { return ''; } return t.substring(b, (int) Math.min((long) n, (long) b + (long) l)); }",
+	"sqlRound": "def sqlRound(def x, def d) { if (x == null || d == null) { return null; } double m = Math.pow(10, (int) d); " +
+		"return Math.signum((double) x) * Math.round(Math.abs((double) x) * m) / m; }",
+}
+
+// script 生成 painless 脚本，body 之前声明用到的辅助函数
+func (ps *painless) script(body string) *elastic.Script {
+	names := make([]string, 0, len(ps.helpers))
+	for name := range ps.helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var decls []string
+	for _, name := range names {
+		decls = append(decls, painlessHelpers[name])
+	}
+	script := elastic.NewScript(strings.Join(append(decls, body), " ")).Lang("painless")
+	if len(ps.params) > 0 {
+		script.Params(ps.params)
+	}
+	return script
+}
+
+func (ps *painless) helper(name string) {
+	if ps.helpers == nil {
+		ps.helpers = make(map[string]bool)
+	}
+	ps.helpers[name] = true
+}
+
+// call 标量函数翻译为 painless，参数为 NULL 时的语义由调用方的空指针保护处理
+func (ps *painless) call(n *sqlparser.FuncCall) (string, error) {
+	if err := checkScalar(n, false); err != nil {
+		return "", err
+	}
+	if n.Name == "DATE_FORMAT" {
+		// _source 中的日期是字符串，只有 doc values 中的日期可以格式化
+		f, ok := n.Args[1].(*sqlparser.StringLit)
+		if !ps.doc || !ok {
+			return "", fmt.Errorf("DATE_FORMAT cannot be evaluated in painless: %s", n.String())
+		}
+		pattern, err := javaDatePattern(f.Val)
+		if err != nil {
+			return "", err
+		}
+		x, err := ps.expr(n.Args[0])
+		if err != nil {
+			return "", err
+		}
+		return x + ".format(DateTimeFormatter.ofPattern(" + ps.param(pattern) + "))", nil
+	}
+
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		s, err := ps.expr(a)
+		if err != nil {
+			return "", err
+		}
+		args[i] = s
+	}
+	switch n.Name {
+	case "CONCAT":
+		if ps.doc {
+			// 与 MySQL 一致，任一参数为 NULL 时结果为 NULL
+			ps.helper("sqlConcat")
+			return "sqlConcat([" + strings.Join(args, ", ") + "])", nil
+		}
+		return "(\"\" + " + strings.Join(args, " + ") + ")", nil
+	case "UPPER":
+		return args[0] + ".toUpperCase()", nil
+	case "LOWER":
+		return args[0] + ".toLowerCase()", nil
+	case "TRIM":
+		return args[0] + ".trim()", nil
+	case "CHAR_LENGTH":
+		return args[0] + ".length()", nil
+	case "SUBSTRING", "SUBSTR":
+		ps.helper("sqlSubstring")
+		if len(args) == 2 {
+			args = append(args, "Integer.MAX_VALUE")
+		}
+		return "sqlSubstring(" + strings.Join(args, ", ") + ")", nil
+	case "ROUND":
+		ps.helper("sqlRound")
+		if len(args) == 1 {
+			args = append(args, "0")
+		}
+		return "sqlRound(" + strings.Join(args, ", ") + ")", nil
+	case "FLOOR":
+		return "Math.floor((double) " + args[0] + ")", nil
+	case "CEIL", "CEILING":
+		return "Math.ceil((double) " + args[0] + ")", nil
+	case "ABS":
+		return "Math.abs(" + args[0] + ")", nil
+	case "IFNULL", "COALESCE":
+		x := args[len(args)-1]
+		for i := len(args) - 2; i >= 0; i-- {
+			x = "(" + args[i] + " != null ? " + args[i] + " : " + x + ")"
+		}
+		return x, nil
+	case "NULLIF":
+		return "(" + args[0] + " == " + args[1] + " ? null : " + args[0] + ")", nil
+	}
+	return "", fmt.Errorf("%s cannot be evaluated in painless", n.Name)
+}
+
+// caseExpr CASE 翻译为嵌套的条件表达式
+func (ps *painless) caseExpr(n *sqlparser.CaseExpr) (string, error) {
+	operand := ""
+	if n.Operand != nil {
+		var err error
+		if operand, err = ps.expr(n.Operand); err != nil {
+			return "", err
+		}
+	}
+	conds := make([]string, len(n.Whens))
+	results := make([]string, len(n.Whens))
+	for i, w := range n.Whens {
+		cond, err := ps.expr(w.Cond)
+		if err != nil {
+			return "", err
+		}
+		if operand != "" {
+			cond = "(" + operand + " == " + cond + ")"
+		}
+		if results[i], err = ps.expr(w.Result); err != nil {
+			return "", err
+		}
+		conds[i] = cond
+	}
+	x := "null"
+	if n.Else != nil {
+		var err error
+		if x, err = ps.expr(n.Else); err != nil {
+			return "", err
+		}
+	}
+	for i := len(conds) - 1; i >= 0; i-- {
+		x = "(" + conds[i] + " ? " + results[i] + " : " + x + ")"
+	}
+	return x, nil
+}
+
+// searchScript 查询、聚合与排序中使用的脚本，从 doc values 读取字段。
+// 字段缺失导致空指针时返回 fallback：取值为 null，过滤为 false，排序为最小值使 NULL 排在升序的最前
+func searchScript(e sqlparser.Expr, alias, fallback string) (*elastic.Script, error) {
+	ps := &painless{alias: alias, params: make(map[string]interface{}), doc: true}
+	x, err := ps.expr(e)
+	if err != nil {
+		return nil, err
+	}
+	body := "return " + x + ";"
+	if fallback != "null" {
+		body = "def v = " + x + "; return v == null ? " + fallback + " : v;"
+	}
+	return ps.script("try { " + body + " } catch (NullPointerException e) { return " + fallback + "; }"), nil
+}
+
+// valueScript 计算字段值的脚本，用于 script_fields 与聚合
+func valueScript(e sqlparser.Expr, alias string) (*elastic.Script, error) {
+	return searchScript(e, alias, "null")
+}
+
+// sortScript 脚本排序
+func sortScript(e sqlparser.Expr, alias string, desc bool) (*elastic.ScriptSort, error) {
+	typ := scriptType(e)
+	fallback := "Double.NEGATIVE_INFINITY"
+	if typ == "string" {
+		fallback = "''"
+	}
+	script, err := searchScript(e, alias, fallback)
+	if err != nil {
+		return nil, err
+	}
+	return elastic.NewScriptSort(script, typ).Order(!desc), nil
+}
+
+// SortPushable ORDER BY 的一项能否下推到 ES：字段排序或可以翻译为 painless 的表达式排序
+func SortPushable(stmt *sqlparser.SelectStmt, o *sqlparser.OrderItem) bool {
+	x := unwrapNested(o.Expr)
+	if _, ok := x.(*sqlparser.ColumnRef); ok {
+		x = unwrapNested(resolveOrderExpr(stmt, x))
+	}
+	if _, ok := x.(*sqlparser.ColumnRef); ok {
+		return true
+	}
+	if checkScalar(x, false) != nil {
+		return false
+	}
+	_, err := sortScript(x, "", o.Desc)
+	return err == nil
+}
+
+// script 操作数为表达式的条件翻译为 script 查询
+func (b *builder) script(e sqlparser.Expr) (elastic.Query, error) {
+	if err := checkScalar(e, false); err != nil {
+		return nil, err
+	}
+	script, err := searchScript(expandPredicate(e), b.alias, "false")
+	if err != nil {
+		return nil, fmt.Errorf("unsupported condition: %s: %v", e.String(), err)
+	}
+	return elastic.NewScriptQuery(script), nil
+}
+
+// expandPredicate IN 展开为等值比较的 OR，BETWEEN 展开为两个范围比较
+func expandPredicate(e sqlparser.Expr) sqlparser.Expr {
+	switch n := e.(type) {
+	case *sqlparser.InExpr:
+		op, join := "=", "OR"
+		if n.Not {
+			op, join = "!=", "AND"
+		}
+		var out sqlparser.Expr
+		for _, item := range n.List {
+			c := &sqlparser.BinaryExpr{Op: op, Left: n.Expr, Right: item}
+			if out == nil {
+				out = c
+			} else {
+				out = &sqlparser.BinaryExpr{Op: join, Left: out, Right: c}
+			}
+		}
+		return out
+	case *sqlparser.BetweenExpr:
+		out := sqlparser.Expr(&sqlparser.BinaryExpr{Op: "AND",
+			Left:  &sqlparser.BinaryExpr{Op: ">=", Left: n.Expr, Right: n.Lower},
+			Right: &sqlparser.BinaryExpr{Op: "<=", Left: n.Expr, Right: n.Upper}})
+		if n.Not {
+			out = &sqlparser.UnaryExpr{Op: "NOT", Expr: out}
+		}
+		return out
+	}
+	return e
+}
+
+// mysqlDateFormats DATE_FORMAT 的格式符与 java DateTimeFormatter 模式的对应关系
+var mysqlDateFormats = map[byte]string{
+	'Y': "yyyy", 'y': "yy", 'm': "MM", 'c': "M", 'd': "dd", 'e': "d", 'j': "DDD",
+	'H': "HH", 'k': "H", 'h': "hh", 'I': "hh", 'l': "h", 'i': "mm", 's': "ss", 'S': "ss", 'f': "SSSSSS",
+	'p': "a", 'M': "MMMM", 'b': "MMM", 'W': "EEEE", 'a': "EEE", 'T': "HH:mm:ss", 'r': "hh:mm:ss a",
+}
+
+// javaDatePattern 将 MySQL 的 DATE_FORMAT 格式转为 DateTimeFormatter 模式，普通字符加引号原样输出
+func javaDatePattern(format string) (string, error) {
+	var b strings.Builder
+	literal := ""
+	flush := func() {
+		if literal != "" {
+			b.WriteString("'" + strings.ReplaceAll(literal, "'", "''") + "'")
+			literal = ""
+		}
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			literal += format[i : i+1]
+			continue
+		}
+		i++
+		if format[i] == '%' {
+			literal += "%"
+			continue
+		}
+		p, ok := mysqlDateFormats[format[i]]
+		if !ok {
+			return "", fmt.Errorf("DATE_FORMAT: unsupported specifier %%%c", format[i])
+		}
+		flush()
+		b.WriteString(p)
+	}
+	flush()
+	return b.String(), nil
+}
@@ -0,0 +1,112 @@
+package translator
+
+import (
+	"strings"
+)
+
+// likePattern 解析后的 LIKE 模式，由字面量与通配符 % _ 组成
+type likePattern struct {
+	parts []likePart
+}
+
+type likePart struct {
+	wildcard rune // '%'、'_'，字面量为 0
+	text     string
+}
+
+// parseLikePattern 解析 LIKE 模式，escape 为空时使用反斜杠作为转义字符
+func parseLikePattern(pattern, escape string) *likePattern {
+	esc := '\\'
+	if escape != "" {
+		esc = []rune(escape)[0]
+	}
+	p := &likePattern{}
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			p.parts = append(p.parts, likePart{text: lit.String()})
+			lit.Reset()
+		}
+	}
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == esc && i+1 < len(runes):
+			// 转义字符之后的字符按字面量处理；末尾的转义字符本身视为字面量
+			i++
+			lit.WriteRune(runes[i])
+		case r == '%' || r == '_':
+			flush()
+			p.parts = append(p.parts, likePart{wildcard: r})
+		default:
+			lit.WriteRune(r)
+		}
+	}
+	flush()
+	return p
+}
+
+// matchAll 模式只包含 %，匹配任意非 NULL 值
+func (p *likePattern) matchAll() bool {
+	if len(p.parts) == 0 {
+		return false
+	}
+	for _, part := range p.parts {
+		if part.wildcard != '%' {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *likePattern) hasWildcard() bool {
+	for _, part := range p.parts {
+		if part.wildcard != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrefix 形如 'abc%'：字面量之后只有 %
+func (p *likePattern) isPrefix() bool {
+	if len(p.parts) < 2 || p.parts[0].wildcard != 0 {
+		return false
+	}
+	for _, part := range p.parts[1:] {
+		if part.wildcard != '%' {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *likePattern) prefix() string {
+	return p.parts[0].text
+}
+
+func (p *likePattern) literal() string {
+	var sb strings.Builder
+	for _, part := range p.parts {
+		sb.WriteString(part.text)
+	}
+	return sb.String()
+}
+
+// wildcard 转为 ES wildcard 语法，字面量中的 * ? \ 需要转义
+func (p *likePattern) wildcard() string {
+	escaper := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+	var sb strings.Builder
+	for _, part := range p.parts {
+		switch part.wildcard {
+		case '%':
+			sb.WriteByte('*')
+		case '_':
+			sb.WriteByte('?')
+		default:
+			sb.WriteString(escaper.Replace(part.text))
+		}
+	}
+	return sb.String()
+}
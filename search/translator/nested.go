@@ -0,0 +1,188 @@
+package translator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// Schema 索引结构信息，用于识别 nested 字段
+type Schema struct {
+	NestedPaths []string
+}
+
+// NestedPath 返回字段所属的最内层 nested 路径，普通字段返回空串
+func (s *Schema) NestedPath(field string) string {
+	if s == nil {
+		return ""
+	}
+	path := ""
+	for _, p := range s.NestedPaths {
+		if strings.HasPrefix(field, p+".") && len(p) > len(path) {
+			path = p
+		}
+	}
+	return path
+}
+
+// withPath 返回追加了 nested 路径的副本
+func (s *Schema) withPath(path string) *Schema {
+	c := &Schema{}
+	if s != nil {
+		c.NestedPaths = append(c.NestedPaths, s.NestedPaths...)
+	}
+	for _, p := range c.NestedPaths {
+		if p == path {
+			return c
+		}
+	}
+	c.NestedPaths = append(c.NestedPaths, path)
+	sort.Strings(c.NestedPaths)
+	return c
+}
+
+// explicitNested 收集语句中通过 NESTED() 显式声明的 nested 路径
+func explicitNested(stmt *sqlparser.SelectStmt, schema *Schema, alias string) (*Schema, error) {
+	exprs := []sqlparser.Expr{stmt.Where, stmt.Having}
+	for _, f := range stmt.Fields {
+		exprs = append(exprs, f.Expr)
+	}
+	exprs = append(exprs, stmt.GroupBy...)
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+	var err error
+	for _, e := range exprs {
+		sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+			fn, ok := n.(*sqlparser.FuncCall)
+			if !ok || fn.Name != "NESTED" || err != nil {
+				return err == nil
+			}
+			var path string
+			if path, err = nestedFuncPath(fn, alias); err == nil {
+				schema = schema.withPath(path)
+			}
+			return true
+		})
+	}
+	return schema, err
+}
+
+// nestedFuncPath 解析 NESTED() 的路径：
+//
+//	NESTED(items, items.sku = 'A')  WHERE 中限定同一个嵌套对象的条件
+//	NESTED(items.sku)               路径为字段的上一级
+//	NESTED(items, items.sku)        显式指定路径
+func nestedFuncPath(fn *sqlparser.FuncCall, alias string) (string, error) {
+	if len(fn.Args) == 0 || len(fn.Args) > 2 {
+		return "", fmt.Errorf("NESTED expects 1 or 2 arguments")
+	}
+	c, ok := fn.Args[0].(*sqlparser.ColumnRef)
+	if !ok {
+		return "", fmt.Errorf("NESTED expects a field path, got %s", fn.Args[0].String())
+	}
+	name := stripAlias(c.Name, alias)
+	if len(fn.Args) == 2 {
+		return name, nil
+	}
+	i := strings.LastIndex(name, ".")
+	if i <= 0 {
+		return "", fmt.Errorf("NESTED(%s): field is not inside an object", name)
+	}
+	return name[:i], nil
+}
+
+// unwrapNested 去掉 NESTED(field) / NESTED(path, field) 包装，返回内部字段
+func unwrapNested(e sqlparser.Expr) sqlparser.Expr {
+	fn, ok := e.(*sqlparser.FuncCall)
+	if !ok || fn.Name != "NESTED" {
+		return e
+	}
+	if len(fn.Args) == 1 {
+		return fn.Args[0]
+	}
+	if len(fn.Args) == 2 {
+		if c, ok := fn.Args[1].(*sqlparser.ColumnRef); ok {
+			return c
+		}
+	}
+	return e
+}
+
+// isNestedScope path 是否位于 scope 之下（scope 为空表示根文档）
+func isNestedScope(path, scope string) bool {
+	return path != "" && path != scope && (scope == "" || strings.HasPrefix(path, scope+"."))
+}
+
+// nestedFilters 从 WHERE 顶层 AND 条件中提取作用于各 nested 路径的条件，
+// 聚合进入 nested 上下文后需要再次过滤，避免统计到不满足条件的嵌套对象
+func (b *builder) nestedFilters(where sqlparser.Expr) (map[string]elastic.Query, error) {
+	filters := make(map[string][]elastic.Query)
+	for _, e := range flattenAnd(where) {
+		path := ""
+		var inner sqlparser.Expr
+		if fn, ok := e.(*sqlparser.FuncCall); ok && fn.Name == "NESTED" && len(fn.Args) == 2 {
+			p, err := nestedFuncPath(fn, b.alias)
+			if err != nil {
+				return nil, err
+			}
+			path, inner = p, fn.Args[1]
+		} else if f := b.leafField(e); f != "" {
+			path, inner = b.schema.NestedPath(f), e
+		}
+		if path == "" {
+			continue
+		}
+		nb := &builder{alias: b.alias, schema: b.schema, scope: path}
+		q, err := nb.query(inner)
+		if err != nil {
+			return nil, err
+		}
+		filters[path] = append(filters[path], q)
+	}
+	out := make(map[string]elastic.Query, len(filters))
+	for path, qs := range filters {
+		if len(qs) == 1 {
+			out[path] = qs[0]
+		} else {
+			out[path] = elastic.NewBoolQuery().Filter(qs...)
+		}
+	}
+	return out, nil
+}
+
+// aggContext 聚合在 nested 上下文之间切换
+type aggContext struct {
+	filters map[string]elastic.Query
+}
+
+// enter 从 from 上下文进入 to 上下文：进入 nested 路径使用 nested + filter，
+// 回到上层路径使用 reverse_nested。返回最外层聚合名称、聚合以及由外到内的名称路径
+func (ac *aggContext) enter(from, to, base, name string, agg elastic.Aggregation) (string, elastic.Aggregation, []string) {
+	names := []string{name}
+	push := func(suffix string, outer elastic.Aggregation) {
+		name = base + suffix
+		agg = outer
+		names = append([]string{name}, names...)
+	}
+	switch {
+	case from == to:
+	case to != "" && strings.HasPrefix(from, to+"."):
+		push("_reverse", elastic.NewReverseNestedAggregation().Path(to).SubAggregation(name, agg))
+	default:
+		if to != "" {
+			if f := ac.filters[to]; f != nil {
+				push("_filter", elastic.NewFilterAggregation().Filter(f).SubAggregation(name, agg))
+			}
+			push("_nested", elastic.NewNestedAggregation().Path(to).SubAggregation(name, agg))
+		}
+		if from != "" && !isNestedScope(to, from) {
+			push("_reverse", elastic.NewReverseNestedAggregation().SubAggregation(name, agg))
+		}
+	}
+	return name, agg, names
+}
@@ -0,0 +1,208 @@
+package translator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// windowFuncs 窗口函数，只能作用于 DATE_HISTOGRAM 分组，翻译为 ES pipeline 聚合
+//
+//	CUMULATIVE_SUM(SUM(pv)) OVER (ORDER BY day)   累计值，cumulative_sum
+//	MOVING_AVG(SUM(pv), 7) OVER (ORDER BY day)    包含当前桶在内最近 7 个桶的平均值，moving_fn
+//	DERIVATIVE(SUM(pv)) OVER (ORDER BY day)       与上一个桶的差值，derivative
+var windowFuncs = map[string]bool{
+	"CUMULATIVE_SUM": true, "MOVING_AVG": true, "DERIVATIVE": true,
+}
+
+// IsWindowFunc 是否为窗口函数
+func IsWindowFunc(e sqlparser.Expr) bool {
+	f, ok := e.(*sqlparser.FuncCall)
+	return ok && windowFuncs[f.Name]
+}
+
+// calendarInterval 可以使用 calendar_interval 的间隔，其余按 fixed_interval 处理
+var calendarInterval = map[string]bool{
+	"1m": true, "1h": true, "1d": true, "1w": true, "1M": true, "1q": true, "1y": true,
+}
+
+var intervalPattern = regexp.MustCompile(`^[0-9]+(ms|s|m|h|d|w|M|q|y)$`)
+
+// histogramColumn 解析 DATE_HISTOGRAM(field, '1d'[, 'format=yyyy-MM-dd;time_zone=+08:00;min_doc_count=1;offset=+6h'])
+func histogramColumn(fn *sqlparser.FuncCall, alias, name string, level int) (*Column, error) {
+	if len(fn.Args) < 2 {
+		return nil, fmt.Errorf("DATE_HISTOGRAM expects (field, interval)")
+	}
+	c, ok := unwrapNested(fn.Args[0]).(*sqlparser.ColumnRef)
+	if !ok {
+		return nil, fmt.Errorf("DATE_HISTOGRAM expects a field argument, got %s", fn.Args[0].String())
+	}
+	interval, err := stringArg(fn, 1)
+	if err != nil {
+		return nil, err
+	}
+	if !intervalPattern.MatchString(interval) {
+		return nil, fmt.Errorf("DATE_HISTOGRAM: invalid interval '%s'", interval)
+	}
+	opts, err := parseOptions(fn, 2)
+	if err != nil {
+		return nil, err
+	}
+	for k := range opts {
+		switch k {
+		case "format", "time_zone", "offset":
+		case "min_doc_count":
+			if _, err := opts.int(k); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("DATE_HISTOGRAM: unknown option '%s'", k)
+		}
+	}
+	return &Column{
+		Name:     fn.String(),
+		Kind:     ColumnGroup,
+		Field:    stripAlias(c.Name, alias),
+		Func:     fn.Name,
+		Agg:      name,
+		Level:    level,
+		Expr:     fn,
+		Interval: interval,
+		opts:     opts,
+	}, nil
+}
+
+// histogram 分组列对应的 date_histogram 聚合
+func (c *Column) histogram() *elastic.DateHistogramAggregation {
+	h := elastic.NewDateHistogramAggregation().Field(c.Field)
+	if calendarInterval[c.Interval] {
+		h.CalendarInterval(c.Interval)
+	} else {
+		h.FixedInterval(c.Interval)
+	}
+	for k, v := range c.opts {
+		switch k {
+		case "format":
+			h.Format(v)
+		case "time_zone":
+			h.TimeZone(v)
+		case "offset":
+			h.Offset(v)
+		case "min_doc_count":
+			n, _ := c.opts.int(k)
+			h.MinDocCount(int64(n))
+		}
+	}
+	return h
+}
+
+// windowColumn 窗口函数对应的结果列，input 为其输入的指标列
+func windowColumn(fn *sqlparser.FuncCall, input *Column, name string) (*Column, error) {
+	col := &Column{Name: fn.String(), Kind: ColumnMetric, Func: fn.Name, Agg: name, Expr: fn, Input: input}
+	if fn.Name == "MOVING_AVG" {
+		if len(fn.Args) != 2 {
+			return nil, fmt.Errorf("MOVING_AVG expects (metric, window): %s", fn.String())
+		}
+		n, ok := fn.Args[1].(*sqlparser.NumberLit)
+		if !ok || !n.IsInt() || n.Float() < 1 {
+			return nil, fmt.Errorf("MOVING_AVG: window must be a positive integer, got %s", fn.Args[1].String())
+		}
+		col.Window = int(n.Float())
+	} else if len(fn.Args) != 1 {
+		return nil, fmt.Errorf("%s expects exactly one argument", fn.Name)
+	}
+	if !input.singleValue() {
+		return nil, fmt.Errorf("%s: %s is not a single-value metric", fn.Name, input.Expr.String())
+	}
+	return col, nil
+}
+
+// pipeline 窗口函数对应的 pipeline 聚合，path 为输入指标相对于分组桶的路径
+func (c *Column) pipeline(path string) elastic.Aggregation {
+	switch c.Func {
+	case "CUMULATIVE_SUM":
+		return elastic.NewCumulativeSumAggregation().BucketsPath(path)
+	case "DERIVATIVE":
+		return elastic.NewDerivativeAggregation().BucketsPath(path)
+	default:
+		script := elastic.NewScript("MovingFunctions.unweightedAvg(values)")
+		return movingFn{elastic.NewMovFnAggregation(path, script, c.Window)}
+	}
+}
+
+// movingFn moving_fn 默认不包含当前桶，设置 shift=1 使窗口与 SQL 的
+// ROWS BETWEEN n-1 PRECEDING AND CURRENT ROW 一致（需要 ES 7.4+）
+type movingFn struct {
+	*elastic.MovFnAggregation
+}
+
+func (a movingFn) Source() (interface{}, error) {
+	src, err := a.MovFnAggregation.Source()
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := src.(map[string]interface{}); ok {
+		if body, ok := m["moving_fn"].(map[string]interface{}); ok {
+			body["shift"] = 1
+		}
+	}
+	return src, nil
+}
+
+// bucketsPath 指标相对于分组桶的 buckets_path
+func bucketsPath(m *Column, paths map[string][]string) string {
+	if m.Kind == ColumnCount {
+		return "_count"
+	}
+	return strings.Join(paths[m.Agg], ">")
+}
+
+// checkWindow 窗口函数要求最内层分组为 DATE_HISTOGRAM；OVER 中的 ORDER BY 只能是该分组升序，
+// PARTITION BY 只能引用外层分组（pipeline 聚合天然按外层分组划分）
+func checkWindow(stmt *sqlparser.SelectStmt, groups []*Column, w *Column, alias string) error {
+	if len(groups) == 0 || groups[len(groups)-1].Func != "DATE_HISTOGRAM" {
+		return fmt.Errorf("%s requires DATE_HISTOGRAM(...) as the last GROUP BY expression", w.Func)
+	}
+	hist := groups[len(groups)-1]
+	fn := w.Expr.(*sqlparser.FuncCall)
+	if fn.Over == nil {
+		return nil
+	}
+	for _, o := range fn.Over.OrderBy {
+		if matchGroup([]*Column{hist}, unwrapNested(resolveOrderExpr(stmt, o.Expr)), alias) != hist || o.Desc {
+			return fmt.Errorf("%s: window must be ordered by %s ascending", w.Func, hist.Expr.String())
+		}
+	}
+	for _, p := range fn.Over.PartitionBy {
+		g := matchGroup(groups, unwrapNested(resolveOrderExpr(stmt, p)), alias)
+		if g == nil || g == hist {
+			return fmt.Errorf("%s: PARTITION BY %s must be a GROUP BY expression before the histogram", w.Func, p.String())
+		}
+	}
+	return nil
+}
+
+// bucketSort 单层 DATE_HISTOGRAM 分组时将 ORDER BY 与 LIMIT 下推为 bucket_sort，无法下推时返回 nil
+func bucketSort(stmt *sqlparser.SelectStmt, group *Column, metrics map[string]*Column, paths map[string][]string) *elastic.BucketSortAggregation {
+	if !stmt.HasLimit() {
+		return nil
+	}
+	bs := elastic.NewBucketSortAggregation().Size(int(stmt.Offset + stmt.Limit))
+	for _, o := range stmt.OrderBy {
+		e := unwrapNested(resolveOrderExpr(stmt, o.Expr))
+		m := metrics[e.String()]
+		switch {
+		case matchGroup([]*Column{group}, e, "") != nil:
+			bs.Sort("_key", !o.Desc)
+		case m != nil && m.singleValue():
+			bs.Sort(bucketsPath(m, paths), !o.Desc)
+		default:
+			return nil
+		}
+	}
+	return bs
+}
@@ -0,0 +1,517 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// builder WHERE 条件翻译器
+type builder struct {
+	alias  string  // 表别名，字段引用中的 alias. 前缀会被去掉
+	schema *Schema // 索引结构，为空时所有字段按普通字段处理
+	scope  string  // 当前所在的 nested 路径，根文档为空
+}
+
+// BuildQuery 将 WHERE 表达式翻译为 ES 查询，alias 为 FROM 子句中的表别名，
+// schema 用于识别 nested 字段，可以为空
+func BuildQuery(where sqlparser.Expr, alias string, schema *Schema) (elastic.Query, error) {
+	b := &builder{alias: alias, schema: schema}
+	return b.root(where)
+}
+
+// root 顶层查询，统一包装为 bool 查询：打分的全文检索放在 must 中，其余条件放在 filter 中
+func (b *builder) root(where sqlparser.Expr) (elastic.Query, error) {
+	if where == nil {
+		return elastic.NewMatchAllQuery(), nil
+	}
+	if err := b.checkScore(where); err != nil {
+		return nil, err
+	}
+	bq := elastic.NewBoolQuery()
+	for _, e := range flattenAnd(where) {
+		q, err := b.query(e)
+		if err != nil {
+			return nil, err
+		}
+		if isScoring(e) {
+			bq.Must(q)
+		} else {
+			bq.Filter(q)
+		}
+	}
+	return bq, nil
+}
+
+// checkScore 相关度评分在查询执行后才产生，只能用于 SELECT 与 ORDER BY
+func (b *builder) checkScore(where sqlparser.Expr) error {
+	found := false
+	sqlparser.Walk(where, func(n sqlparser.Expr) bool {
+		if c, ok := n.(*sqlparser.ColumnRef); ok && stripAlias(c.Name, b.alias) == ScoreField {
+			found = true
+		}
+		return !found
+	})
+	if found {
+		return fmt.Errorf("%s cannot be used in WHERE", ScoreField)
+	}
+	return nil
+}
+
+func (b *builder) query(e sqlparser.Expr) (elastic.Query, error) {
+	switch n := e.(type) {
+	case *sqlparser.BinaryExpr:
+		switch n.Op {
+		case "AND":
+			bq := elastic.NewBoolQuery()
+			for _, c := range flattenAnd(n) {
+				q, err := b.query(c)
+				if err != nil {
+					return nil, err
+				}
+				if isScoring(c) {
+					bq.Must(q)
+				} else {
+					bq.Filter(q)
+				}
+			}
+			return bq, nil
+		case "OR":
+			bq := elastic.NewBoolQuery().MinimumNumberShouldMatch(1)
+			for _, c := range flattenOr(n) {
+				q, err := b.query(c)
+				if err != nil {
+					return nil, err
+				}
+				bq.Should(q)
+			}
+			return bq, nil
+		}
+	case *sqlparser.UnaryExpr:
+		if n.Op == "NOT" {
+			// 先将 NOT 下推到叶子条件，保证字段缺失（NULL）时与 MySQL 三值逻辑一致
+			if neg, ok := negate(n.Expr); ok {
+				return b.query(neg)
+			}
+			q, err := b.query(n.Expr)
+			if err != nil {
+				return nil, err
+			}
+			return elastic.NewBoolQuery().MustNot(q), nil
+		}
+	case *sqlparser.BoolLit:
+		if n.Val {
+			return elastic.NewMatchAllQuery(), nil
+		}
+		return elastic.NewMatchNoneQuery(), nil
+	case *sqlparser.FuncCall:
+		if n.Name == "NESTED" {
+			return b.nested(n)
+		}
+	}
+
+	// 叶子条件作用于 nested 字段时包装为 nested 查询
+	if path := b.schema.NestedPath(b.leafField(e)); isNestedScope(path, b.scope) {
+		nb := &builder{alias: b.alias, schema: b.schema, scope: path}
+		q, err := nb.leaf(e)
+		if err != nil {
+			return nil, err
+		}
+		return elastic.NewNestedQuery(path, q), nil
+	}
+	return b.leaf(e)
+}
+
+// leaf 叶子条件
+func (b *builder) leaf(e sqlparser.Expr) (elastic.Query, error) {
+	if needsScript(e) {
+		return b.script(e)
+	}
+	switch n := e.(type) {
+	case *sqlparser.BinaryExpr:
+		switch n.Op {
+		case "=", "!=", "<", "<=", ">", ">=":
+			return b.comparison(n)
+		}
+	case *sqlparser.InExpr:
+		return b.in(n)
+	case *sqlparser.BetweenExpr:
+		return b.between(n)
+	case *sqlparser.IsNullExpr:
+		field, err := b.field(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		q := elastic.NewExistsQuery(field)
+		if n.Not {
+			return q, nil
+		}
+		return elastic.NewBoolQuery().MustNot(q), nil
+	case *sqlparser.LikeExpr:
+		return b.like(n)
+	case *sqlparser.FuncCall:
+		if _, ok := fullTextFuncs[n.Name]; ok {
+			return b.fullText(n)
+		}
+	}
+	return nil, fmt.Errorf("unsupported condition: %s", e.String())
+}
+
+// comparison 比较运算：与 NULL 比较结果恒为 NULL，!= 不匹配字段缺失的文档
+func (b *builder) comparison(n *sqlparser.BinaryExpr) (elastic.Query, error) {
+	left, right, op := n.Left, n.Right, n.Op
+	// 字面量在左侧时交换位置，例如 10 < a 转为 a > 10
+	if _, ok := left.(*sqlparser.ColumnRef); !ok {
+		if _, ok := right.(*sqlparser.ColumnRef); ok {
+			left, right, op = right, left, flipOp(op)
+		}
+	}
+	field, err := b.field(left)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(right) {
+		return elastic.NewMatchNoneQuery(), nil
+	}
+	value, err := literalValue(right)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "=":
+		return elastic.NewTermQuery(field, value), nil
+	case "!=":
+		return notNull(field, elastic.NewTermQuery(field, value)), nil
+	case "<":
+		return elastic.NewRangeQuery(field).Lt(value), nil
+	case "<=":
+		return elastic.NewRangeQuery(field).Lte(value), nil
+	case ">":
+		return elastic.NewRangeQuery(field).Gt(value), nil
+	default:
+		return elastic.NewRangeQuery(field).Gte(value), nil
+	}
+}
+
+// in IN 转为 terms 查询。列表中的 NULL 永远不会匹配；NOT IN 列表含 NULL 时结果恒为 NULL
+func (b *builder) in(n *sqlparser.InExpr) (elastic.Query, error) {
+	if n.Select != nil {
+		return nil, fmt.Errorf("IN (SELECT ...) must be executed by the engine")
+	}
+	field, err := b.field(n.Expr)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, 0, len(n.List))
+	hasNull := false
+	for _, item := range n.List {
+		if isNull(item) {
+			hasNull = true
+			continue
+		}
+		v, err := literalValue(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if n.Not {
+		if hasNull {
+			return elastic.NewMatchNoneQuery(), nil
+		}
+		return notNull(field, elastic.NewTermsQuery(field, values...)), nil
+	}
+	if len(values) == 0 {
+		return elastic.NewMatchNoneQuery(), nil
+	}
+	return elastic.NewTermsQuery(field, values...), nil
+}
+
+// between BETWEEN 转为 range 查询，NOT BETWEEN 转为两侧开区间的 should
+func (b *builder) between(n *sqlparser.BetweenExpr) (elastic.Query, error) {
+	if isNull(n.Lower) || isNull(n.Upper) {
+		// 边界为 NULL 时按 a >= lower AND a <= upper 的三值逻辑展开
+		var cond sqlparser.Expr = &sqlparser.BinaryExpr{
+			Op:    "AND",
+			Left:  &sqlparser.BinaryExpr{Op: ">=", Left: n.Expr, Right: n.Lower},
+			Right: &sqlparser.BinaryExpr{Op: "<=", Left: n.Expr, Right: n.Upper},
+		}
+		if n.Not {
+			cond, _ = negate(cond)
+		}
+		return b.query(cond)
+	}
+	field, err := b.field(n.Expr)
+	if err != nil {
+		return nil, err
+	}
+	lower, err := literalValue(n.Lower)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := literalValue(n.Upper)
+	if err != nil {
+		return nil, err
+	}
+	if n.Not {
+		return elastic.NewBoolQuery().MinimumNumberShouldMatch(1).Should(
+			elastic.NewRangeQuery(field).Lt(lower),
+			elastic.NewRangeQuery(field).Gt(upper),
+		), nil
+	}
+	return elastic.NewRangeQuery(field).Gte(lower).Lte(upper), nil
+}
+
+// like LIKE 转为 ES 查询：
+//
+//	'abc'   无通配符    -> term
+//	'abc%'  仅尾部 %    -> prefix
+//	'%'     匹配任意值  -> exists
+//	其他             -> wildcard，% 对应 *，_ 对应 ?，原文中的 * ? \ 会被转义
+//
+// 转义字符默认为反斜杠，可通过 ESCAPE 指定；ILIKE 忽略大小写
+func (b *builder) like(n *sqlparser.LikeExpr) (elastic.Query, error) {
+	field, err := b.field(n.Expr)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(n.Pattern) {
+		return elastic.NewMatchNoneQuery(), nil
+	}
+	lit, ok := n.Pattern.(*sqlparser.StringLit)
+	if !ok {
+		return nil, fmt.Errorf("LIKE pattern must be a string: %s", n.Pattern.String())
+	}
+	p := parseLikePattern(lit.Val, n.Escape)
+	// case_insensitive 需要 ES 7.10+，只在 ILIKE 时设置
+	var q elastic.Query
+	switch {
+	case p.matchAll():
+		q = elastic.NewExistsQuery(field)
+	case !p.hasWildcard():
+		tq := elastic.NewTermQuery(field, p.literal())
+		if n.CaseInsensitive {
+			tq.CaseInsensitive(true)
+		}
+		q = tq
+	case p.isPrefix():
+		pq := elastic.NewPrefixQuery(field, p.prefix())
+		if n.CaseInsensitive {
+			pq.CaseInsensitive(true)
+		}
+		q = pq
+	default:
+		wq := elastic.NewWildcardQuery(field, p.wildcard())
+		if n.CaseInsensitive {
+			wq.CaseInsensitive(true)
+		}
+		q = wq
+	}
+	if n.Not {
+		return notNull(field, q), nil
+	}
+	return q, nil
+}
+
+// notNull 字段存在且不满足 q，对应 SQL 中 NULL 参与否定运算结果仍为 NULL 的语义
+func notNull(field string, q elastic.Query) elastic.Query {
+	return elastic.NewBoolQuery().Filter(elastic.NewExistsQuery(field)).MustNot(q)
+}
+
+// negate 将 NOT 下推一层：德摩根律展开 AND/OR，叶子条件取反。无法取反（如全文检索）时返回 false
+func negate(e sqlparser.Expr) (sqlparser.Expr, bool) {
+	switch n := e.(type) {
+	case *sqlparser.BinaryExpr:
+		switch n.Op {
+		case "AND", "OR":
+			left, ok := negate(n.Left)
+			if !ok {
+				left = &sqlparser.UnaryExpr{Op: "NOT", Expr: n.Left}
+			}
+			right, ok := negate(n.Right)
+			if !ok {
+				right = &sqlparser.UnaryExpr{Op: "NOT", Expr: n.Right}
+			}
+			op := "OR"
+			if n.Op == "OR" {
+				op = "AND"
+			}
+			return &sqlparser.BinaryExpr{Op: op, Left: left, Right: right}, true
+		case "=", "!=", "<", "<=", ">", ">=":
+			return &sqlparser.BinaryExpr{Op: negateOp(n.Op), Left: n.Left, Right: n.Right}, true
+		}
+	case *sqlparser.UnaryExpr:
+		if n.Op == "NOT" {
+			return n.Expr, true
+		}
+	case *sqlparser.BoolLit:
+		return &sqlparser.BoolLit{Val: !n.Val}, true
+	case *sqlparser.InExpr:
+		c := *n
+		c.Not = !c.Not
+		return &c, true
+	case *sqlparser.BetweenExpr:
+		c := *n
+		c.Not = !c.Not
+		return &c, true
+	case *sqlparser.LikeExpr:
+		c := *n
+		c.Not = !c.Not
+		return &c, true
+	case *sqlparser.IsNullExpr:
+		c := *n
+		c.Not = !c.Not
+		return &c, true
+	}
+	return nil, false
+}
+
+func negateOp(op string) string {
+	switch op {
+	case "=":
+		return "!="
+	case "!=":
+		return "="
+	case "<":
+		return ">="
+	case "<=":
+		return ">"
+	case ">":
+		return "<="
+	}
+	return "<"
+}
+
+func isNull(e sqlparser.Expr) bool {
+	_, ok := e.(*sqlparser.NullLit)
+	return ok
+}
+
+// nested NESTED(path, 条件)：条件中的各字段需要由同一个嵌套对象满足
+func (b *builder) nested(fn *sqlparser.FuncCall) (elastic.Query, error) {
+	if len(fn.Args) != 2 {
+		return nil, fmt.Errorf("NESTED in WHERE expects (path, condition)")
+	}
+	path, err := nestedFuncPath(fn, b.alias)
+	if err != nil {
+		return nil, err
+	}
+	nb := &builder{alias: b.alias, schema: b.schema.withPath(path), scope: path}
+	q, err := nb.query(fn.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if path == b.scope {
+		return q, nil
+	}
+	return elastic.NewNestedQuery(path, q), nil
+}
+
+// leafField 叶子条件作用的字段，非叶子条件或不涉及字段时返回空串
+func (b *builder) leafField(e sqlparser.Expr) string {
+	var target sqlparser.Expr
+	switch n := e.(type) {
+	case *sqlparser.BinaryExpr:
+		switch n.Op {
+		case "=", "!=", "<", "<=", ">", ">=":
+			target = n.Left
+			if _, ok := target.(*sqlparser.ColumnRef); !ok {
+				target = n.Right
+			}
+		}
+	case *sqlparser.UnaryExpr:
+		if neg, ok := negate(n.Expr); ok && n.Op == "NOT" {
+			return b.leafField(neg)
+		}
+	case *sqlparser.InExpr:
+		target = n.Expr
+	case *sqlparser.BetweenExpr:
+		target = n.Expr
+	case *sqlparser.IsNullExpr:
+		target = n.Expr
+	case *sqlparser.LikeExpr:
+		target = n.Expr
+	case *sqlparser.FuncCall:
+		if (n.Name == "MATCH" || n.Name == "MATCH_PHRASE") && len(n.Args) > 0 {
+			target = n.Args[0]
+		}
+	}
+	if c, ok := target.(*sqlparser.ColumnRef); ok {
+		return stripAlias(c.Name, b.alias)
+	}
+	return ""
+}
+
+// field 解析字段名，去掉表别名前缀
+func (b *builder) field(e sqlparser.Expr) (string, error) {
+	c, ok := e.(*sqlparser.ColumnRef)
+	if !ok {
+		return "", fmt.Errorf("expected field, got %s", e.String())
+	}
+	return stripAlias(c.Name, b.alias), nil
+}
+
+func stripAlias(name, alias string) string {
+	if alias != "" && strings.HasPrefix(name, alias+".") {
+		return name[len(alias)+1:]
+	}
+	return name
+}
+
+// literalValue 将字面量转为 ES 查询中使用的值
+func literalValue(e sqlparser.Expr) (interface{}, error) {
+	switch v := e.(type) {
+	case *sqlparser.StringLit:
+		return v.Val, nil
+	case *sqlparser.NumberLit:
+		return v.Value(), nil
+	case *sqlparser.BoolLit:
+		return v.Val, nil
+	}
+	return nil, fmt.Errorf("expected literal value, got %s", e.String())
+}
+
+func flipOp(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+func flattenAnd(e sqlparser.Expr) []sqlparser.Expr {
+	if b, ok := e.(*sqlparser.BinaryExpr); ok && b.Op == "AND" {
+		return append(flattenAnd(b.Left), flattenAnd(b.Right)...)
+	}
+	return []sqlparser.Expr{e}
+}
+
+func flattenOr(e sqlparser.Expr) []sqlparser.Expr {
+	if b, ok := e.(*sqlparser.BinaryExpr); ok && b.Op == "OR" {
+		return append(flattenOr(b.Left), flattenOr(b.Right)...)
+	}
+	return []sqlparser.Expr{e}
+}
+
+// isScoring 条件中是否包含参与打分的全文检索
+func isScoring(e sqlparser.Expr) bool {
+	scoring := false
+	sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+		if f, ok := n.(*sqlparser.FuncCall); ok {
+			if _, ok := fullTextFuncs[f.Name]; ok {
+				scoring = true
+			}
+		}
+		return !scoring
+	})
+	return scoring
+}
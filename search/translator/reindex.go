@@ -0,0 +1,165 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// ReindexRequest INSERT INTO ... SELECT 对应的 _reindex 请求。
+// 字段表达式都能翻译为 painless 时使用 _reindex，否则 Fallback 为 true，由调用方逐批读取源索引并在进程内计算
+type ReindexRequest struct {
+	Source  string
+	Dest    string
+	Alias   string // 源索引的别名
+	Query   elastic.Query
+	Script  *elastic.Script // 为 nil 时原样复制文档
+	MaxDocs int64           // LIMIT，-1 表示不限
+
+	Fallback bool
+	Star     bool             // SELECT * 保留源文档的全部字段
+	Columns  []string         // 目标字段
+	Exprs    []sqlparser.Expr // 与 Columns 一一对应的表达式
+}
+
+// Body _reindex 的请求体，也用于 EXPLAIN
+func (r *ReindexRequest) Body() (map[string]interface{}, error) {
+	q, err := r.Query.Source()
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"source": map[string]interface{}{"index": r.Source, "query": q},
+		"dest":   map[string]interface{}{"index": r.Dest},
+	}
+	if r.Script != nil {
+		s, err := r.Script.Source()
+		if err != nil {
+			return nil, err
+		}
+		body["script"] = s
+	}
+	if r.MaxDocs >= 0 {
+		body["max_docs"] = r.MaxDocs
+	}
+	return body, nil
+}
+
+// TranslateReindex 翻译 INSERT INTO dest [(cols)] SELECT ... FROM source WHERE ...。
+// 只支持单个索引上不含聚合、去重的查询；ORDER BY、OFFSET 或不能翻译为 painless 的表达式使用进程内计算
+func TranslateReindex(stmt *sqlparser.InsertStmt, schema *Schema) (*ReindexRequest, error) {
+	sel := stmt.Select
+	switch {
+	case sel.From == nil || sel.From.Select != nil:
+		return nil, fmt.Errorf("INSERT ... SELECT requires a source index")
+	case len(sel.Joins) > 0:
+		return nil, fmt.Errorf("INSERT ... SELECT with JOIN is not supported")
+	case len(sel.GroupBy) > 0 || sel.Having != nil || sel.Distinct:
+		return nil, fmt.Errorf("INSERT ... SELECT with GROUP BY, HAVING or DISTINCT is not supported")
+	}
+	alias := sel.From.Alias
+	req := &ReindexRequest{Source: sel.From.Name, Dest: stmt.Table, Alias: alias, MaxDocs: sel.Limit}
+	q, err := BuildQuery(sel.Where, alias, schema)
+	if err != nil {
+		return nil, err
+	}
+	req.Query = q
+
+	for _, f := range sel.Fields {
+		found := false
+		sqlparser.Walk(f.Expr, func(n sqlparser.Expr) bool {
+			found = found || IsAggregateFunc(n) || IsWindowFunc(n) || isHighlight(n)
+			return !found
+		})
+		if found {
+			return nil, fmt.Errorf("INSERT ... SELECT only supports per-document expressions: %s", f.Raw)
+		}
+		if star, ok := f.Expr.(*sqlparser.StarExpr); ok {
+			if star.Table != "" && star.Table != alias {
+				return nil, fmt.Errorf("unknown table '%s' in %s.*", star.Table, star.Table)
+			}
+			if len(stmt.Columns) > 0 {
+				return nil, fmt.Errorf("INSERT ... SELECT * cannot be used with a column list")
+			}
+			req.Star = true
+			continue
+		}
+		if _, ok := f.Expr.(*sqlparser.ColumnRef); !ok && f.Alias == "" && len(stmt.Columns) == 0 {
+			return nil, fmt.Errorf("expression %s needs an alias or a column list to name the target field", f.Raw)
+		}
+		req.Exprs = append(req.Exprs, f.Expr)
+		req.Columns = append(req.Columns, stripAlias(f.Name(), alias))
+	}
+	if len(stmt.Columns) > 0 {
+		if len(stmt.Columns) != len(req.Exprs) {
+			return nil, fmt.Errorf("column count doesn't match value count: %d columns, %d values", len(stmt.Columns), len(req.Exprs))
+		}
+		req.Columns = stmt.Columns
+	}
+	for _, c := range req.Columns {
+		if c != "_id" && metaFields[c] {
+			return nil, fmt.Errorf("cannot insert into meta field %s", c)
+		}
+	}
+
+	if len(sel.OrderBy) > 0 || sel.Offset > 0 {
+		req.Fallback = true
+		return req, nil
+	}
+	if req.Star && len(req.Exprs) == 0 {
+		return req, nil
+	}
+	script, ok := reindexScript(req)
+	req.Script = script
+	req.Fallback = !ok
+	return req, nil
+}
+
+// reindexScript 生成构造目标文档的 painless 脚本，表达式不能翻译时返回 false
+func reindexScript(req *ReindexRequest) (*elastic.Script, bool) {
+	ps := &painless{alias: req.Alias, params: make(map[string]interface{})}
+	lines := []string{"Map d = new HashMap();"}
+	if req.Star {
+		lines[0] = "Map d = new HashMap(ctx._source);"
+	}
+	for i, c := range req.Columns {
+		x := req.Exprs[i]
+		if ref, ok := x.(*sqlparser.ColumnRef); ok && c == "_id" && stripAlias(ref.Name, req.Alias) == "_id" {
+			// 默认保留源文档的 _id
+			continue
+		}
+		v, err := ps.expr(x)
+		if err != nil {
+			return nil, false
+		}
+		if c == "_id" {
+			lines = append(lines, "ctx._id = String.valueOf("+v+");")
+			continue
+		}
+		lines = append(lines, targetPath(c)+" = "+v+";")
+	}
+	lines = append(lines, "ctx._source = d;")
+	return ps.script(strings.Join(lines, " ")), true
+}
+
+// targetPath 目标文档中字段的写入路径，带点号的字段逐层创建对象
+func targetPath(field string) string {
+	parts := strings.Split(field, ".")
+	path := "d"
+	for _, p := range parts[:len(parts)-1] {
+		path = "((Map) " + path + ".computeIfAbsent(" + quotePainless(p) + ", k -> new HashMap()))"
+	}
+	return path + "[" + quotePainless(parts[len(parts)-1]) + "]"
+}
+
+func quotePainless(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
+
+func isHighlight(e sqlparser.Expr) bool {
+	f, ok := e.(*sqlparser.FuncCall)
+	return ok && f.Name == "HIGHLIGHT"
+}
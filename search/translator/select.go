@@ -0,0 +1,894 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+const (
+	// DefaultSize 未指定 LIMIT 时返回的最大行数
+	DefaultSize = 1000
+	// DefaultGroupSize 无法下推排序时每层分组返回的最大桶数
+	DefaultGroupSize = 1000
+	// ScoreField 相关度评分伪字段
+	ScoreField = "_score"
+)
+
+// ColumnKind 结果列的取值方式
+type ColumnKind int
+
+const (
+	ColumnField     ColumnKind = iota // 取 _source 中的字段
+	ColumnStar                        // SELECT *，展开 _source 中的全部字段
+	ColumnMeta                        // _id、_index、_score 等元数据
+	ColumnHighlight                   // HIGHLIGHT(field) 高亮片段
+	ColumnGroup                       // 分组键
+	ColumnCount                       // COUNT(*)，取桶的 doc_count
+	ColumnMetric                      // 指标聚合
+	ColumnScript                      // 标量表达式，由 script_fields 在 ES 中计算
+	ColumnComputed                    // 标量表达式，不能翻译为 painless 或引用了聚合结果，由执行引擎在进程内计算
+)
+
+// Column 结果列
+type Column struct {
+	Name   string
+	Kind   ColumnKind
+	Field  string         // 源字段，ColumnScript 为 script_fields 中的名称
+	Agg    string         // 聚合名称
+	Func   string         // 聚合函数名
+	Level  int            // 分组层级
+	Expr   sqlparser.Expr // 原始表达式，用于匹配 HAVING / ORDER BY
+	Hidden bool           // 仅用于 HAVING / ORDER BY，不输出
+
+	Nested  string   // 字段所属的 nested 路径
+	AggPath []string // 由外到内的聚合名称路径，包含 nested / reverse_nested 等单桶聚合，为空时即 Agg
+
+	Percents []float64          // PERCENTILE / PERCENTILES 的百分位
+	Sorts    []elastic.SortInfo // FIRST / LAST 取值时的排序
+	Script   *elastic.Script    // 分组键或聚合的参数是表达式时使用的脚本
+
+	Interval string  // DATE_HISTOGRAM 的间隔
+	opts     options // DATE_HISTOGRAM 的选项
+	Window   int     // MOVING_AVG 的窗口大小
+	Input    *Column // 窗口函数的输入指标
+}
+
+// Request 翻译后的 ES 查询请求
+type Request struct {
+	Index     string
+	Alias     string
+	Source    *elastic.SearchSource
+	Columns   []*Column
+	Aggregate bool
+
+	// 以下字段用于聚合结果在进程内的过滤、排序与分页
+	Having  sqlparser.Expr
+	OrderBy []*sqlparser.OrderItem
+	Offset  int64
+	Limit   int64 // -1 表示不限
+}
+
+// Translate 将查询语句翻译为 ES 请求，schema 为索引结构，未知时可以为空
+func Translate(stmt *sqlparser.SelectStmt, schema *Schema) (*Request, error) {
+	if stmt.From == nil {
+		return nil, fmt.Errorf("missing FROM clause")
+	}
+	if len(stmt.Joins) > 0 {
+		return nil, fmt.Errorf("JOIN must be executed by the engine")
+	}
+	if stmt.From.Select != nil {
+		return nil, fmt.Errorf("derived tables must be executed by the engine")
+	}
+	req := &Request{
+		Index:  stmt.From.Name,
+		Alias:  stmt.From.Alias,
+		Offset: stmt.Offset,
+		Limit:  stmt.Limit,
+	}
+	if err := checkStarTable(stmt, req); err != nil {
+		return nil, err
+	}
+	orderBy, err := resolveOrdinals(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if orderBy != nil {
+		s := *stmt
+		s.OrderBy = orderBy
+		stmt = &s
+	}
+	schema, err = explicitNested(stmt, schema, req.Alias)
+	if err != nil {
+		return nil, err
+	}
+	query, err := BuildQuery(stmt.Where, req.Alias, schema)
+	if err != nil {
+		return nil, err
+	}
+	req.Source = elastic.NewSearchSource().Query(query)
+
+	b := &builder{alias: req.Alias, schema: schema}
+	if isAggregate(stmt) {
+		req.Aggregate = true
+		return req, translateAggregate(stmt, req, b)
+	}
+	return req, translatePlain(stmt, req, b)
+}
+
+// checkStarTable t.* 的限定名必须是 FROM 中的表别名，没有别名时为表名
+func checkStarTable(stmt *sqlparser.SelectStmt, req *Request) error {
+	name := req.Alias
+	if name == "" {
+		name = req.Index
+	}
+	for _, f := range stmt.Fields {
+		if star, ok := unwrapNested(f.Expr).(*sqlparser.StarExpr); ok && star.Table != "" && star.Table != name {
+			return fmt.Errorf("unknown table '%s' in field list", star.Table)
+		}
+	}
+	return nil
+}
+
+// resolveOrdinals ORDER BY 中的位置序号（ORDER BY 1）替换为对应的查询字段，没有序号时返回 nil
+func resolveOrdinals(stmt *sqlparser.SelectStmt) ([]*sqlparser.OrderItem, error) {
+	var out []*sqlparser.OrderItem
+	for i, o := range stmt.OrderBy {
+		n, ok := o.Expr.(*sqlparser.NumberLit)
+		if !ok {
+			continue
+		}
+		pos := int(n.Float())
+		if !n.IsInt() || pos < 1 || pos > len(stmt.Fields) {
+			return nil, fmt.Errorf("unknown column '%s' in ORDER BY", n.Raw)
+		}
+		if _, ok := unwrapNested(stmt.Fields[pos-1].Expr).(*sqlparser.StarExpr); ok {
+			return nil, fmt.Errorf("ORDER BY position %s refers to *", n.Raw)
+		}
+		if out == nil {
+			out = append([]*sqlparser.OrderItem(nil), stmt.OrderBy...)
+		}
+		out[i] = &sqlparser.OrderItem{Expr: stmt.Fields[pos-1].Expr, Desc: o.Desc}
+	}
+	return out, nil
+}
+
+// AggNames 由外到内的聚合名称路径
+func (c *Column) AggNames() []string {
+	if len(c.AggPath) > 0 {
+		return c.AggPath
+	}
+	return []string{c.Agg}
+}
+
+// DSL 返回请求体 JSON 对象
+func (r *Request) DSL() (interface{}, error) {
+	return r.Source.Source()
+}
+
+// Visible 返回需要输出的列
+func (r *Request) Visible() []*Column {
+	cols := make([]*Column, 0, len(r.Columns))
+	for _, c := range r.Columns {
+		if !c.Hidden {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// translatePlain 非聚合查询
+func translatePlain(stmt *sqlparser.SelectStmt, req *Request, b *builder) error {
+	if stmt.Having != nil {
+		return fmt.Errorf("HAVING requires GROUP BY or aggregate functions")
+	}
+	var (
+		includes  []string
+		star      bool
+		highlight *elastic.Highlight
+	)
+	for _, f := range stmt.Fields {
+		switch e := unwrapNested(f.Expr).(type) {
+		case *sqlparser.StarExpr:
+			star = true
+			req.Columns = append(req.Columns, &Column{Name: "*", Kind: ColumnStar, Expr: e})
+		case *sqlparser.ColumnRef:
+			field := stripAlias(e.Name, req.Alias)
+			col := &Column{Name: f.Name(), Field: field, Expr: e}
+			if isMetaField(field) {
+				col.Kind = ColumnMeta
+				if field == ScoreField {
+					req.Source.TrackScores(true)
+				}
+			} else {
+				includes = append(includes, field)
+			}
+			req.Columns = append(req.Columns, col)
+		case *sqlparser.FuncCall:
+			if e.Name != "HIGHLIGHT" {
+				fields, err := addScalar(req, f, len(req.Columns))
+				if err != nil {
+					return err
+				}
+				includes = append(includes, fields...)
+				continue
+			}
+			if highlight == nil {
+				highlight = elastic.NewHighlight()
+			}
+			field, err := addHighlight(highlight, e, req.Alias)
+			if err != nil {
+				return err
+			}
+			req.Columns = append(req.Columns, &Column{Name: f.Name(), Kind: ColumnHighlight, Field: field, Expr: e})
+		default:
+			fields, err := addScalar(req, f, len(req.Columns))
+			if err != nil {
+				return err
+			}
+			includes = append(includes, fields...)
+		}
+	}
+	if !star {
+		// 表达式引用的字段可能与查询字段重复
+		seen := make(map[string]bool, len(includes))
+		fields := includes[:0]
+		for _, f := range includes {
+			if !seen[f] {
+				seen[f] = true
+				fields = append(fields, f)
+			}
+		}
+		includes = fields
+		req.Source.FetchSourceContext(elastic.NewFetchSourceContext(len(includes) > 0).Include(includes...))
+	}
+	if highlight != nil {
+		req.Source.Highlight(highlight)
+	}
+
+	var filters map[string]elastic.Query
+	for _, o := range stmt.OrderBy {
+		x := unwrapNested(o.Expr)
+		if _, ok := x.(*sqlparser.ColumnRef); ok {
+			x = unwrapNested(resolveOrderExpr(stmt, x))
+		}
+		c, ok := x.(*sqlparser.ColumnRef)
+		if !ok {
+			// 表达式排序使用脚本排序
+			if err := checkScalar(x, false); err != nil {
+				return err
+			}
+			s, err := sortScript(x, req.Alias, o.Desc)
+			if err != nil {
+				return fmt.Errorf("unsupported ORDER BY expression: %s: %v", o.Expr.String(), err)
+			}
+			req.Source.SortBy(s)
+			continue
+		}
+		field := resolveSelectAlias(stmt, stripAlias(c.Name, req.Alias))
+		if path := b.schema.NestedPath(field); path != "" {
+			// nested 字段排序只考虑满足 WHERE 中 nested 条件的嵌套对象
+			if filters == nil {
+				var err error
+				if filters, err = b.nestedFilters(stmt.Where); err != nil {
+					return err
+				}
+			}
+			req.Source.SortBy(elastic.NewFieldSort(field).Order(!o.Desc).Nested(nestedSort(b.schema, path, filters)))
+			continue
+		}
+		req.Source.SortWithInfo(elastic.SortInfo{Field: field, Ascending: !o.Desc})
+		if field == ScoreField {
+			req.Source.TrackScores(true)
+		}
+	}
+
+	size := int64(DefaultSize)
+	if stmt.HasLimit() {
+		size = stmt.Limit
+	}
+	req.Source.From(int(stmt.Offset)).Size(int(size))
+	return nil
+}
+
+// addScalar 添加标量表达式列：能翻译为 painless 时作为 script_fields 在 ES 中计算，
+// 否则由执行引擎根据 _source 计算，返回需要读取的源字段
+func addScalar(req *Request, f *sqlparser.SelectField, seq int) ([]string, error) {
+	if err := checkScalar(f.Expr, false); err != nil {
+		return nil, err
+	}
+	col := &Column{Name: f.Name(), Kind: ColumnComputed, Expr: f.Expr}
+	req.Columns = append(req.Columns, col)
+	if script, err := valueScript(f.Expr, req.Alias); err == nil {
+		col.Kind, col.Field = ColumnScript, fmt.Sprintf("expr_%d", seq)
+		req.Source.ScriptFields(elastic.NewScriptField(col.Field, script))
+		return nil, nil
+	}
+	return referencedFields(f.Expr, req.Alias), nil
+}
+
+// addHighlight 解析 HIGHLIGHT(field[, 'fragment_size=100;number_of_fragments=3;pre_tags=<em>;post_tags=</em>'])
+func addHighlight(h *elastic.Highlight, fn *sqlparser.FuncCall, alias string) (string, error) {
+	if len(fn.Args) == 0 {
+		return "", fmt.Errorf("HIGHLIGHT expects a field argument")
+	}
+	c, ok := fn.Args[0].(*sqlparser.ColumnRef)
+	if !ok {
+		return "", fmt.Errorf("HIGHLIGHT expects a field argument, got %s", fn.Args[0].String())
+	}
+	field := stripAlias(c.Name, alias)
+	opts, err := parseOptions(fn, 1)
+	if err != nil {
+		return "", err
+	}
+	hf := elastic.NewHighlighterField(field)
+	for k, v := range opts {
+		switch k {
+		case "fragment_size":
+			i, err := opts.int(k)
+			if err != nil {
+				return "", err
+			}
+			hf.FragmentSize(i)
+		case "number_of_fragments":
+			i, err := opts.int(k)
+			if err != nil {
+				return "", err
+			}
+			hf.NumOfFragments(i)
+		case "pre_tags":
+			hf.PreTags(v)
+		case "post_tags":
+			hf.PostTags(v)
+		case "type":
+			hf.HighlighterType(v)
+		default:
+			return "", fmt.Errorf("HIGHLIGHT: unknown option '%s'", k)
+		}
+	}
+	h.Fields(hf)
+	return field, nil
+}
+
+// resolveSelectAlias ORDER BY 中引用查询字段别名时，替换为真实字段
+func resolveSelectAlias(stmt *sqlparser.SelectStmt, name string) string {
+	for _, f := range stmt.Fields {
+		if f.Alias == name {
+			if c, ok := unwrapNested(f.Expr).(*sqlparser.ColumnRef); ok {
+				return c.Name
+			}
+		}
+	}
+	return name
+}
+
+func isMetaField(field string) bool {
+	switch field {
+	case "_id", "_index", ScoreField:
+		return true
+	}
+	return false
+}
+
+// aggregateFuncs 支持的聚合函数
+var aggregateFuncs = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+	"PERCENTILE": true, "PERCENTILES": true, "STATS": true, "EXTENDED_STATS": true,
+	"FIRST": true, "LAST": true,
+}
+
+// IsAggregateFunc 是否为聚合函数
+func IsAggregateFunc(e sqlparser.Expr) bool {
+	f, ok := e.(*sqlparser.FuncCall)
+	return ok && aggregateFuncs[f.Name]
+}
+
+func isAggregate(stmt *sqlparser.SelectStmt) bool {
+	if len(stmt.GroupBy) > 0 || stmt.Distinct {
+		return true
+	}
+	for _, f := range stmt.Fields {
+		found := false
+		sqlparser.Walk(f.Expr, func(e sqlparser.Expr) bool {
+			if IsAggregateFunc(e) {
+				found = true
+			}
+			return !found
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// translateAggregate 聚合查询：每个 GROUP BY 字段对应一层 terms 或 date_histogram 聚合，
+// 指标聚合挂在最内层，窗口函数作为 pipeline 聚合挂在最内层的 date_histogram 上
+func translateAggregate(stmt *sqlparser.SelectStmt, req *Request, b *builder) error {
+	groupBy := stmt.GroupBy
+	if stmt.Distinct && len(groupBy) == 0 {
+		// SELECT DISTINCT a, b 等价于 GROUP BY a, b
+		for _, f := range stmt.Fields {
+			groupBy = append(groupBy, f.Expr)
+		}
+	}
+
+	groups := make([]*Column, 0, len(groupBy))
+	for i, g := range groupBy {
+		g = unwrapNested(resolveGroupExpr(stmt, g))
+		name := fmt.Sprintf("group_%d", i)
+		var col *Column
+		switch e := g.(type) {
+		case *sqlparser.ColumnRef:
+			col = &Column{Name: e.Name, Kind: ColumnGroup, Field: stripAlias(e.Name, req.Alias), Agg: name, Level: i, Expr: g}
+		case *sqlparser.FuncCall:
+			var err error
+			if e.Name == "DATE_HISTOGRAM" {
+				col, err = histogramColumn(e, req.Alias, name, i)
+			} else {
+				col, err = scriptGroup(g, req.Alias, name, i)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			var err error
+			if col, err = scriptGroup(g, req.Alias, name, i); err != nil {
+				return err
+			}
+		}
+		col.Nested = b.schema.NestedPath(col.Field)
+		groups = append(groups, col)
+	}
+
+	metrics := make(map[string]*Column)
+	var order, windows []*Column
+	seq := 0
+	addMetric := func(fn *sqlparser.FuncCall) (*Column, error) {
+		key := fn.String()
+		if c, ok := metrics[key]; ok {
+			return c, nil
+		}
+		c, err := metricColumn(fn, req.Alias, fmt.Sprintf("agg_%d", seq))
+		if err != nil {
+			return nil, err
+		}
+		seq++
+		c.Nested = b.schema.NestedPath(c.Field)
+		metrics[key] = c
+		order = append(order, c)
+		return c, nil
+	}
+	addWindow := func(fn *sqlparser.FuncCall) (*Column, error) {
+		key := fn.String()
+		if c, ok := metrics[key]; ok {
+			return c, nil
+		}
+		if len(fn.Args) == 0 || !IsAggregateFunc(fn.Args[0]) {
+			return nil, fmt.Errorf("%s expects an aggregate function argument, e.g. %s(SUM(x))", fn.Name, fn.Name)
+		}
+		input, err := addMetric(fn.Args[0].(*sqlparser.FuncCall))
+		if err != nil {
+			return nil, err
+		}
+		c, err := windowColumn(fn, input, fmt.Sprintf("agg_%d", seq))
+		if err != nil {
+			return nil, err
+		}
+		if err := checkWindow(stmt, groups, c, req.Alias); err != nil {
+			return nil, err
+		}
+		seq++
+		metrics[key] = c
+		windows = append(windows, c)
+		return c, nil
+	}
+	addFunc := func(fn *sqlparser.FuncCall) (*Column, error) {
+		if IsWindowFunc(fn) {
+			return addWindow(fn)
+		}
+		return addMetric(fn)
+	}
+
+	// 查询字段
+	var computed []sqlparser.Expr
+	for _, f := range stmt.Fields {
+		if g := matchGroup(groups, unwrapNested(f.Expr), req.Alias); g != nil {
+			col := *g
+			col.Name = f.Name()
+			req.Columns = append(req.Columns, &col)
+			continue
+		}
+		fn, ok := f.Expr.(*sqlparser.FuncCall)
+		if !ok || !(IsAggregateFunc(fn) || IsWindowFunc(fn)) {
+			// 引用分组字段与聚合结果的表达式在聚合完成后于进程内计算
+			if err := checkGrouped(f.Expr, groups, req.Alias); err != nil {
+				return fmt.Errorf("select expression '%s' must appear in GROUP BY or be an aggregate function", f.Raw)
+			}
+			if err := checkScalar(f.Expr, true); err != nil {
+				return err
+			}
+			computed = append(computed, f.Expr)
+			req.Columns = append(req.Columns, &Column{Name: f.Name(), Kind: ColumnComputed, Expr: f.Expr})
+			continue
+		}
+		m, err := addFunc(fn)
+		if err != nil {
+			return err
+		}
+		col := *m
+		col.Name = f.Name()
+		req.Columns = append(req.Columns, &col)
+	}
+
+	// 表达式、HAVING 与 ORDER BY 中出现但未被查询的聚合函数作为隐藏列
+	extra := append(computed, stmt.Having)
+	for _, o := range stmt.OrderBy {
+		extra = append(extra, o.Expr)
+	}
+	for _, e := range extra {
+		var walkErr error
+		sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+			if fn, ok := n.(*sqlparser.FuncCall); ok && (IsAggregateFunc(fn) || IsWindowFunc(fn)) {
+				if _, exists := metrics[fn.String()]; !exists {
+					m, err := addFunc(fn)
+					if err != nil {
+						walkErr = err
+						return false
+					}
+					col := *m
+					col.Hidden = true
+					req.Columns = append(req.Columns, &col)
+				}
+				return false
+			}
+			return true
+		})
+		if walkErr != nil {
+			return walkErr
+		}
+	}
+	for _, g := range groups {
+		if !hasColumn(req.Columns, g.Agg) {
+			col := *g
+			col.Hidden = true
+			req.Columns = append(req.Columns, &col)
+		}
+	}
+
+	req.Having = stmt.Having
+	req.OrderBy = stmt.OrderBy
+	req.Source.Size(0)
+	if len(groups) == 0 {
+		req.Source.TrackTotalHits(true)
+	}
+
+	filters, err := b.nestedFilters(stmt.Where)
+	if err != nil {
+		return err
+	}
+	ac := &aggContext{filters: filters}
+	paths := make(map[string][]string)
+
+	// 由内向外构建：指标聚合挂在最内层分组所在的上下文中，
+	// 每层分组按需包装 nested / reverse_nested 切换上下文
+	type namedAgg struct {
+		name string
+		agg  elastic.Aggregation
+	}
+	var subs []namedAgg
+	leaf := ""
+	if len(groups) > 0 {
+		leaf = groups[len(groups)-1].Nested
+	}
+	for _, m := range order {
+		if agg := m.aggregation(); agg != nil {
+			name, outer, path := ac.enter(leaf, m.Nested, m.Agg, m.Agg, agg)
+			paths[m.Agg] = path
+			subs = append(subs, namedAgg{name, outer})
+		}
+	}
+	pushOrder := len(groups) == 1 && stmt.Having == nil
+	for i := len(groups) - 1; i >= 0; i-- {
+		var agg elastic.Aggregation
+		if groups[i].Func == "DATE_HISTOGRAM" {
+			h := groups[i].histogram()
+			for _, sub := range subs {
+				h.SubAggregation(sub.name, sub.agg)
+			}
+			if i == len(groups)-1 {
+				for _, w := range windows {
+					h.SubAggregation(w.Agg, w.pipeline(bucketsPath(w.Input, paths)))
+				}
+			}
+			// 窗口函数需要完整的桶序列，存在时不截断
+			if pushOrder && len(windows) == 0 {
+				if bs := bucketSort(stmt, groups[0], metrics, paths); bs != nil {
+					h.SubAggregation("bucket_sort", bs)
+				}
+			}
+			agg = h
+		} else {
+			terms := elastic.NewTermsAggregation().Field(groups[i].Field).Script(groups[i].Script).Size(DefaultGroupSize)
+			for _, sub := range subs {
+				terms.SubAggregation(sub.name, sub.agg)
+			}
+			if pushOrder {
+				pushTermsOrder(terms, stmt, groups[0], metrics, paths)
+			}
+			agg = terms
+		}
+		from := ""
+		if i > 0 {
+			from = groups[i-1].Nested
+		}
+		name, outer, path := ac.enter(from, groups[i].Nested, groups[i].Agg, groups[i].Agg, agg)
+		paths[groups[i].Agg] = path
+		subs = []namedAgg{{name, outer}}
+	}
+	for _, sub := range subs {
+		req.Source.Aggregation(sub.name, sub.agg)
+	}
+	for _, c := range req.Columns {
+		if p := paths[c.Agg]; len(p) > 1 {
+			c.AggPath = p
+		}
+	}
+	return nil
+}
+
+// nestedSort nested 字段排序，多层 nested 时逐层嵌套
+func nestedSort(schema *Schema, path string, filters map[string]elastic.Query) *elastic.NestedSort {
+	var chain []string
+	for _, p := range schema.NestedPaths {
+		if p == path || strings.HasPrefix(path, p+".") {
+			chain = append(chain, p)
+		}
+	}
+	var sort *elastic.NestedSort
+	for i := len(chain) - 1; i >= 0; i-- {
+		s := elastic.NewNestedSort(chain[i])
+		if f := filters[chain[i]]; f != nil {
+			s.Filter(f)
+		}
+		if sort != nil {
+			s.NestedSort(sort)
+		}
+		sort = s
+	}
+	return sort
+}
+
+// pushTermsOrder 单层分组时将排序与 LIMIT 下推到 terms 聚合，保证取到正确的 Top N 桶
+func pushTermsOrder(terms *elastic.TermsAggregation, stmt *sqlparser.SelectStmt, group *Column, metrics map[string]*Column, paths map[string][]string) {
+	for _, o := range stmt.OrderBy {
+		e := unwrapNested(resolveOrderExpr(stmt, o.Expr))
+		switch {
+		case matchGroup([]*Column{group}, e, "") != nil:
+			terms.OrderByKey(!o.Desc)
+		case metrics[e.String()] != nil && metrics[e.String()].Kind == ColumnCount:
+			terms.OrderByCount(!o.Desc)
+		case metrics[e.String()] != nil && metrics[e.String()].singleValue():
+			// 指标位于 nested / reverse_nested 之内时使用 a>b 形式的路径
+			terms.OrderByAggregation(strings.Join(paths[metrics[e.String()].Agg], ">"), !o.Desc)
+		default:
+			return
+		}
+	}
+	if stmt.HasLimit() {
+		terms.Size(int(stmt.Offset + stmt.Limit))
+	}
+}
+
+// resolveOrderExpr ORDER BY 引用查询字段别名时，替换为对应的表达式
+func resolveOrderExpr(stmt *sqlparser.SelectStmt, e sqlparser.Expr) sqlparser.Expr {
+	if c, ok := e.(*sqlparser.ColumnRef); ok {
+		for _, f := range stmt.Fields {
+			if f.Alias == c.Name {
+				return f.Expr
+			}
+		}
+	}
+	return e
+}
+
+// resolveGroupExpr 支持 GROUP BY 别名与 GROUP BY 序号
+func resolveGroupExpr(stmt *sqlparser.SelectStmt, e sqlparser.Expr) sqlparser.Expr {
+	switch v := e.(type) {
+	case *sqlparser.NumberLit:
+		if i, ok := v.Value().(int64); ok && i >= 1 && int(i) <= len(stmt.Fields) {
+			return stmt.Fields[i-1].Expr
+		}
+	case *sqlparser.ColumnRef:
+		return resolveOrderExpr(stmt, v)
+	}
+	return e
+}
+
+func matchGroup(groups []*Column, e sqlparser.Expr, alias string) *Column {
+	c, ok := e.(*sqlparser.ColumnRef)
+	if !ok {
+		// DATE_HISTOGRAM 与表达式分组按表达式匹配
+		for _, g := range groups {
+			if g.Expr.String() == e.String() {
+				return g
+			}
+		}
+		return nil
+	}
+	for _, g := range groups {
+		if g.Func == "DATE_HISTOGRAM" || g.Script != nil {
+			continue
+		}
+		if g.Expr.String() == c.Name || g.Field == stripAlias(c.Name, alias) {
+			return g
+		}
+	}
+	return nil
+}
+
+// scriptGroup 按表达式分组，使用 terms 聚合的脚本计算分组键
+func scriptGroup(g sqlparser.Expr, alias, name string, level int) (*Column, error) {
+	if err := checkScalar(g, false); err != nil {
+		return nil, fmt.Errorf("unsupported GROUP BY expression: %s: %v", g.String(), err)
+	}
+	script, err := valueScript(g, alias)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported GROUP BY expression: %s: %v", g.String(), err)
+	}
+	return &Column{Name: g.String(), Kind: ColumnGroup, Agg: name, Level: level, Expr: g, Script: script}, nil
+}
+
+// checkGrouped 表达式中聚合函数之外的字段必须是分组字段
+func checkGrouped(e sqlparser.Expr, groups []*Column, alias string) error {
+	var bad sqlparser.Expr
+	sqlparser.Walk(e, func(n sqlparser.Expr) bool {
+		if bad != nil || IsAggregateFunc(n) || IsWindowFunc(n) || matchGroup(groups, unwrapNested(n), alias) != nil {
+			return false
+		}
+		if _, ok := n.(*sqlparser.ColumnRef); ok {
+			bad = n
+		}
+		return bad == nil
+	})
+	if bad != nil {
+		return fmt.Errorf("'%s' isn't in GROUP BY", bad.String())
+	}
+	return nil
+}
+
+func hasColumn(cols []*Column, agg string) bool {
+	for _, c := range cols {
+		if c.Agg == agg {
+			return true
+		}
+	}
+	return false
+}
+
+// metricColumn 聚合函数对应的结果列
+func metricColumn(fn *sqlparser.FuncCall, alias, name string) (*Column, error) {
+	col := &Column{Name: fn.String(), Kind: ColumnMetric, Func: fn.Name, Agg: name, Expr: fn}
+	if fn.Name == "COUNT" && fn.Star {
+		col.Kind = ColumnCount
+		col.Agg = ""
+		return col, nil
+	}
+	if len(fn.Args) == 0 {
+		return nil, fmt.Errorf("%s expects a field argument", fn.Name)
+	}
+	arg := unwrapNested(fn.Args[0])
+	if c, ok := arg.(*sqlparser.ColumnRef); ok {
+		col.Field = stripAlias(c.Name, alias)
+	} else {
+		// 参数是表达式时由脚本计算每个文档的值
+		if fn.Name == "FIRST" || fn.Name == "LAST" || checkScalar(arg, false) != nil {
+			return nil, fmt.Errorf("unsupported aggregate argument: %s", fn.String())
+		}
+		script, err := valueScript(arg, alias)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported aggregate argument: %s: %v", fn.String(), err)
+		}
+		col.Script = script
+	}
+
+	switch fn.Name {
+	case "PERCENTILE", "PERCENTILES":
+		if fn.Name == "PERCENTILE" && len(fn.Args) != 2 {
+			return nil, fmt.Errorf("PERCENTILE expects (field, percent): %s", fn.String())
+		}
+		if len(fn.Args) < 2 {
+			return nil, fmt.Errorf("PERCENTILES expects (field, percent, ...): %s", fn.String())
+		}
+		for _, a := range fn.Args[1:] {
+			n, ok := a.(*sqlparser.NumberLit)
+			if !ok {
+				return nil, fmt.Errorf("%s: percent must be a number, got %s", fn.Name, a.String())
+			}
+			p := n.Float()
+			if p < 0 || p > 100 {
+				return nil, fmt.Errorf("%s: percent must be between 0 and 100, got %s", fn.Name, n.Raw)
+			}
+			col.Percents = append(col.Percents, p)
+		}
+	case "FIRST", "LAST":
+		if len(fn.Args) != 1 {
+			return nil, fmt.Errorf("%s expects exactly one argument", fn.Name)
+		}
+		if len(fn.OrderBy) == 0 {
+			return nil, fmt.Errorf("%s requires ORDER BY, e.g. %s(%s ORDER BY ts)", fn.Name, fn.Name, arg.String())
+		}
+		// LAST 取排序后的最后一条，即反向排序的第一条
+		for _, o := range fn.OrderBy {
+			ref, ok := o.Expr.(*sqlparser.ColumnRef)
+			if !ok {
+				return nil, fmt.Errorf("%s: unsupported ORDER BY expression %s", fn.Name, o.Expr.String())
+			}
+			col.Sorts = append(col.Sorts, elastic.SortInfo{
+				Field:     stripAlias(ref.Name, alias),
+				Ascending: o.Desc == (fn.Name == "LAST"),
+			})
+		}
+	default:
+		if len(fn.Args) != 1 {
+			return nil, fmt.Errorf("%s expects exactly one argument", fn.Name)
+		}
+	}
+	if len(fn.OrderBy) > 0 && len(col.Sorts) == 0 {
+		return nil, fmt.Errorf("ORDER BY is only supported in FIRST and LAST: %s", fn.String())
+	}
+	if fn.Distinct {
+		if fn.Name != "COUNT" {
+			return nil, fmt.Errorf("DISTINCT is only supported in COUNT: %s", fn.String())
+		}
+		col.Func = "COUNT_DISTINCT"
+	}
+	return col, nil
+}
+
+// aggregation 指标列对应的 ES 聚合
+func (c *Column) aggregation() elastic.Aggregation {
+	switch c.Func {
+	case "COUNT":
+		if c.Kind == ColumnCount {
+			return nil
+		}
+		return elastic.NewValueCountAggregation().Field(c.Field).Script(c.Script)
+	case "COUNT_DISTINCT":
+		return elastic.NewCardinalityAggregation().Field(c.Field).Script(c.Script)
+	case "SUM":
+		return elastic.NewSumAggregation().Field(c.Field).Script(c.Script)
+	case "AVG":
+		return elastic.NewAvgAggregation().Field(c.Field).Script(c.Script)
+	case "MIN":
+		return elastic.NewMinAggregation().Field(c.Field).Script(c.Script)
+	case "MAX":
+		return elastic.NewMaxAggregation().Field(c.Field).Script(c.Script)
+	case "PERCENTILE", "PERCENTILES":
+		return elastic.NewPercentilesAggregation().Field(c.Field).Script(c.Script).Percentiles(c.Percents...)
+	case "STATS":
+		return elastic.NewStatsAggregation().Field(c.Field).Script(c.Script)
+	case "EXTENDED_STATS":
+		return elastic.NewExtendedStatsAggregation().Field(c.Field).Script(c.Script)
+	case "FIRST", "LAST":
+		agg := elastic.NewTopHitsAggregation().Size(1).
+			FetchSourceContext(elastic.NewFetchSourceContext(true).Include(c.Field))
+		for _, s := range c.Sorts {
+			agg.SortWithInfo(s)
+		}
+		return agg
+	}
+	return nil
+}
+
+// singleValue 是否为单值数值指标，只有这类指标可以作为 terms 聚合的排序依据
+func (c *Column) singleValue() bool {
+	switch c.Func {
+	case "COUNT", "COUNT_DISTINCT", "SUM", "AVG", "MIN", "MAX":
+		return true
+	}
+	return false
+}
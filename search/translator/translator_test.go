@@ -0,0 +1,500 @@
+package translator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// dsl 翻译 SQL 并返回请求体 JSON
+func dsl(t *testing.T, sql string) string {
+	t.Helper()
+	return schemaDSL(t, sql, nil)
+}
+
+// schemaDSL 按给定的索引结构翻译 SQL
+func schemaDSL(t *testing.T, sql string, schema *Schema) string {
+	t.Helper()
+	stmt, err := sqlparser.ParseSelect(sql)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	req, err := Translate(stmt, schema)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	src, err := req.DSL()
+	assert.NoError(t, err)
+	b, err := json.Marshal(src)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestTranslateFullText(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "match with options",
+			sql:  "SELECT title FROM docs WHERE MATCH(title, 'foo bar', 'operator=and;fuzziness=AUTO') AND status = 1 LIMIT 10",
+			want: `{"_source":{"includes":["title"]},"from":0,"size":10,"query":{"bool":{
+				"filter":{"term":{"status":1}},
+				"must":{"match":{"title":{"fuzziness":"AUTO","operator":"and","query":"foo bar"}}}}}}`,
+		},
+		{
+			name: "match phrase",
+			sql:  "SELECT title FROM docs WHERE MATCH_PHRASE(title, 'quick fox', 'slop=2') LIMIT 10",
+			want: `{"_source":{"includes":["title"]},"from":0,"size":10,"query":{"bool":{
+				"must":{"match_phrase":{"title":{"query":"quick fox","slop":2}}}}}}`,
+		},
+		{
+			name: "multi match with boost",
+			sql:  "SELECT title FROM docs WHERE MULTI_MATCH('title^2, body', 'foo', 'type=best_fields') LIMIT 10",
+			want: `{"_source":{"includes":["title"]},"from":0,"size":10,"query":{"bool":{
+				"must":{"multi_match":{"fields":["title^2.000000","body"],"query":"foo","type":"best_fields"}}}}}`,
+		},
+		{
+			name: "query string",
+			sql:  "SELECT title FROM docs WHERE QUERY_STRING('title:foo AND body:bar', 'default_operator=and') LIMIT 10",
+			want: `{"_source":{"includes":["title"]},"from":0,"size":10,"query":{"bool":{
+				"must":{"query_string":{"default_operator":"and","query":"title:foo AND body:bar"}}}}}`,
+		},
+		{
+			name: "score and highlight",
+			sql:  "SELECT _id, _score, HIGHLIGHT(body, 'fragment_size=50') FROM docs WHERE MATCH(body, 'foo') ORDER BY _score DESC LIMIT 5",
+			want: `{"_source":false,"from":0,"size":5,"track_scores":true,
+				"highlight":{"fields":{"body":{"fragment_size":50}}},
+				"query":{"bool":{"must":{"match":{"body":{"query":"foo"}}}}},
+				"sort":[{"_score":{"order":"desc"}}]}`,
+		},
+		{
+			name: "or of full text",
+			sql:  "SELECT title FROM docs WHERE MATCH(title, 'a') OR MATCH(body, 'a') LIMIT 1",
+			want: `{"_source":{"includes":["title"]},"from":0,"size":1,"query":{"bool":{"must":{"bool":{
+				"minimum_should_match":"1",
+				"should":[{"match":{"title":{"query":"a"}}},{"match":{"body":{"query":"a"}}}]}}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.JSONEq(t, tt.want, dsl(t, tt.sql))
+		})
+	}
+}
+
+func TestTranslateAggregate(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "group by with pushed order",
+			sql:  "SELECT city, COUNT(*), SUM(amount) FROM orders GROUP BY city ORDER BY SUM(amount) DESC LIMIT 3",
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0":{
+				"terms":{"field":"city","size":3,"order":[{"agg_1":"desc"}]},
+				"aggregations":{"agg_1":{"sum":{"field":"amount"}}}}}}`,
+		},
+		{
+			name: "global metrics",
+			sql:  "SELECT COUNT(DISTINCT user_id), AVG(latency) FROM logs WHERE status >= 500",
+			want: `{"size":0,"track_total_hits":true,"query":{"bool":{"filter":{"range":{"status":{
+				"from":500,"include_lower":true,"include_upper":true,"to":null}}}}},
+				"aggregations":{"agg_0":{"cardinality":{"field":"user_id"}},"agg_1":{"avg":{"field":"latency"}}}}`,
+		},
+		{
+			name: "percentiles stats and top hits",
+			sql:  "SELECT page, PERCENTILE(latency, 95) AS p95, PERCENTILES(latency, 50, 99.9), STATS(latency), LAST(status ORDER BY ts) FROM perf GROUP BY page ORDER BY p95 DESC LIMIT 10",
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0":{"terms":{"field":"page","size":1000},
+				"aggregations":{"agg_0":{"percentiles":{"field":"latency","percents":[95]}},
+				"agg_1":{"percentiles":{"field":"latency","percents":[50,99.9]}},"agg_2":{"stats":{"field":"latency"}},
+				"agg_3":{"top_hits":{"_source":{"includes":["status"]},"size":1,"sort":[{"ts":{"order":"desc"}}]}}}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.JSONEq(t, tt.want, dsl(t, tt.sql))
+		})
+	}
+}
+
+func TestTranslateNested(t *testing.T) {
+	schema := &Schema{NestedPaths: []string{"items"}}
+	tests := []struct {
+		name     string
+		sql      string
+		noSchema bool // 未读取到 mapping，仅依赖 NESTED() 声明
+		want     string
+	}{
+		{
+			name: "nested field condition",
+			sql:  "SELECT id FROM orders WHERE items.sku = 'A' AND status = 1",
+			want: `{"_source":{"includes":["id"]},"from":0,"size":1000,"query":{"bool":{"filter":[
+				{"nested":{"path":"items","query":{"term":{"items.sku":"A"}}}},{"term":{"status":1}}]}}}`,
+		},
+		{
+			name: "same nested object",
+			sql:  "SELECT id FROM orders WHERE NESTED(items, items.sku = 'A' AND items.qty > 2)",
+			want: `{"_source":{"includes":["id"]},"from":0,"size":1000,"query":{"bool":{"filter":{"nested":{"path":"items",
+				"query":{"bool":{"filter":[{"term":{"items.sku":"A"}},{"range":{"items.qty":{
+				"from":2,"include_lower":false,"include_upper":true,"to":null}}}]}}}}}}}`,
+		},
+		{
+			name: "group by nested field",
+			sql:  "SELECT items.sku, SUM(items.qty) FROM orders WHERE items.qty > 2 GROUP BY items.sku ORDER BY SUM(items.qty) DESC LIMIT 5",
+			want: `{"size":0,"query":{"bool":{"filter":{"nested":{"path":"items","query":{"range":{"items.qty":{
+				"from":2,"include_lower":false,"include_upper":true,"to":null}}}}}}},
+				"aggregations":{"group_0_nested":{"nested":{"path":"items"},"aggregations":{"group_0_filter":{
+				"filter":{"range":{"items.qty":{"from":2,"include_lower":false,"include_upper":true,"to":null}}},
+				"aggregations":{"group_0":{"terms":{"field":"items.sku","size":5,"order":[{"agg_0":"desc"}]},
+				"aggregations":{"agg_0":{"sum":{"field":"items.qty"}}}}}}}}}}`,
+		},
+		{
+			name: "root metric under nested group",
+			sql:  "SELECT status, items.sku, COUNT(DISTINCT user_id) FROM orders GROUP BY status, items.sku",
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0":{"terms":{"field":"status","size":1000},
+				"aggregations":{"group_1_nested":{"nested":{"path":"items"},"aggregations":{"group_1":{
+				"terms":{"field":"items.sku","size":1000},"aggregations":{"agg_0_reverse":{"reverse_nested":{},
+				"aggregations":{"agg_0":{"cardinality":{"field":"user_id"}}}}}}}}}}}}`,
+		},
+		{
+			name:     "explicit nested without mapping",
+			sql:      "SELECT NESTED(items.sku) AS sku, COUNT(*) FROM orders GROUP BY sku",
+			noSchema: true,
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0_nested":{"nested":{"path":"items"},
+				"aggregations":{"group_0":{"terms":{"field":"items.sku","size":1000}}}}}}`,
+		},
+		{
+			name: "order by nested field",
+			sql:  "SELECT id FROM orders WHERE items.sku = 'A' ORDER BY items.price DESC",
+			want: `{"_source":{"includes":["id"]},"from":0,"size":1000,"query":{"bool":{"filter":{"nested":{"path":"items",
+				"query":{"term":{"items.sku":"A"}}}}}},"sort":[{"items.price":{"order":"desc",
+				"nested":{"path":"items","filter":{"term":{"items.sku":"A"}}}}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := schema
+			if tt.noSchema {
+				s = nil
+			}
+			assert.JSONEq(t, tt.want, schemaDSL(t, tt.sql, s))
+		})
+	}
+}
+
+func TestTranslateWindow(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "pipeline aggregations",
+			sql: "SELECT DATE_HISTOGRAM(ts, '1d', 'format=yyyy-MM-dd;time_zone=+08:00') AS day, SUM(pv) AS pv, " +
+				"CUMULATIVE_SUM(SUM(pv)) OVER (ORDER BY day) AS total, MOVING_AVG(SUM(pv), 7) OVER (ORDER BY day) AS ma7, " +
+				"DERIVATIVE(COUNT(*)) AS d FROM stats GROUP BY day",
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0":{
+				"date_histogram":{"calendar_interval":"1d","field":"ts","format":"yyyy-MM-dd","time_zone":"+08:00"},
+				"aggregations":{"agg_0":{"sum":{"field":"pv"}},"agg_1":{"cumulative_sum":{"buckets_path":"agg_0"}},
+				"agg_2":{"moving_fn":{"buckets_path":"agg_0","script":{"source":"MovingFunctions.unweightedAvg(values)"},"shift":1,"window":7}},
+				"agg_4":{"derivative":{"buckets_path":"_count"}}}}}}`,
+		},
+		{
+			name: "partitioned by outer group",
+			sql:  "SELECT site, DATE_HISTOGRAM(ts, '7d') AS w, CUMULATIVE_SUM(SUM(pv)) OVER (PARTITION BY site ORDER BY w) FROM stats GROUP BY site, w",
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0":{"terms":{"field":"site","size":1000},
+				"aggregations":{"group_1":{"date_histogram":{"field":"ts","fixed_interval":"7d"},
+				"aggregations":{"agg_0":{"sum":{"field":"pv"}},"agg_1":{"cumulative_sum":{"buckets_path":"agg_0"}}}}}}}}`,
+		},
+		{
+			name: "bucket sort",
+			sql:  "SELECT DATE_HISTOGRAM(ts, '1h') AS hour, COUNT(*) AS cnt FROM stats GROUP BY hour ORDER BY cnt DESC LIMIT 5",
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0":{"date_histogram":{"calendar_interval":"1h","field":"ts"},
+				"aggregations":{"bucket_sort":{"bucket_sort":{"size":5,"sort":[{"_count":{"order":"desc"}}]}}}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.JSONEq(t, tt.want, dsl(t, tt.sql))
+		})
+	}
+}
+
+func TestTranslateWrite(t *testing.T) {
+	write := func(sql string) *WriteRequest {
+		stmt, err := sqlparser.Parse(sql)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		var req *WriteRequest
+		switch s := stmt.(type) {
+		case *sqlparser.InsertStmt:
+			req, err = TranslateInsert(s)
+		case *sqlparser.UpdateStmt:
+			req, err = TranslateUpdate(s, nil)
+		case *sqlparser.DeleteStmt:
+			req, err = TranslateDelete(s, nil)
+		}
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return req
+	}
+	body := func(req *WriteRequest) string {
+		src, err := req.DSL()
+		assert.NoError(t, err)
+		b, err := json.Marshal(src)
+		assert.NoError(t, err)
+		return string(b)
+	}
+
+	req := write("INSERT INTO users (_id, name, profile.age) VALUES ('u1', 'tom', 20), ('u2', 'amy', NULL)")
+	assert.Equal(t, []string{"u1", "u2"}, req.IDs)
+	assert.Equal(t, `{"docs":[{"name":"tom","profile":{"age":20}},{"name":"amy","profile":{"age":null}}]}`, body(req))
+
+	req = write("UPDATE users u SET u.score = u.score * 2 + 1, tag = CONCAT('vip-', u.name) WHERE u.level > 3")
+	assert.Equal(t, `{"query":{"bool":{"filter":{"range":{"level":{"from":3,"include_lower":false,"include_upper":true,"to":null}}}}},`+
+		`"script":{"lang":"painless","params":{"p0":2,"p1":1,"p2":"vip-"},`+
+		`"source":"ctx._source['score'] = ((ctx._source['score'] * params.p0) + params.p1); ctx._source['tag'] = (\"\" + params.p2 + ctx._source['name']);"}}`, body(req))
+
+	req = write("DELETE FROM logs WHERE level = 'debug'")
+	assert.Equal(t, "logs", req.Index)
+	assert.Equal(t, `{"query":{"bool":{"filter":{"term":{"level":"debug"}}}}}`, body(req))
+}
+
+func TestTranslateReindex(t *testing.T) {
+	reindex := func(sql string) (*ReindexRequest, error) {
+		stmt, err := sqlparser.Parse(sql)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return TranslateReindex(stmt.(*sqlparser.InsertStmt), nil)
+	}
+	body := func(req *ReindexRequest) string {
+		b, err := req.Body()
+		assert.NoError(t, err)
+		out, _ := json.Marshal(b)
+		return string(out)
+	}
+
+	req, err := reindex("INSERT INTO new_logs SELECT l.url, UPPER(l.agent) AS agent, user.name AS `owner.name` FROM logs l WHERE l.code >= 500 LIMIT 100")
+	if assert.NoError(t, err) {
+		assert.False(t, req.Fallback)
+		assert.Equal(t, `{"dest":{"index":"new_logs"},"max_docs":100,`+
+			`"script":{"lang":"painless","source":"Map d = new HashMap(); d['url'] = ctx._source['url']; `+
+			`d['agent'] = ctx._source['agent'].toUpperCase(); `+
+			`((Map) d.computeIfAbsent('owner', k -\u003e new HashMap()))['name'] = ctx._source['user']['name']; ctx._source = d;"},`+
+			`"source":{"index":"logs","query":{"bool":{"filter":{"range":{"code":{"from":500,"include_lower":true,"include_upper":true,"to":null}}}}}}}`, body(req))
+	}
+
+	req, err = reindex("INSERT INTO new_logs SELECT * FROM logs WHERE code = 1")
+	if assert.NoError(t, err) {
+		assert.False(t, req.Fallback)
+		assert.Equal(t, `{"dest":{"index":"new_logs"},"source":{"index":"logs","query":{"bool":{"filter":{"term":{"code":1}}}}}}`, body(req))
+	}
+
+	req, err = reindex("INSERT INTO new_logs (_id, url, error) SELECT CONCAT('x-', _id), url, code IN (500, 502) FROM logs")
+	if assert.NoError(t, err) {
+		assert.True(t, req.Fallback)
+		assert.Nil(t, req.Script)
+		assert.Equal(t, []string{"_id", "url", "error"}, req.Columns)
+	}
+
+	req, err = reindex("INSERT INTO new_logs SELECT url FROM logs ORDER BY ts DESC LIMIT 10")
+	if assert.NoError(t, err) {
+		assert.True(t, req.Fallback)
+	}
+
+	for sql, msg := range map[string]string{
+		"INSERT INTO n SELECT city, COUNT(*) AS c FROM logs GROUP BY city": "GROUP BY",
+		"INSERT INTO n (a) SELECT * FROM logs":                             "cannot be used with a column list",
+		"INSERT INTO n SELECT UPPER(a) FROM logs":                          "needs an alias",
+		"INSERT INTO n (a, b) SELECT a FROM logs":                          "column count doesn't match",
+		"INSERT INTO n (_score) SELECT a FROM logs":                        "meta field _score",
+	} {
+		_, err := reindex(sql)
+		if assert.Error(t, err, sql) {
+			assert.Contains(t, err.Error(), msg, sql)
+		}
+	}
+}
+
+func TestTranslateDDL(t *testing.T) {
+	ddl := func(sql string) (string, error) {
+		stmt, err := sqlparser.Parse(sql)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		var req *DDLRequest
+		switch s := stmt.(type) {
+		case *sqlparser.CreateTableStmt:
+			req, err = TranslateCreateTable(s)
+		case *sqlparser.AlterTableStmt:
+			req, err = TranslateAlterTable(s)
+		}
+		if err != nil {
+			return "", err
+		}
+		b, _ := json.Marshal(req.Body)
+		return string(b), nil
+	}
+
+	body, err := ddl("CREATE TABLE logs (ts DATETIME, url KEYWORD, body TEXT, code SMALLINT, price DECIMAL(10, 2), " +
+		"agent VARCHAR(256), user.id BIGINT, user.ip IP) WITH (shards=3, replicas = 1, refresh_interval = '5s')")
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{
+			"settings":{"number_of_shards":3,"number_of_replicas":1,"refresh_interval":"5s"},
+			"mappings":{"properties":{
+				"ts":{"type":"date","format":"yyyy-MM-dd HH:mm:ss||strict_date_optional_time||epoch_millis"},
+				"url":{"type":"keyword"},
+				"body":{"type":"text"},
+				"code":{"type":"short"},
+				"price":{"type":"scaled_float","scaling_factor":100},
+				"agent":{"type":"keyword","ignore_above":256},
+				"user":{"type":"object","properties":{"id":{"type":"long"},"ip":{"type":"ip"}}}
+			}}
+		}`, body)
+	}
+
+	body, err = ddl("ALTER TABLE logs ADD COLUMN referer KEYWORD, ADD items NESTED")
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"properties":{"referer":{"type":"keyword"},"items":{"type":"nested","properties":{}}}}`, body)
+	}
+
+	for sql, msg := range map[string]string{
+		"CREATE TABLE t (a GEOMETRY)":          "unsupported column type GEOMETRY",
+		"CREATE TABLE t (a INT(11))":           "invalid type parameters",
+		"CREATE TABLE t (a INT, a TEXT)":       "duplicate column name a",
+		"CREATE TABLE t (_id KEYWORD)":         "reserved",
+		"CREATE TABLE t (a INT) WITH (foo=1)":  "unsupported table option foo",
+		"CREATE TABLE t (a INT, a.b KEYWORD)":  "a is not an object field",
+		"ALTER TABLE t ADD COLUMN b ENUM(1,2)": "unsupported column type ENUM",
+	} {
+		_, err := ddl(sql)
+		if assert.Error(t, err, sql) {
+			assert.Contains(t, err.Error(), msg, sql)
+		}
+	}
+}
+
+func TestTranslateScalar(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "script field, script query and script sort",
+			sql:  "SELECT UPPER(a) AS k FROM t WHERE LOWER(c) = 'x' ORDER BY k LIMIT 1",
+			want: `{"_source":false,"from":0,"size":1,
+				"query":{"bool":{"filter":{"script":{"script":{"lang":"painless","params":{"p0":"x"},
+				"source":"try { def v = ((doc['c'].size() == 0 ? null : doc['c'].value).toLowerCase() == params.p0); return v == null ? false : v; } catch (NullPointerException e) { return false; }"}}}}},
+				"script_fields":{"expr_0":{"script":{"lang":"painless",
+				"source":"try { return (doc['a'].size() == 0 ? null : doc['a'].value).toUpperCase(); } catch (NullPointerException e) { return null; }"}}},
+				"sort":[{"_script":{"order":"asc","type":"string","script":{"lang":"painless",
+				"source":"try { def v = (doc['a'].size() == 0 ? null : doc['a'].value).toUpperCase(); return v == null ? '' : v; } catch (NullPointerException e) { return ''; }"}}}]}`,
+		},
+		{
+			name: "group by expression and aggregate of expression",
+			sql:  "SELECT ROUND(price) AS p, SUM(price * qty) FROM orders GROUP BY p",
+			want: `{"size":0,"query":{"match_all":{}},"aggregations":{"group_0":{
+				"terms":{"size":1000,"script":{"lang":"painless",
+				"source":"def sqlRound(def x, def d) { if (x == null || d == null) { return null; } double m = Math.pow(10, (int) d); return Math.signum((double) x) * Math.round(Math.abs((double) x) * m) / m; } try { return sqlRound((doc['price'].size() == 0 ? null : doc['price'].value), 0); } catch (NullPointerException e) { return null; }"}},
+				"aggregations":{"agg_0":{"sum":{"script":{"lang":"painless",
+				"source":"try { return ((doc['price'].size() == 0 ? null : doc['price'].value) * (doc['qty'].size() == 0 ? null : doc['qty'].value)); } catch (NullPointerException e) { return null; }"}}}}}}}`,
+		},
+		{
+			name: "date format and comparison of two fields",
+			sql:  "SELECT DATE_FORMAT(ts, '%Y-%m'), COUNT(*) FROM logs WHERE a > b GROUP BY 1",
+			want: `{"size":0,"query":{"bool":{"filter":{"script":{"script":{"lang":"painless",
+				"source":"try { def v = ((doc['a'].size() == 0 ? null : doc['a'].value) > (doc['b'].size() == 0 ? null : doc['b'].value)); return v == null ? false : v; } catch (NullPointerException e) { return false; }"}}}}},
+				"aggregations":{"group_0":{"terms":{"size":1000,"script":{"lang":"painless","params":{"p0":"yyyy'-'MM"},
+				"source":"try { return (doc['ts'].size() == 0 ? null : doc['ts'].value).format(DateTimeFormatter.ofPattern(params.p0)); } catch (NullPointerException e) { return null; }"}}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.JSONEq(t, tt.want, dsl(t, tt.sql))
+		})
+	}
+
+	// 不能翻译为 painless 或引用聚合结果的表达式由执行引擎计算
+	translate := func(sql string) *Request {
+		stmt, err := sqlparser.ParseSelect(sql)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		req, err := Translate(stmt, nil)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return req
+	}
+	req := translate("SELECT LENGTH(name), CASE WHEN a > 1 THEN 'big' END AS size FROM t")
+	assert.Equal(t, ColumnComputed, req.Columns[0].Kind)
+	assert.Equal(t, ColumnScript, req.Columns[1].Kind)
+	src, _ := req.Source.Source()
+	assert.Equal(t, []string{"name"}, src.(map[string]interface{})["_source"].(map[string]interface{})["includes"])
+
+	req = translate("SELECT city, ROUND(AVG(price), 2) AS p FROM orders GROUP BY city HAVING p > 10")
+	assert.Equal(t, ColumnComputed, req.Columns[1].Kind)
+	assert.Equal(t, "AVG", req.Columns[2].Func)
+	assert.True(t, req.Columns[2].Hidden)
+}
+
+func TestTranslateOrdinal(t *testing.T) {
+	assert.JSONEq(t, dsl(t, "SELECT a, b AS bb FROM t ORDER BY 2 DESC, 1"),
+		dsl(t, "SELECT a, b AS bb FROM t ORDER BY b DESC, a"))
+	assert.JSONEq(t, dsl(t, "SELECT a, COUNT(*) FROM t GROUP BY a ORDER BY 2 DESC LIMIT 3"),
+		dsl(t, "SELECT a, COUNT(*) FROM t GROUP BY a ORDER BY COUNT(*) DESC LIMIT 3"))
+	assert.JSONEq(t, dsl(t, "SELECT x.* FROM t AS x"), dsl(t, "SELECT * FROM t AS x"))
+	assert.JSONEq(t, dsl(t, "SELECT t.* FROM t"), dsl(t, "SELECT * FROM t"))
+}
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		msg  string
+	}{
+		{name: "unknown option", sql: "SELECT a FROM t WHERE MATCH(a, 'x', 'foo=1')", msg: "unknown option 'foo'"},
+		{name: "bad option", sql: "SELECT a FROM t WHERE MATCH_PHRASE(a, 'x', 'slop=x')", msg: "expects an integer"},
+		{name: "non aggregate column", sql: "SELECT a, b FROM t GROUP BY a", msg: "must appear in GROUP BY"},
+		{name: "highlight without field", sql: "SELECT HIGHLIGHT('a') FROM t", msg: "expects a field"},
+		{name: "first without order", sql: "SELECT FIRST(a) FROM t", msg: "requires ORDER BY"},
+		{name: "percent out of range", sql: "SELECT PERCENTILE(a, 120) FROM t", msg: "between 0 and 100"},
+		{name: "window without histogram", sql: "SELECT a, CUMULATIVE_SUM(SUM(b)) FROM t GROUP BY a", msg: "requires DATE_HISTOGRAM"},
+		{name: "window descending", sql: "SELECT DATE_HISTOGRAM(ts, '1d') d, DERIVATIVE(SUM(b)) OVER (ORDER BY d DESC) FROM t GROUP BY d", msg: "ascending"},
+		{name: "bad interval", sql: "SELECT DATE_HISTOGRAM(ts, 'daily'), COUNT(*) FROM t GROUP BY 1", msg: "invalid interval"},
+		{name: "nested top level field", sql: "SELECT NESTED(sku) FROM t", msg: "not inside an object"},
+		{name: "unknown function", sql: "SELECT FOO(a) FROM t", msg: "unsupported function FOO"},
+		{name: "parameter count", sql: "SELECT a FROM t WHERE SUBSTRING(a) = 'x'", msg: "incorrect parameter count"},
+		{name: "expression not grouped", sql: "SELECT UPPER(b), COUNT(*) FROM t GROUP BY a", msg: "must appear in GROUP BY"},
+		{name: "unknown star table", sql: "SELECT x.* FROM t", msg: "unknown table 'x'"},
+		{name: "star table instead of alias", sql: "SELECT t.* FROM t AS a", msg: "unknown table 't'"},
+		{name: "score in where", sql: "SELECT a FROM t WHERE _score > 1", msg: "_score cannot be used in WHERE"},
+		{name: "score in where expression", sql: "SELECT a FROM t AS x WHERE x._score * 2 > 1 OR a = 1", msg: "_score cannot be used in WHERE"},
+		{name: "ordinal zero", sql: "SELECT a, b FROM t ORDER BY 0", msg: "unknown column '0' in ORDER BY"},
+		{name: "ordinal out of range", sql: "SELECT a, b FROM t ORDER BY 5", msg: "unknown column '5' in ORDER BY"},
+		{name: "aggregate ordinal out of range", sql: "SELECT a, COUNT(*) FROM t GROUP BY a ORDER BY 3", msg: "unknown column '3' in ORDER BY"},
+		{name: "ordinal on star", sql: "SELECT * FROM t ORDER BY 1", msg: "refers to *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := sqlparser.ParseSelect(tt.sql)
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = Translate(stmt, nil)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package translator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+
+	"lium-product/es-search/search/sqlparser"
+)
+
+// WriteRequest 写语句对应的 ES 请求
+type WriteRequest struct {
+	Index  string
+	Query  elastic.Query            // UPDATE / DELETE 的过滤条件
+	Script *elastic.Script          // UPDATE 的 painless 脚本
+	Docs   []map[string]interface{} // INSERT 的文档
+	IDs    []string                 // INSERT 指定的 _id，未指定时为空串
+}
+
+// DSL 返回请求体，用于 EXPLAIN
+func (r *WriteRequest) DSL() (interface{}, error) {
+	out := make(map[string]interface{})
+	if r.Query != nil {
+		q, err := r.Query.Source()
+		if err != nil {
+			return nil, err
+		}
+		out["query"] = q
+	}
+	if r.Script != nil {
+		s, err := r.Script.Source()
+		if err != nil {
+			return nil, err
+		}
+		out["script"] = s
+	}
+	if r.Docs != nil {
+		out["docs"] = r.Docs
+	}
+	return out, nil
+}
+
+// metaFields 不能通过 INSERT 字段以外的方式写入的元字段
+var metaFields = map[string]bool{"_id": true, "_index": true, ScoreField: true}
+
+// TranslateInsert INSERT 翻译为待写入的文档，点号字段写为对象，_id 字段作为文档 ID
+func TranslateInsert(stmt *sqlparser.InsertStmt) (*WriteRequest, error) {
+	if len(stmt.Columns) == 0 {
+		return nil, fmt.Errorf("INSERT requires a column list")
+	}
+	req := &WriteRequest{Index: stmt.Table}
+	for i, row := range stmt.Rows {
+		if len(row) != len(stmt.Columns) {
+			return nil, fmt.Errorf("column count doesn't match value count at row %d", i+1)
+		}
+		doc := make(map[string]interface{})
+		id := ""
+		for j, c := range stmt.Columns {
+			v, err := constValue(row[j])
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case c == "_id":
+				if v == nil {
+					return nil, fmt.Errorf("_id cannot be NULL at row %d", i+1)
+				}
+				id = fmt.Sprint(v)
+			case metaFields[c]:
+				return nil, fmt.Errorf("cannot insert into meta field %s", c)
+			default:
+				SetPath(doc, c, v)
+			}
+		}
+		req.Docs = append(req.Docs, doc)
+		req.IDs = append(req.IDs, id)
+	}
+	return req, nil
+}
+
+// constValue INSERT 中的常量：字面量、NULL 与负数
+func constValue(e sqlparser.Expr) (interface{}, error) {
+	switch v := e.(type) {
+	case *sqlparser.NullLit:
+		return nil, nil
+	case *sqlparser.UnaryExpr:
+		if n, ok := v.Expr.(*sqlparser.NumberLit); ok && v.Op == "-" {
+			return (&sqlparser.NumberLit{Raw: "-" + n.Raw}).Value(), nil
+		}
+	}
+	v, err := literalValue(e)
+	if err != nil {
+		return nil, fmt.Errorf("INSERT values must be constants, got %s", e.String())
+	}
+	return v, nil
+}
+
+// SetPath 按点号路径写入字段，中间的对象不存在时创建
+func SetPath(doc map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := doc[p].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			doc[p] = child
+		}
+		doc = child
+	}
+	doc[parts[len(parts)-1]] = v
+}
+
+// TranslateUpdate UPDATE 翻译为 update_by_query：WHERE 转为查询，SET 转为 painless 脚本
+func TranslateUpdate(stmt *sqlparser.UpdateStmt, schema *Schema) (*WriteRequest, error) {
+	alias := stmt.Table.Alias
+	q, err := BuildQuery(stmt.Where, alias, schema)
+	if err != nil {
+		return nil, err
+	}
+	ps := &painless{alias: alias, params: make(map[string]interface{})}
+	var lines []string
+	for _, a := range stmt.Set {
+		field := stripAlias(a.Column, alias)
+		if metaFields[field] {
+			return nil, fmt.Errorf("cannot update meta field %s", field)
+		}
+		if p := schema.NestedPath(field); p != "" {
+			return nil, fmt.Errorf("cannot update field %s inside nested path %s", field, p)
+		}
+		v, err := ps.expr(a.Value)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, sourcePath(field)+" = "+v+";")
+	}
+	return &WriteRequest{Index: stmt.Table.Name, Query: q, Script: ps.script(strings.Join(lines, " "))}, nil
+}
+
+// TranslateDelete DELETE 翻译为 delete_by_query
+func TranslateDelete(stmt *sqlparser.DeleteStmt, schema *Schema) (*WriteRequest, error) {
+	q, err := BuildQuery(stmt.Where, stmt.Table.Alias, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &WriteRequest{Index: stmt.Table.Name, Query: q}, nil
+}
+
+// painless 将表达式翻译为 painless，字面量作为脚本参数传入。
+// 写语句从 ctx._source 读取字段，doc 为 true 时从 doc values 读取，用于查询、聚合与排序中的脚本
+type painless struct {
+	alias   string
+	params  map[string]interface{}
+	doc     bool
+	helpers map[string]bool // 用到的辅助函数
+}
+
+var painlessOps = map[string]string{
+	"+": "+", "-": "-", "*": "*", "/": "/", "%": "%",
+	"=": "==", "!=": "!=", "<>": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+	"AND": "&&", "OR": "||",
+}
+
+func (ps *painless) param(v interface{}) string {
+	name := "p" + strconv.Itoa(len(ps.params))
+	ps.params[name] = v
+	return "params." + name
+}
+
+func (ps *painless) expr(e sqlparser.Expr) (string, error) {
+	switch n := e.(type) {
+	case *sqlparser.StringLit:
+		return ps.param(n.Val), nil
+	case *sqlparser.NumberLit:
+		return ps.param(n.Value()), nil
+	case *sqlparser.BoolLit:
+		return ps.param(n.Val), nil
+	case *sqlparser.NullLit:
+		return "null", nil
+	case *sqlparser.ColumnRef:
+		field := stripAlias(n.Name, ps.alias)
+		if metaFields[field] {
+			return "", fmt.Errorf("cannot use meta field %s in a script", field)
+		}
+		if ps.doc {
+			return docValue(field), nil
+		}
+		return sourcePath(field), nil
+	case *sqlparser.UnaryExpr:
+		x, err := ps.expr(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		if n.Op == "NOT" {
+			return "!(" + x + ")", nil
+		}
+		return n.Op + "(" + x + ")", nil
+	case *sqlparser.BinaryExpr:
+		op, ok := painlessOps[n.Op]
+		if !ok {
+			break
+		}
+		l, err := ps.expr(n.Left)
+		if err != nil {
+			return "", err
+		}
+		r, err := ps.expr(n.Right)
+		if err != nil {
+			return "", err
+		}
+		return "(" + l + " " + op + " " + r + ")", nil
+	case *sqlparser.IsNullExpr:
+		x, err := ps.expr(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		if n.Not {
+			return "(" + x + " != null)", nil
+		}
+		return "(" + x + " == null)", nil
+	case *sqlparser.FuncCall:
+		return ps.call(n)
+	case *sqlparser.CaseExpr:
+		return ps.caseExpr(n)
+	}
+	return "", fmt.Errorf("cannot translate expression to painless: %s", e.String())
+}
+
+// docValue 字段的 doc values，字段缺失时为 null
+func docValue(field string) string {
+	d := "doc[" + quotePainless(field) + "]"
+	return "(" + d + ".size() == 0 ? null : " + d + ".value)"
+}
+
+// sourcePath 字段在 painless 中的访问路径，例如 ctx._source['user']['name']
+func sourcePath(field string) string {
+	var b strings.Builder
+	b.WriteString("ctx._source")
+	for _, p := range strings.Split(field, ".") {
+		b.WriteString("[" + quotePainless(p) + "]")
+	}
+	return b.String()
+}
@@ -1,8 +1,10 @@
 package testcommon
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -23,6 +25,17 @@ type MockServer struct {
 	mu       sync.RWMutex
 	handlers map[string]HandlerFunc
 	server   *httptest.Server
+
+	reqMu    sync.Mutex
+	requests []RecordedRequest
+}
+
+// RecordedRequest MockServer 收到的请求，用于断言生成的 DSL
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   []byte
 }
 
 type CustomRoundTripper struct {
@@ -36,6 +49,8 @@ func NewMockServer() *MockServer {
 	}
 
 	ms.server = httptest.NewServer(http.HandlerFunc(ms.ServeHTTP))
+	// 连接时通过 GET / 识别服务端版本，测试可以重新注册 ^/$ 模拟其他版本
+	ms.Register("^/$", json.RawMessage(`{"version":{"number":"7.17.9"}}`))
 	ms.NewElasticClient()
 	return ms
 }
@@ -233,6 +248,7 @@ func (ms *MockServer) RegisterHandler(path string, handler HandlerFunc) {
 
 // ServeHTTP 实现了 http.Handler 接口
 func (ms *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ms.record(r)
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
@@ -246,6 +262,41 @@ func (ms *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
+// record 记录请求，读取后的请求体会被还原，不影响后续处理
+func (ms *MockServer) record(r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	ms.requests = append(ms.requests, RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Body:   body,
+	})
+}
+
+// Requests 返回收到的全部请求
+func (ms *MockServer) Requests() []RecordedRequest {
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	return append([]RecordedRequest(nil), ms.requests...)
+}
+
+// LastRequest 返回最后一次收到的请求，没有请求时返回 nil
+func (ms *MockServer) LastRequest() *RecordedRequest {
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	if len(ms.requests) == 0 {
+		return nil
+	}
+	r := ms.requests[len(ms.requests)-1]
+	return &r
+}
+
 // Close 关闭 MockServer
 func (ms *MockServer) Close() {
 	ms.server.Close()